@@ -0,0 +1,85 @@
+// Command migrate applies, reverts or lists the schema migrations embedded in the binary.
+//
+//	migrate up           apply every pending migration
+//	migrate down [-n 1]  revert the n most recent migrations
+//	migrate status       list migrations and whether they are applied
+package main
+
+import (
+	"banditsecret/internal/storage"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: %s up|down [-n steps]|status\n", os.Args[0])
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	// Flags follow the subcommand, so each subcommand parses its own
+	command := os.Args[1]
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	var steps *int
+	switch command {
+	case "up", "status":
+	case "down":
+		steps = flags.Int("n", 1, "number of migrations to revert")
+	default:
+		usage()
+	}
+	flags.Parse(os.Args[2:])
+	if flags.NArg() != 0 {
+		usage()
+	}
+
+	db, err := storage.InitDb()
+	if err != nil {
+		log.Fatalf("failed to init db: %v", err)
+	}
+	defer db.Close()
+
+	migrator, err := storage.NewMigrator(db)
+	if err != nil {
+		log.Fatalf("Failed to load migrations: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	switch command {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			log.Fatalf("Migrating up failed after %d migrations: %v", applied, err)
+		}
+		log.Printf("Applied %d migrations", applied)
+	case "down":
+		reverted, err := migrator.Down(ctx, *steps)
+		if err != nil {
+			log.Fatalf("Migrating down failed after %d migrations: %v", reverted, err)
+		}
+		log.Printf("Reverted %d migrations", reverted)
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			log.Fatalf("Failed to get migration status: %v", err)
+		}
+		for _, s := range statuses {
+			applied := "pending"
+			if s.Applied {
+				applied = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%s\t%s\n", s.Version, s.Name, applied)
+		}
+	}
+}
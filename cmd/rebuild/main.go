@@ -0,0 +1,59 @@
+// Command rebuild replays every caption stored in the database into the search index.
+// It resumes from the last checkpoint unless -fresh is given.
+package main
+
+import (
+	"banditsecret/internal/app"
+	searcher "banditsecret/internal/search"
+	"banditsecret/internal/storage"
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+func main() {
+	fresh := flag.Bool("fresh", false, "ignore any checkpoint and index every video again")
+	batchSize := flag.Int("batch", 100, "number of videos read from the database at a time")
+	flag.Parse()
+
+	db, err := storage.InitDb()
+	if err != nil {
+		log.Fatalf("failed to init db: %v", err)
+	}
+	defer db.Close()
+	captionRepo := storage.NewSQLCaptionRepository(db)
+
+	captionSearchRepo, err := searcher.InitCaptionSearchRepository(db)
+	if err != nil {
+		log.Fatalf("Failed to init search backend: %v", err)
+	}
+	searcherService := searcher.NewSearcherService(captionSearchRepo)
+
+	// Stopping part way is safe, the next run picks up from the checkpoint
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Captions can't be indexed into an index with an older mapping, it is reindexed onto the current one first
+	err = searcherService.CreateIndex(ctx, os.Getenv("CAPTIONS_INDEX"))
+	if rb, ok := captionSearchRepo.(searcher.IndexRebuilder); ok && errors.Is(err, searcher.ErrMappingMismatch) {
+		log.Printf("%v, reindexing onto the current mapping", err)
+		err = rb.Reindex(ctx, os.Getenv("CAPTIONS_INDEX"), false, func(p searcher.ReindexProgress) {
+			log.Printf("Reindex %s: %s", p.Target, p.Step)
+		})
+	}
+	if err != nil {
+		log.Fatalf("CreateIndex failed: %v", err)
+	}
+
+	rebuilder := app.NewRebuilder(captionRepo, searcherService, os.Getenv("CAPTIONS_INDEX"), *batchSize)
+	if err := rebuilder.Run(ctx, *fresh); err != nil {
+		log.Fatalf("Rebuild failed: %v", err)
+	}
+
+	status, _ := rebuilder.Status()
+	log.Printf("Rebuilt search index from %d videos and %d captions", status.Videos, status.Captions)
+}
@@ -2,18 +2,25 @@ package main
 
 import (
 	"banditsecret/internal/app"
+	"banditsecret/internal/jobs"
 	searcher "banditsecret/internal/search"
 	"banditsecret/internal/storage"
+	"banditsecret/internal/transcript"
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
 type CaptionRepository = storage.CaptionRepository
-type CaptionSearchRepository = searcher.CaptionSearchRepository
 
 func main() {
 
@@ -23,14 +30,24 @@ func main() {
 		log.Fatalf("failed to init db: %v", err)
 	}
 	defer db.Close()
+
+	// Replicas starting together take turns, the migration lock serialises them
+	if os.Getenv("DB_AUTO_MIGRATE") != "false" {
+		migrator, err := storage.NewMigrator(db)
+		if err != nil {
+			log.Fatalf("failed to load migrations: %v", err)
+		}
+		if _, err := migrator.Up(context.Background()); err != nil {
+			log.Fatalf("failed to migrate db: %v", err)
+		}
+	}
 	var captionRepo CaptionRepository = storage.NewSQLCaptionRepository(db)
 
 	// Init search engine connection
-	esClient, err := searcher.InitEsClient()
+	captionSearchRepo, err := searcher.InitCaptionSearchRepository(db)
 	if err != nil {
-		log.Fatalf("Failed to init Elasticsearch client: %v", err)
+		log.Fatalf("Failed to init search backend: %v", err)
 	}
-	var captionSearchRepo CaptionSearchRepository = searcher.NewElasticSearchRepository(esClient)
 
 	// Init app services
 	appServices, err := app.NewApplicationServices(captionRepo, captionSearchRepo)
@@ -50,6 +67,57 @@ func startServer(appServices *app.ApplicationServices) {
 		ingestVideoHandler(c, appServices)
 	})
 
+	v1.GET("/jobs/:id", func(c *gin.Context) {
+		jobStatusHandler(c, appServices)
+	})
+
+	v1.GET("/videos", func(c *gin.Context) {
+		listVideosHandler(c, appServices)
+	})
+
+	v1.GET("/videos/:id", func(c *gin.Context) {
+		getVideoHandler(c, appServices)
+	})
+
+	v1.GET("/videos/:id/captions", func(c *gin.Context) {
+		videoCaptionsHandler(c, appServices)
+	})
+
+	v1.GET("/videos/:id/transcript", func(c *gin.Context) {
+		transcriptHandler(c, appServices)
+	})
+
+	v1.DELETE("/videos/:id", func(c *gin.Context) {
+		deleteVideoHandler(c, appServices)
+	})
+
+	admin := v1.Group("/admin")
+
+	admin.POST("/reindex", func(c *gin.Context) {
+		startReindexHandler(c, appServices)
+	})
+
+	admin.GET("/reindex", func(c *gin.Context) {
+		reindexStatusHandler(c, appServices)
+	})
+
+	admin.POST("/rebuild", func(c *gin.Context) {
+		startRebuildHandler(c, appServices)
+	})
+
+	admin.GET("/rebuild", func(c *gin.Context) {
+		rebuildStatusHandler(c, appServices)
+	})
+
+	// GET only reports drift between MySQL and the search index, POST also repairs it
+	admin.GET("/reconcile", func(c *gin.Context) {
+		reconcileHandler(c, appServices, false)
+	})
+
+	admin.POST("/reconcile", func(c *gin.Context) {
+		reconcileHandler(c, appServices, true)
+	})
+
 	v1.GET("/test_get_metadata", func(c *gin.Context) {
 
 		body, err := c.GetRawData()
@@ -59,7 +127,7 @@ func startServer(appServices *app.ApplicationServices) {
 		}
 		url := string(body)
 
-		meta, err := appServices.Fetcher.GetMetadata(url, os.Getenv("JSON_CAPTIONS_DIR"))
+		meta, err := appServices.Fetcher.GetMetadata(url)
 		if err != nil {
 			log.Printf("Failed to get video metadata: %v", err)
 			return
@@ -76,13 +144,13 @@ func startServer(appServices *app.ApplicationServices) {
 		}
 		url := string(body)
 
-		meta, err := appServices.Fetcher.GetMetadata(url, os.Getenv("JSON_CAPTIONS_DIR"))
+		meta, err := appServices.Fetcher.GetMetadata(url)
 		if err != nil {
 			log.Printf("Failed to get video metadata: %v", err)
 			return
 		}
 
-		output, err := appServices.Fetcher.DownloadCaptions(meta.VideoId, url, os.Getenv("VTT_CAPTIONS_DIR"))
+		output, err := appServices.Fetcher.DownloadCaptions(meta.VideoId, url, os.Getenv("VTT_CAPTIONS_DIR"), queryList(c, "lang"))
 		if err != nil {
 			log.Printf("Failed to get video metadata: %v", err)
 			return
@@ -99,13 +167,66 @@ func startServer(appServices *app.ApplicationServices) {
 }
 
 func queryHandler(c *gin.Context, s *app.ApplicationServices) {
-	query := c.Query("query")
+	page, err := queryInt(c, "page")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	size, err := queryInt(c, "size")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	minStart, err := queryMillis(c, "min_start")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	maxStart, err := queryMillis(c, "max_start")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	params := searcher.SearchParams{
+		Query:     c.Query("query"),
+		Languages: queryList(c, "lang"),
+		Page:      page,
+		Size:      size,
+		Cursor:    c.Query("cursor"),
+		PreTag:    c.Query("pre_tag"),
+		PostTag:   c.Query("post_tag"),
+		Fuzziness: c.Query("fuzziness"),
+		Filters: searcher.SearchFilters{
+			VideoIds:       queryList(c, "video_id"),
+			ChannelId:      c.Query("channel_id"),
+			UploadedAfter:  c.Query("uploaded_after"),
+			UploadedBefore: c.Query("uploaded_before"),
+			MinStart:       minStart,
+			MaxStart:       maxStart,
+		},
+	}
 
 	ctx := c.Request.Context()
-	res, err := s.Searcher.SearchCaptions(ctx, os.Getenv("CAPTIONS_INDEX"), query)
+	res, err := s.Searcher.SearchCaptions(ctx, os.Getenv("CAPTIONS_INDEX"), params)
 
+	var syntaxErr *searcher.QuerySyntaxError
+	if errors.As(err, &syntaxErr) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "position": syntaxErr.Pos})
+		return
+	}
+	if errors.Is(err, searcher.ErrInvalidSearch) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, searcher.ErrSearchUnavailable) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		log.Printf("query failed %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "search failed"})
 		return
 	}
 
@@ -121,44 +242,296 @@ func ingestVideoHandler(c *gin.Context, appServices *app.ApplicationServices) {
 		c.JSON(400, gin.H{"error": "could not read body"})
 		return
 	}
-	url := string(body)
+	url := strings.TrimSpace(string(body))
+	if url == "" {
+		c.JSON(400, gin.H{"error": "video url is required"})
+		return
+	}
+
+	// Languages come from ?lang=en&lang=fr or ?lang=en,fr, use ?lang=all for every available language
+	job, err := appServices.Jobs.Enqueue(jobs.Request{Url: url, Languages: queryList(c, "lang")})
+	if errors.Is(err, jobs.ErrQueueFull) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to enqueue ingestion job: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to enqueue job"})
+		return
+	}
+
+	statusUrl := "/v1/jobs/" + job.Id
+	c.Header("Location", statusUrl)
+	c.JSON(http.StatusAccepted, gin.H{"job_id": job.Id, "status_url": statusUrl})
+}
+
+func jobStatusHandler(c *gin.Context, appServices *app.ApplicationServices) {
+	job, ok := appServices.Jobs.Get(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
 
-	// Note metadata's CaptionPath refers to the to-be generated json file
-	// TODO: Add context to fetcher functions
-	meta, err := appServices.Fetcher.GetMetadata(url, os.Getenv("JSON_CAPTIONS_DIR"))
+func listVideosHandler(c *gin.Context, appServices *app.ApplicationServices) {
+	page, err := queryInt(c, "page")
 	if err != nil {
-		log.Fatalf("Failed to get video metadata: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
+	size, err := queryInt(c, "size")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// ?sort=title or ?sort=ingested_at, with ?order=asc or ?order=desc
+	q := storage.VideoQuery{Sort: c.Query("sort"), Order: c.Query("order"), Page: page, Size: size}
 
-	vttCaptionsDir := os.Getenv("VTT_CAPTIONS_DIR")
-	vttCaptionsFile, err := appServices.Fetcher.DownloadCaptions(meta.VideoId, url, vttCaptionsDir)
+	res, err := appServices.Repo.QueryVideos(c.Request.Context(), q)
+	if errors.Is(err, storage.ErrInvalidVideoQuery) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
-		log.Printf("Failed to download captions: %v", err)
+		log.Printf("Failed to list videos: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list videos"})
 		return
 	}
 
-	err = appServices.Converter.ConvertVTTToJSON(vttCaptionsFile, meta.CaptionPath)
+	c.JSON(http.StatusOK, res)
+}
+
+func getVideoHandler(c *gin.Context, appServices *app.ApplicationServices) {
+	video, err := appServices.Repo.GetVideoDetails(c.Request.Context(), c.Param("id"))
+	if errors.Is(err, storage.ErrVideoNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
-		log.Printf("Failed to convert VTT file to JSON: %s", err)
+		log.Printf("Failed to get video %s: %v", c.Param("id"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get video"})
 		return
 	}
 
-	captions, err := appServices.Parser.ParseJSON(meta.CaptionPath)
+	c.JSON(http.StatusOK, video)
+}
+
+func videoCaptionsHandler(c *gin.Context, appServices *app.ApplicationServices) {
+	window, err := queryWindow(c)
 	if err != nil {
-		log.Printf("Failed to Parse JSON captions: %s", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	ctx := c.Request.Context()
-	err = appServices.Loader.LoadCaptions(ctx, meta, captions)
+	captions, err := appServices.Repo.GetCaptionWindow(c.Request.Context(), c.Param("id"), window)
+	if errors.Is(err, storage.ErrInvalidVideoQuery) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, storage.ErrVideoNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to get captions of video %s: %v", c.Param("id"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get captions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"video_id": c.Param("id"), "from": window.From, "to": window.To, "captions": captions})
+}
+
+func transcriptHandler(c *gin.Context, appServices *app.ApplicationServices) {
+	format := c.DefaultQuery("format", "vtt")
+	writer, ok := transcript.DefaultRegistry().ByName(format)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("format must be one of %s", strings.Join(transcript.DefaultRegistry().Names(), ", "))})
+		return
+	}
+	window, err := queryWindow(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// ?timestamps=true prefixes lines with their start time, ?paragraphs=true merges cues into paragraphs
+	opts := transcript.Options{
+		Timestamps: c.Query("timestamps") == "true",
+		Paragraphs: c.Query("paragraphs") == "true",
+	}
+
+	t, err := appServices.Transcript(c.Request.Context(), c.Param("id"), window)
+	if errors.Is(err, storage.ErrInvalidVideoQuery) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, storage.ErrVideoNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to get transcript of video %s: %v", c.Param("id"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get transcript"})
+		return
+	}
+
+	// Render first so a failure can still be reported as an error
+	var buf bytes.Buffer
+	if err := writer.Write(&buf, t, opts); err != nil {
+		log.Printf("Failed to write %s transcript of video %s: %v", format, t.VideoId, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to write transcript"})
+		return
+	}
+
+	filename := t.VideoId + "." + t.Language + writer.Extension()
+	c.Header("Content-Disposition", fmt.Sprintf("inline; filename=%q", filename))
+	c.Data(http.StatusOK, writer.ContentType(), buf.Bytes())
+}
+
+func deleteVideoHandler(c *gin.Context, appServices *app.ApplicationServices) {
+	// ?dry_run=true lists what would be removed without removing it
+	dryRun := c.Query("dry_run") == "true"
+
+	deletion, err := appServices.DeleteVideo(c.Request.Context(), c.Param("id"), dryRun)
+	if errors.Is(err, app.ErrInvalidVideoId) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, storage.ErrVideoNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
-		log.Printf("Failed to load captions to db: %s", err)
+		log.Printf("Failed to delete video %s: %v", c.Param("id"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete video"})
+		return
+	}
+
+	c.JSON(http.StatusOK, deletion)
+}
+
+func startReindexHandler(c *gin.Context, appServices *app.ApplicationServices) {
+	if appServices.Reindexer == nil {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "the search backend does not support reindexing"})
+		return
+	}
+
+	// ?delete_old=true drops the previous index once the alias has moved
+	deleteOld := c.Query("delete_old") == "true"
+
+	status, err := appServices.Reindexer.Start(os.Getenv("CAPTIONS_INDEX"), deleteOld)
+	if errors.Is(err, searcher.ErrReindexRunning) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "reindex": status})
 		return
 	}
 
-	err = appServices.Searcher.IndexCaptions(ctx, meta, captions)
+	c.Header("Location", "/v1/admin/reindex")
+	c.JSON(http.StatusAccepted, status)
+}
+
+func reindexStatusHandler(c *gin.Context, appServices *app.ApplicationServices) {
+	if appServices.Reindexer == nil {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "the search backend does not support reindexing"})
+		return
+	}
+
+	status, ok := appServices.Reindexer.Status()
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no reindex has been started"})
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+func startRebuildHandler(c *gin.Context, appServices *app.ApplicationServices) {
+	// ?fresh=true ignores the checkpoint of an earlier, unfinished rebuild
+	fresh := c.Query("fresh") == "true"
+
+	status, err := appServices.Rebuilder.Start(fresh)
+	if errors.Is(err, app.ErrRebuildRunning) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "rebuild": status})
+		return
+	}
+
+	c.Header("Location", "/v1/admin/rebuild")
+	c.JSON(http.StatusAccepted, status)
+}
+
+func rebuildStatusHandler(c *gin.Context, appServices *app.ApplicationServices) {
+	status, ok := appServices.Rebuilder.Status()
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no rebuild has been started"})
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+func reconcileHandler(c *gin.Context, appServices *app.ApplicationServices, repair bool) {
+	report, err := appServices.Reconciler.Reconcile(c.Request.Context(), repair)
 	if err != nil {
-		log.Printf("Failed to index captions to Elastic Search: %s", err)
+		log.Printf("Reconcile failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "reconcile failed"})
 		return
 	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// queryInt reads an optional integer query parameter, returning 0 when it is absent
+func queryInt(c *gin.Context, key string) (int, error) {
+	raw := c.Query(key)
+	if raw == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be a number", key)
+	}
+	return n, nil
+}
+
+// queryMillis reads an optional millisecond query parameter, returning 0 when it is absent. Values
+// that don't fit a TimeMs are rejected rather than wrapped.
+func queryMillis(c *gin.Context, key string) (uint32, error) {
+	raw := c.Query(key)
+	if raw == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseUint(raw, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be a number of milliseconds from 0 to %d", key, uint32(math.MaxUint32))
+	}
+	return uint32(n), nil
+}
+
+// queryWindow reads the from and to milliseconds and the lang of a caption time window
+func queryWindow(c *gin.Context) (storage.CaptionWindow, error) {
+	from, err := queryMillis(c, "from")
+	if err != nil {
+		return storage.CaptionWindow{}, err
+	}
+	to, err := queryMillis(c, "to")
+	if err != nil {
+		return storage.CaptionWindow{}, err
+	}
+	return storage.CaptionWindow{From: storage.TimeMs(from), To: storage.TimeMs(to), Language: c.Query("lang")}, nil
+}
+
+// queryList collects a query parameter that may be repeated and/or comma separated
+func queryList(c *gin.Context, key string) []string {
+	var values []string
+	for _, raw := range c.QueryArray(key) {
+		for _, v := range strings.Split(raw, ",") {
+			v = strings.TrimSpace(v)
+			if v != "" {
+				values = append(values, v)
+			}
+		}
+	}
+	return values
 }
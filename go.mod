@@ -3,8 +3,10 @@ module banditsecret
 go 1.24.2
 
 require (
+	github.com/blevesearch/go-porterstemmer v1.0.3
 	github.com/elastic/go-elasticsearch/v9 v9.0.0
 	github.com/go-sql-driver/mysql v1.9.2
+	github.com/mattn/go-sqlite3 v1.14.33
 )
 
 require (
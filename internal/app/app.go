@@ -1,6 +1,8 @@
 package app
 
 import (
+	"banditsecret/internal/jobs"
+	"banditsecret/internal/normalizer"
 	"banditsecret/internal/parser"
 	"banditsecret/internal/pkg/captionconverter"
 	"banditsecret/internal/pkg/cmdutil"
@@ -8,28 +10,45 @@ import (
 	searcher "banditsecret/internal/search"
 	"banditsecret/internal/storage"
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"strconv"
 	"time"
 )
 
 type CaptionRepository = storage.CaptionRepository
 type CaptionSearchRepository = searcher.CaptionSearchRepository
+type CaptionMetadata = ytdlp.CaptionMetadata
+type CaptionEntry = parser.CaptionEntry
+
+const (
+	defaultIngestWorkers   = 2
+	defaultIngestQueueSize = 100
+	ingestJobTimeout       = 10 * time.Minute
+)
 
 type ApplicationServices struct {
-	Fetcher   ytdlp.YTFetcher
-	Converter captionconverter.Converter
-	Parser    parser.Parser
-	Loader    storage.Loader
-	Searcher  searcher.Searcher
+	Fetcher    ytdlp.YTFetcher
+	Converter  captionconverter.Converter
+	Parser     parser.Parser
+	Normalizer normalizer.Normalizer
+	Loader     storage.Loader
+	Repo       CaptionRepository
+	Searcher   searcher.Searcher
+	Jobs       *jobs.Queue
+	// Reindexer is nil when the search backend has no index to rebuild
+	Reindexer  *searcher.Reindexer
+	Rebuilder  *Rebuilder
+	Reconciler *Reconciler
+	Outbox     *OutboxDispatcher
 }
 
 func NewApplicationServices(cr CaptionRepository, csr CaptionSearchRepository) (*ApplicationServices, error) {
 
 	// Get project root using executable location (banditsecret/bin/)
-	// TODO: Containerize so we don't need to rely on PYTHON_LOC in venv
 	// TODO: Use yt-dlp docker container rather than relying on YTDLP_EXECUTABLE
 	exePath, err := os.Executable()
 	if err != nil {
@@ -38,24 +57,23 @@ func NewApplicationServices(cr CaptionRepository, csr CaptionSearchRepository) (
 	projectRoot := filepath.Dir(exePath)
 	log.Println(projectRoot)
 
-	// TODO: refactor, we don't need to pass this data in anymore, and we don't need projectRoot
-	pythonExecutable := os.Getenv("PYTHON_LOC")
-	converterScriptPath := os.Getenv("CONVERTER_SCRIPT_PATH")
-
+	// TODO: refactor, we don't need projectRoot
 	// Initialize all services
 	cmdRunner := cmdutil.NewDefaultCmdRunner()
 
-	fetchYTService, err := ytdlp.NewFetchYTService(os.Getenv("YTDLP_EXECUTABLE"), cmdRunner)
+	fetchYTService, err := ytdlp.NewFetchYTService(os.Getenv("YTDLP_EXECUTABLE"), parser.DefaultRegistry().Extensions(), cmdRunner)
 	if err != nil {
 		return nil, fmt.Errorf("NewFetchYTService failed: %w", err)
 	}
 
-	converterService, err := captionconverter.NewConverterService(pythonExecutable, converterScriptPath, cmdRunner)
+	parserService := parser.NewParserService()
+
+	converterService, err := captionconverter.NewConverterService(parserService)
 	if err != nil {
 		return nil, fmt.Errorf("NewConverterService failed: %w", err)
 	}
 
-	parserService := parser.NewParserService()
+	normalizerService := normalizer.NewNormalizerService()
 	loaderService := storage.NewLoaderService(cr)
 	searcherService := searcher.NewSearcherService(csr)
 
@@ -63,13 +81,67 @@ func NewApplicationServices(cr CaptionRepository, csr CaptionSearchRepository) (
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	searcherService.CreateIndex(ctx, os.Getenv("CAPTIONS_INDEX"))
+	mappingErr := searcherService.CreateIndex(ctx, os.Getenv("CAPTIONS_INDEX"))
+	if mappingErr != nil && !errors.Is(mappingErr, searcher.ErrMappingMismatch) {
+		return nil, fmt.Errorf("CreateIndex failed: %w", mappingErr)
+	}
+
+	appServices := &ApplicationServices{
+		Fetcher:    fetchYTService,
+		Converter:  converterService,
+		Parser:     parserService,
+		Normalizer: normalizerService,
+		Loader:     loaderService,
+		Repo:       cr,
+		Searcher:   searcherService,
+		Rebuilder:  NewRebuilder(cr, searcherService, os.Getenv("CAPTIONS_INDEX"), getEnvInt("REBUILD_BATCH_SIZE", defaultRebuildBatchSize)),
+		Reconciler: NewReconciler(cr, searcherService, os.Getenv("CAPTIONS_INDEX"), getEnvInt("REBUILD_BATCH_SIZE", defaultRebuildBatchSize)),
+		Outbox:     NewOutboxDispatcher(cr, searcherService, os.Getenv("CAPTIONS_INDEX")),
+	}
 
-	return &ApplicationServices{
-		Fetcher:   fetchYTService,
-		Converter: converterService,
-		Parser:    parserService,
-		Loader:    loaderService,
-		Searcher:  searcherService,
-	}, nil
+	if rb, ok := csr.(searcher.IndexRebuilder); ok {
+		appServices.Reindexer = searcher.NewReindexer(rb, searcherService.Writes(), appServices.Outbox.indexVideo)
+	}
+
+	// Searches sort and match on fields an index with an older mapping lacks, so it is reindexed onto
+	// the current mapping straight away
+	if mappingErr != nil {
+		if appServices.Reindexer == nil {
+			return nil, fmt.Errorf("CreateIndex failed: %w", mappingErr)
+		}
+		log.Printf("%v, reindexing onto the current mapping", mappingErr)
+		if _, err := appServices.Reindexer.Start(os.Getenv("CAPTIONS_INDEX"), false); err != nil {
+			return nil, fmt.Errorf("failed to start reindex: %w", err)
+		}
+	}
+
+	// Captions committed to the database reach the search index through the outbox
+	appServices.Outbox.Start(context.Background())
+
+	// Ingestion jobs run in the background on a bounded pool of workers
+	workers := getEnvInt("INGEST_WORKERS", defaultIngestWorkers)
+	queueSize := getEnvInt("INGEST_QUEUE_SIZE", defaultIngestQueueSize)
+
+	jobQueue, err := jobs.NewQueue(workers, queueSize, ingestJobTimeout, appServices.ingestVideo)
+	if err != nil {
+		return nil, fmt.Errorf("NewQueue failed: %w", err)
+	}
+	jobQueue.Start(context.Background())
+	appServices.Jobs = jobQueue
+
+	return appServices, nil
+}
+
+// getEnvInt reads an integer env variable, falling back to def if it is unset or invalid
+func getEnvInt(key string, def int) int {
+	val := os.Getenv(key)
+	if val == "" {
+		return def
+	}
+	n, err := strconv.Atoi(val)
+	if err != nil {
+		log.Printf("Invalid value %q for %s, using default %d", val, key, def)
+		return def
+	}
+	return n
 }
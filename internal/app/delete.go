@@ -0,0 +1,122 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"banditsecret/internal/storage"
+)
+
+// ErrInvalidVideoId is returned for ids that can't be YouTube video ids
+var ErrInvalidVideoId = errors.New("invalid video id")
+
+// videoIdPattern also keeps glob and path characters out of the cache file lookup
+var videoIdPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// VideoDeletion lists what deleting a video removed, or would remove in a dry run
+type VideoDeletion struct {
+	VideoId string `json:"video_id"`
+	DryRun  bool   `json:"dry_run"`
+	// Video is whether the database had the video
+	Video           bool     `json:"video"`
+	Captions        int64    `json:"captions"`
+	Words           int64    `json:"words"`
+	SearchDocuments int64    `json:"search_documents"`
+	Files           []string `json:"files"`
+	// SearchPending is set when the index couldn't be updated, the outbox retries it in the background
+	SearchPending bool `json:"search_pending,omitempty"`
+}
+
+// DeleteVideo removes a video from the database, the search index and the caption file caches.
+// With dryRun set nothing is removed and the deletion lists what would be. Returns
+// storage.ErrVideoNotFound if none of the stores know the video.
+func (s *ApplicationServices) DeleteVideo(ctx context.Context, videoId string, dryRun bool) (*VideoDeletion, error) {
+
+	if !videoIdPattern.MatchString(videoId) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidVideoId, videoId)
+	}
+
+	deletion := &VideoDeletion{VideoId: videoId, DryRun: dryRun, Files: []string{}}
+
+	// The database goes first, it is the source of truth for everything else
+	deleted, err := s.Repo.DeleteVideo(ctx, videoId, dryRun)
+	if err != nil && !errors.Is(err, storage.ErrVideoNotFound) {
+		return nil, err
+	}
+	if err == nil {
+		deletion.Video = true
+		deletion.Captions = deleted.Captions
+		deletion.Words = deleted.Words
+	}
+
+	if err := s.deleteSearchDocuments(ctx, deletion); err != nil {
+		return nil, err
+	}
+
+	files, err := cachedCaptionFiles(videoId, os.Getenv("VTT_CAPTIONS_DIR"), os.Getenv("JSON_CAPTIONS_DIR"))
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range files {
+		if !dryRun {
+			if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return nil, fmt.Errorf("failed to remove caption file %s: %w", path, err)
+			}
+		}
+		deletion.Files = append(deletion.Files, path)
+	}
+
+	if !deletion.Video && deletion.SearchDocuments == 0 && len(deletion.Files) == 0 {
+		return nil, fmt.Errorf("%w: %s", storage.ErrVideoNotFound, videoId)
+	}
+	return deletion, nil
+}
+
+// deleteSearchDocuments removes the video's documents from the search index, or counts them in a dry run
+func (s *ApplicationServices) deleteSearchDocuments(ctx context.Context, deletion *VideoDeletion) error {
+
+	index := os.Getenv("CAPTIONS_INDEX")
+
+	if deletion.DryRun {
+		docs, err := s.Searcher.GetVideoCaptions(ctx, index, deletion.VideoId)
+		if err != nil {
+			return err
+		}
+		deletion.SearchDocuments = int64(len(docs))
+		return nil
+	}
+
+	n, err := s.Searcher.DeleteVideo(ctx, index, deletion.VideoId)
+	if err == nil {
+		deletion.SearchDocuments = n
+		return nil
+	}
+	// A deleted video was queued in the outbox with the deletion, which retries it later
+	if deletion.Video {
+		log.Printf("Failed to delete video %s from the search index, leaving it to the outbox: %v", deletion.VideoId, err)
+		deletion.SearchPending = true
+		return nil
+	}
+	return err
+}
+
+// cachedCaptionFiles returns the <videoId>.* caption files kept in each of dirs
+func cachedCaptionFiles(videoId string, dirs ...string) ([]string, error) {
+	var files []string
+	for _, dir := range dirs {
+		if dir == "" {
+			continue
+		}
+		matches, err := filepath.Glob(dir + videoId + ".*")
+		if err != nil {
+			return nil, fmt.Errorf("failed to list caption files of video %s: %w", videoId, err)
+		}
+		files = append(files, matches...)
+	}
+	return files, nil
+}
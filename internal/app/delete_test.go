@@ -0,0 +1,82 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"banditsecret/internal/storage"
+)
+
+// writeCaptionFiles creates empty cache files in dir and returns their paths
+func writeCaptionFiles(t *testing.T, dir string, names ...string) []string {
+	var paths []string
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatalf("failed to write %s: %v", path, err)
+		}
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+func TestDeleteVideo(t *testing.T) {
+
+	vttDir, jsonDir := t.TempDir()+"/", t.TempDir()+"/"
+	t.Setenv("VTT_CAPTIONS_DIR", vttDir)
+	t.Setenv("JSON_CAPTIONS_DIR", jsonDir)
+
+	vtt := writeCaptionFiles(t, vttDir, "a.en.vtt", "ab.en.vtt")
+	json := writeCaptionFiles(t, jsonDir, "a.en.json")
+
+	repo := newFakeCaptionRepo()
+	search := &fakeSearcher{docs: map[string][]CaptionEntry{
+		"a": {{VideoId: "a", Text: "one"}, {VideoId: "a", Text: "two"}},
+	}}
+	s := &ApplicationServices{Repo: repo, Searcher: search}
+
+	// A dry run reports everything but leaves it in place
+	plan, err := s.DeleteVideo(context.Background(), "a", true)
+	if err != nil {
+		t.Fatalf("dry run failed: %v", err)
+	}
+	if !plan.Video || plan.Captions != 1 || plan.SearchDocuments != 2 || len(plan.Files) != 2 {
+		t.Fatalf("unexpected dry run %+v", plan)
+	}
+	if _, err := repo.GetVideo(context.Background(), "a"); err != nil || len(search.docs["a"]) != 2 {
+		t.Fatalf("dry run removed the video")
+	}
+
+	deletion, err := s.DeleteVideo(context.Background(), "a", false)
+	if err != nil {
+		t.Fatalf("DeleteVideo failed: %v", err)
+	}
+	if deletion.Captions != 1 || deletion.SearchDocuments != 2 || len(deletion.Files) != 2 {
+		t.Fatalf("unexpected deletion %+v", deletion)
+	}
+	if _, err := repo.GetVideo(context.Background(), "a"); !errors.Is(err, storage.ErrVideoNotFound) {
+		t.Fatalf("expected the video to be removed from the database, got %v", err)
+	}
+	if _, ok := search.docs["a"]; ok {
+		t.Fatalf("expected the video to be removed from the index")
+	}
+	for _, path := range []string{vtt[0], json[0]} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Fatalf("expected %s to be removed", path)
+		}
+	}
+	// Only files of exactly this video go
+	if _, err := os.Stat(vtt[1]); err != nil {
+		t.Fatalf("expected %s to be kept: %v", vtt[1], err)
+	}
+
+	if _, err := s.DeleteVideo(context.Background(), "a", false); !errors.Is(err, storage.ErrVideoNotFound) {
+		t.Fatalf("expected ErrVideoNotFound deleting again, got %v", err)
+	}
+	if _, err := s.DeleteVideo(context.Background(), "../a", true); !errors.Is(err, ErrInvalidVideoId) {
+		t.Fatalf("expected ErrInvalidVideoId, got %v", err)
+	}
+}
@@ -0,0 +1,217 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	searcher "banditsecret/internal/search"
+	"banditsecret/internal/storage"
+)
+
+// fakeCaptionRepo keeps videos, captions, checkpoints and the search outbox in memory
+type fakeCaptionRepo struct {
+	videos      []CaptionMetadata
+	captions    map[string][]CaptionEntry
+	checkpoints map[string]string
+	outbox      []storage.OutboxEntry
+	dead        map[int64]bool
+	// failOn makes GetCaptions fail for this video id
+	failOn string
+}
+
+func (f *fakeCaptionRepo) SaveCaptions(ctx context.Context, meta *CaptionMetadata, captions []CaptionEntry) error {
+	if _, err := f.GetVideo(ctx, meta.VideoId); err != nil {
+		f.videos = append(f.videos, *meta)
+	}
+	f.captions[meta.VideoId] = captions
+	f.outbox = append(f.outbox, storage.OutboxEntry{Id: int64(len(f.outbox) + 1), VideoId: meta.VideoId})
+	return nil
+}
+
+func (f *fakeCaptionRepo) GetVideo(ctx context.Context, videoId string) (*CaptionMetadata, error) {
+	for _, v := range f.videos {
+		if v.VideoId == videoId {
+			return &v, nil
+		}
+	}
+	return nil, storage.ErrVideoNotFound
+}
+
+// ClaimOutbox ignores the lease and retry times, every live entry is always due
+func (f *fakeCaptionRepo) ClaimOutbox(ctx context.Context, videoId string, limit int, lease time.Duration) ([]storage.OutboxEntry, error) {
+	var due []storage.OutboxEntry
+	for _, entry := range f.outbox {
+		if !f.dead[entry.Id] && (videoId == "" || entry.VideoId == videoId) && len(due) < limit {
+			due = append(due, entry)
+		}
+	}
+	return due, nil
+}
+
+func (f *fakeCaptionRepo) AckOutbox(ctx context.Context, id int64) error {
+	for i, entry := range f.outbox {
+		if entry.Id == id {
+			f.outbox = append(f.outbox[:i], f.outbox[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+func (f *fakeCaptionRepo) FailOutbox(ctx context.Context, id int64, reason string, retryIn time.Duration, dead bool) error {
+	for i := range f.outbox {
+		if f.outbox[i].Id == id {
+			f.outbox[i].Attempts++
+		}
+	}
+	if dead {
+		f.dead[id] = true
+	}
+	return nil
+}
+
+func (f *fakeCaptionRepo) DeleteVideo(ctx context.Context, videoId string, dryRun bool) (*storage.DeletedVideo, error) {
+	for i, v := range f.videos {
+		if v.VideoId != videoId {
+			continue
+		}
+		deleted := &storage.DeletedVideo{Captions: int64(len(f.captions[videoId]))}
+		for _, c := range f.captions[videoId] {
+			deleted.Words += int64(len(c.Words))
+		}
+		if !dryRun {
+			f.videos = append(f.videos[:i], f.videos[i+1:]...)
+			delete(f.captions, videoId)
+			f.outbox = append(f.outbox, storage.OutboxEntry{Id: int64(len(f.outbox) + 1), VideoId: videoId})
+		}
+		return deleted, nil
+	}
+	return nil, storage.ErrVideoNotFound
+}
+
+func (f *fakeCaptionRepo) QueryVideos(ctx context.Context, q storage.VideoQuery) (*storage.VideoPage, error) {
+	page := &storage.VideoPage{Total: len(f.videos)}
+	for _, v := range f.videos {
+		page.Videos = append(page.Videos, storage.Video{VideoId: v.VideoId, Title: v.VideoTitle, Url: v.Url})
+	}
+	return page, nil
+}
+
+func (f *fakeCaptionRepo) GetVideoDetails(ctx context.Context, videoId string) (*storage.Video, error) {
+	meta, err := f.GetVideo(ctx, videoId)
+	if err != nil {
+		return nil, err
+	}
+	return &storage.Video{VideoId: meta.VideoId, Title: meta.VideoTitle, Url: meta.Url}, nil
+}
+
+func (f *fakeCaptionRepo) GetCaptionWindow(ctx context.Context, videoId string, window storage.CaptionWindow) ([]CaptionEntry, error) {
+	if _, err := f.GetVideo(ctx, videoId); err != nil {
+		return nil, err
+	}
+	var captions []CaptionEntry
+	for _, c := range f.captions[videoId] {
+		if c.End > window.From && (window.To == 0 || c.Start < window.To) {
+			captions = append(captions, c)
+		}
+	}
+	return captions, nil
+}
+
+func (f *fakeCaptionRepo) ListVideos(ctx context.Context, afterId string, limit int) ([]CaptionMetadata, error) {
+	var out []CaptionMetadata
+	for _, v := range f.videos {
+		if v.VideoId > afterId && len(out) < limit {
+			out = append(out, v)
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeCaptionRepo) GetCaptions(ctx context.Context, videoId string) ([]CaptionEntry, error) {
+	if videoId == f.failOn {
+		return nil, errors.New("database went away")
+	}
+	return f.captions[videoId], nil
+}
+
+func (f *fakeCaptionRepo) LoadCheckpoint(ctx context.Context, name string) (string, error) {
+	return f.checkpoints[name], nil
+}
+
+func (f *fakeCaptionRepo) SaveCheckpoint(ctx context.Context, name string, videoId string) error {
+	f.checkpoints[name] = videoId
+	return nil
+}
+
+// fakeSearcher keeps indexed captions in memory, keyed by video id
+type fakeSearcher struct {
+	indexed []string
+	docs    map[string][]CaptionEntry
+	// fail makes IndexCaptions return this error
+	fail error
+}
+
+func (f *fakeSearcher) CreateIndex(ctx context.Context, index string) error {
+	return nil
+}
+
+func (f *fakeSearcher) IndexCaptions(ctx context.Context, meta *CaptionMetadata, captions []CaptionEntry) error {
+	if f.fail != nil {
+		return f.fail
+	}
+	f.indexed = append(f.indexed, meta.VideoId)
+	if f.docs == nil {
+		f.docs = make(map[string][]CaptionEntry)
+	}
+	f.docs[meta.VideoId] = append(f.docs[meta.VideoId], captions...)
+	return nil
+}
+
+func (f *fakeSearcher) SearchCaptions(ctx context.Context, index string, params searcher.SearchParams) (*searcher.SearchResult, error) {
+	return &searcher.SearchResult{}, nil
+}
+
+func (f *fakeSearcher) ListVideoIds(ctx context.Context, index string, afterId string, limit int) ([]string, error) {
+	var ids []string
+	for id := range f.docs {
+		if id > afterId {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+	return ids, nil
+}
+
+func (f *fakeSearcher) GetVideoCaptions(ctx context.Context, index string, videoId string) ([]CaptionEntry, error) {
+	return f.docs[videoId], nil
+}
+
+func (f *fakeSearcher) DeleteVideo(ctx context.Context, index string, videoId string) (int64, error) {
+	n := int64(len(f.docs[videoId]))
+	delete(f.docs, videoId)
+	return n, nil
+}
+
+func newFakeCaptionRepo() *fakeCaptionRepo {
+	repo := &fakeCaptionRepo{
+		captions:    make(map[string][]CaptionEntry),
+		checkpoints: make(map[string]string),
+		dead:        make(map[int64]bool),
+	}
+	for _, id := range []string{"a", "b", "c", "d", "e"} {
+		repo.videos = append(repo.videos, CaptionMetadata{VideoId: id})
+		repo.captions[id] = []CaptionEntry{{VideoId: id, Start: 0, End: 1000, Text: "caption " + id}}
+	}
+	sort.Slice(repo.videos, func(i, j int) bool { return repo.videos[i].VideoId < repo.videos[j].VideoId })
+	return repo
+}
+
+func repoOutboxEntry(id int64, videoId string) storage.OutboxEntry {
+	return storage.OutboxEntry{Id: id, VideoId: videoId}
+}
@@ -0,0 +1,94 @@
+package app
+
+import (
+	"banditsecret/internal/jobs"
+	"banditsecret/internal/normalizer"
+	"banditsecret/internal/pkg/ytdlp"
+	"context"
+	"log"
+	"os"
+)
+
+// ingestVideo runs the full ingestion pipeline for a single job
+func (s *ApplicationServices) ingestVideo(ctx context.Context, t *jobs.Tracker) error {
+
+	req := t.Request()
+
+	var meta *CaptionMetadata
+	var captionFiles []ytdlp.CaptionFile
+	err := t.Run(jobs.StageFetching, func() error {
+		var err error
+		meta, err = s.Fetcher.GetMetadata(req.Url)
+		if err != nil {
+			return err
+		}
+		captionFiles, err = s.Fetcher.DownloadCaptions(meta.VideoId, req.Url, os.Getenv("VTT_CAPTIONS_DIR"), req.Languages)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	// The JSON copy of the captions is only kept as an optional cache
+	jsonCaptionsDir := os.Getenv("JSON_CAPTIONS_DIR")
+	if jsonCaptionsDir != "" {
+		err = t.Run(jobs.StageConverting, func() error {
+			for _, file := range captionFiles {
+				jsonPath := jsonCaptionsDir + meta.VideoId + "." + file.Language + ".json"
+				err := s.Converter.ConvertToJSON(file.Path, jsonPath)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	} else {
+		t.Skip(jobs.StageConverting)
+	}
+
+	var captions []CaptionEntry
+	err = t.Run(jobs.StageParsing, func() error {
+		for _, file := range captionFiles {
+			entries, err := s.Parser.ParseFile(file.Path, meta.VideoId)
+			if err != nil {
+				return err
+			}
+			for i := range entries {
+				entries[i].Language = file.Language
+			}
+			captions = append(captions, entries...)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	err = t.Run(jobs.StageNormalizing, func() error {
+		var stats normalizer.Stats
+		captions, stats = s.Normalizer.Normalize(captions)
+		log.Printf("Normalized %d cues into %d segments for video %s (%d collapsed)", stats.Input, stats.Output, meta.VideoId, stats.Collapsed)
+		t.Count("cues_parsed", stats.Input)
+		t.Count("cues_collapsed", stats.Collapsed)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	err = t.Run(jobs.StageLoading, func() error {
+		return s.Loader.LoadCaptions(ctx, meta, captions)
+	})
+	if err != nil {
+		return err
+	}
+
+	// Loading queued the video in the search outbox, index it now rather than waiting for the
+	// dispatcher. If this fails the outbox keeps retrying it in the background.
+	return t.Run(jobs.StageIndexing, func() error {
+		return s.Outbox.Dispatch(ctx, meta.VideoId)
+	})
+}
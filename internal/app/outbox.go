@@ -0,0 +1,167 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"time"
+
+	searcher "banditsecret/internal/search"
+	"banditsecret/internal/storage"
+)
+
+const (
+	outboxPollInterval = 5 * time.Second
+	outboxBatchSize    = 20
+	// outboxLease is how long a claimed entry is left alone before another dispatcher may retry it
+	outboxLease = 2 * time.Minute
+	// outboxMaxAttempts is how often an entry is tried before it is marked dead
+	outboxMaxAttempts = 10
+	outboxBaseDelay   = 2 * time.Second
+	outboxMaxDelay    = 10 * time.Minute
+)
+
+// OutboxDispatcher drains the search outbox, writing each queued video's captions from the
+// database into the search index. Failed entries are retried with exponential backoff, and
+// entries that keep failing are marked dead rather than blocking the rest of the outbox.
+type OutboxDispatcher struct {
+	repo     CaptionRepository
+	searcher searcher.Searcher
+	index    string
+	wake     chan struct{}
+}
+
+func NewOutboxDispatcher(repo CaptionRepository, searcher searcher.Searcher, index string) *OutboxDispatcher {
+	return &OutboxDispatcher{
+		repo:     repo,
+		searcher: searcher,
+		index:    index,
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// Start drains the outbox in the background until ctx is cancelled
+func (d *OutboxDispatcher) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(outboxPollInterval)
+		defer ticker.Stop()
+
+		for {
+			d.drain(ctx)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-d.wake:
+			}
+		}
+	}()
+}
+
+// Notify wakes the dispatcher without waiting for the next poll
+func (d *OutboxDispatcher) Notify() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Dispatch indexes the due outbox entries of one video right away, returning the first failure.
+// A failed entry stays in the outbox and is retried in the background.
+func (d *OutboxDispatcher) Dispatch(ctx context.Context, videoId string) error {
+	entries, err := d.repo.ClaimOutbox(ctx, videoId, outboxBatchSize, outboxLease)
+	if err != nil {
+		return err
+	}
+
+	var firstErr error
+	for _, entry := range entries {
+		if err := d.process(ctx, entry); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// drain processes due entries until none are left
+func (d *OutboxDispatcher) drain(ctx context.Context) {
+	for ctx.Err() == nil {
+		entries, err := d.repo.ClaimOutbox(ctx, "", outboxBatchSize, outboxLease)
+		if err != nil {
+			log.Printf("Failed to read search outbox: %v", err)
+			return
+		}
+		if len(entries) == 0 {
+			return
+		}
+
+		for _, entry := range entries {
+			d.process(ctx, entry)
+		}
+	}
+}
+
+// process indexes one entry and records the outcome in the outbox
+func (d *OutboxDispatcher) process(ctx context.Context, entry storage.OutboxEntry) error {
+
+	err := d.indexVideo(ctx, entry.VideoId)
+	if err == nil {
+		return d.repo.AckOutbox(ctx, entry.Id)
+	}
+
+	attempts := entry.Attempts + 1
+	dead := attempts >= outboxMaxAttempts
+	if dead {
+		log.Printf("ERROR: giving up indexing video %s after %d attempts, outbox entry %d is dead: %v", entry.VideoId, attempts, entry.Id, err)
+	} else {
+		log.Printf("Failed to index video %s (attempt %d), will retry: %v", entry.VideoId, attempts, err)
+	}
+
+	if ferr := d.repo.FailOutbox(ctx, entry.Id, err.Error(), retryDelay(attempts), dead); ferr != nil {
+		log.Printf("%v", ferr)
+	}
+	return err
+}
+
+// indexVideo replaces a video's documents in the search index with its current captions in the
+// database. The entry only says which video changed, so a video that has since been deleted is
+// removed from the index and entries queued in any order converge on the latest state.
+func (d *OutboxDispatcher) indexVideo(ctx context.Context, videoId string) error {
+
+	meta, err := d.repo.GetVideo(ctx, videoId)
+	if errors.Is(err, storage.ErrVideoNotFound) {
+		_, err = d.searcher.DeleteVideo(ctx, d.index, videoId)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	captions, err := d.repo.GetCaptions(ctx, videoId)
+	if err != nil {
+		return err
+	}
+
+	if _, err := d.searcher.DeleteVideo(ctx, d.index, videoId); err != nil {
+		return err
+	}
+	if len(captions) == 0 {
+		return nil
+	}
+	if err := d.searcher.IndexCaptions(ctx, meta, captions); err != nil {
+		return fmt.Errorf("failed to index captions of video %s: %w", videoId, err)
+	}
+	return nil
+}
+
+// retryDelay backs off exponentially with the number of attempts, with up to 20% jitter
+func retryDelay(attempts int) time.Duration {
+	delay := outboxBaseDelay << min(attempts-1, 20)
+	if delay > outboxMaxDelay || delay <= 0 {
+		delay = outboxMaxDelay
+	}
+	return delay - time.Duration(rand.Int64N(int64(delay)/5+1))
+}
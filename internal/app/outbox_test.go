@@ -0,0 +1,93 @@
+package app
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestOutboxDispatch(t *testing.T) {
+
+	repo := newFakeCaptionRepo()
+	search := &fakeSearcher{docs: map[string][]CaptionEntry{
+		"new": {{VideoId: "new", Start: 9000, End: 9500, Text: "stale"}},
+	}}
+	dispatcher := NewOutboxDispatcher(repo, search, "captions")
+
+	meta := &CaptionMetadata{VideoId: "new", VideoTitle: "New video"}
+	captions := []CaptionEntry{{VideoId: "new", Start: 0, End: 1000, Text: "fresh"}}
+	if err := repo.SaveCaptions(context.Background(), meta, captions); err != nil {
+		t.Fatalf("SaveCaptions failed: %v", err)
+	}
+
+	if err := dispatcher.Dispatch(context.Background(), "new"); err != nil {
+		t.Fatalf("Dispatch failed: %v", err)
+	}
+
+	if len(repo.outbox) != 0 {
+		t.Fatalf("expected the outbox entry to be removed, got %+v", repo.outbox)
+	}
+	got := search.docs["new"]
+	if len(got) != 1 || got[0].Text != "fresh" {
+		t.Fatalf("expected the stale document to be replaced, got %+v", got)
+	}
+}
+
+func TestOutboxDeletedVideo(t *testing.T) {
+
+	repo := newFakeCaptionRepo()
+	search := &fakeSearcher{docs: map[string][]CaptionEntry{
+		"gone": {{VideoId: "gone", Start: 0, End: 1000, Text: "gone"}},
+	}}
+	repo.outbox = append(repo.outbox, repoOutboxEntry(1, "gone"))
+
+	if err := NewOutboxDispatcher(repo, search, "captions").Dispatch(context.Background(), "gone"); err != nil {
+		t.Fatalf("Dispatch failed: %v", err)
+	}
+	if _, ok := search.docs["gone"]; ok || len(repo.outbox) != 0 {
+		t.Fatalf("expected the deleted video to be removed from the index")
+	}
+}
+
+func TestOutboxRetriesThenGivesUp(t *testing.T) {
+
+	repo := newFakeCaptionRepo()
+	search := &fakeSearcher{}
+	dispatcher := NewOutboxDispatcher(repo, search, "captions")
+
+	repo.outbox = append(repo.outbox, repoOutboxEntry(1, "a"), repoOutboxEntry(2, "b"))
+	repo.failOn = "a"
+
+	// drain keeps retrying the poisoned entry until it is dead, without blocking the other one
+	dispatcher.drain(context.Background())
+
+	if len(repo.outbox) != 1 || repo.outbox[0].VideoId != "a" {
+		t.Fatalf("expected only the failing entry to be left, got %+v", repo.outbox)
+	}
+	if repo.outbox[0].Attempts != outboxMaxAttempts || !repo.dead[1] {
+		t.Fatalf("expected the failing entry to be dead after %d attempts, got %+v", outboxMaxAttempts, repo.outbox[0])
+	}
+	if len(search.docs["b"]) != 1 {
+		t.Fatalf("expected video b to be indexed, got %+v", search.docs)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+
+	tests := []struct {
+		attempts int
+		max      time.Duration
+	}{
+		{attempts: 1, max: outboxBaseDelay},
+		{attempts: 3, max: 4 * outboxBaseDelay},
+		{attempts: 30, max: outboxMaxDelay},
+	}
+
+	for _, tt := range tests {
+		d := retryDelay(tt.attempts)
+		// Up to 20% jitter is taken off the delay
+		if d > tt.max || d < tt.max*4/5 {
+			t.Errorf("retry delay after %d attempts is %v, expected between %v and %v", tt.attempts, d, tt.max*4/5, tt.max)
+		}
+	}
+}
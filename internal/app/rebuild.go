@@ -0,0 +1,194 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	searcher "banditsecret/internal/search"
+)
+
+// rebuildCheckpoint names the checkpoint a search rebuild resumes from
+const rebuildCheckpoint = "search_rebuild"
+
+const defaultRebuildBatchSize = 100
+
+// Rebuild states
+const (
+	RebuildRunning   = "running"
+	RebuildSucceeded = "succeeded"
+	RebuildFailed    = "failed"
+)
+
+var ErrRebuildRunning = errors.New("a rebuild is already running")
+
+// RebuildStatus is the state of the latest search rebuild
+type RebuildStatus struct {
+	State string `json:"state"`
+	// ResumedFrom is the checkpointed video the rebuild carried on after, empty when it started from scratch
+	ResumedFrom string     `json:"resumed_from,omitempty"`
+	LastVideoId string     `json:"last_video_id,omitempty"`
+	Videos      int        `json:"videos"`
+	Captions    int        `json:"captions"`
+	StartedAt   time.Time  `json:"started_at"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+	Error       string     `json:"error,omitempty"`
+}
+
+// Rebuilder replays the captions stored in the database into the search index, replacing each
+// video's documents. Progress is checkpointed after every batch of videos, so a rebuild that dies
+// part way resumes where it left off.
+type Rebuilder struct {
+	repo      CaptionRepository
+	searcher  searcher.Searcher
+	index     string
+	batchSize int
+
+	mu     sync.Mutex
+	status *RebuildStatus
+}
+
+func NewRebuilder(repo CaptionRepository, searcher searcher.Searcher, index string, batchSize int) *Rebuilder {
+	if batchSize <= 0 {
+		batchSize = defaultRebuildBatchSize
+	}
+	return &Rebuilder{
+		repo:      repo,
+		searcher:  searcher,
+		index:     index,
+		batchSize: batchSize,
+	}
+}
+
+// Start runs a rebuild in the background, returning ErrRebuildRunning if one is in progress.
+// When fresh is set any checkpoint is ignored and every video is indexed again.
+func (r *Rebuilder) Start(fresh bool) (RebuildStatus, error) {
+	r.mu.Lock()
+	if r.status != nil && r.status.State == RebuildRunning {
+		status := *r.status
+		r.mu.Unlock()
+		return status, ErrRebuildRunning
+	}
+	r.status = &RebuildStatus{State: RebuildRunning, StartedAt: time.Now().UTC()}
+	status := *r.status
+	r.mu.Unlock()
+
+	go func() {
+		if err := r.rebuild(context.Background(), fresh); err != nil {
+			log.Printf("Search rebuild failed: %v", err)
+		}
+	}()
+
+	return status, nil
+}
+
+// Run rebuilds the search index and waits for it to finish
+func (r *Rebuilder) Run(ctx context.Context, fresh bool) error {
+	r.mu.Lock()
+	if r.status != nil && r.status.State == RebuildRunning {
+		r.mu.Unlock()
+		return ErrRebuildRunning
+	}
+	r.status = &RebuildStatus{State: RebuildRunning, StartedAt: time.Now().UTC()}
+	r.mu.Unlock()
+
+	return r.rebuild(ctx, fresh)
+}
+
+// Status returns the latest rebuild, false if none has been started
+func (r *Rebuilder) Status() (RebuildStatus, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.status == nil {
+		return RebuildStatus{}, false
+	}
+	return *r.status, true
+}
+
+func (r *Rebuilder) rebuild(ctx context.Context, fresh bool) error {
+	err := r.replay(ctx, fresh)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now().UTC()
+	r.status.FinishedAt = &now
+	if err != nil {
+		r.status.State = RebuildFailed
+		r.status.Error = err.Error()
+		return err
+	}
+	r.status.State = RebuildSucceeded
+	log.Printf("Search rebuild indexed %d captions from %d videos", r.status.Captions, r.status.Videos)
+	return nil
+}
+
+func (r *Rebuilder) replay(ctx context.Context, fresh bool) error {
+
+	var after string
+	if !fresh {
+		var err error
+		after, err = r.repo.LoadCheckpoint(ctx, rebuildCheckpoint)
+		if err != nil {
+			return err
+		}
+		if after != "" {
+			log.Printf("Resuming search rebuild after video %s", after)
+		}
+	}
+	r.update(func(s *RebuildStatus) { s.ResumedFrom = after })
+
+	for {
+		videos, err := r.repo.ListVideos(ctx, after, r.batchSize)
+		if err != nil {
+			return err
+		}
+		if len(videos) == 0 {
+			break
+		}
+
+		for i := range videos {
+			meta := &videos[i]
+
+			captions, err := r.repo.GetCaptions(ctx, meta.VideoId)
+			if err != nil {
+				return err
+			}
+			// Documents indexed under an older id scheme would otherwise survive next to the new ones
+			if _, err := r.searcher.DeleteVideo(ctx, r.index, meta.VideoId); err != nil {
+				return fmt.Errorf("failed to clear documents of video %s: %w", meta.VideoId, err)
+			}
+			if len(captions) > 0 {
+				err = r.searcher.IndexCaptions(ctx, meta, captions)
+				if err != nil {
+					return fmt.Errorf("failed to index captions of video %s: %w", meta.VideoId, err)
+				}
+			}
+
+			r.update(func(s *RebuildStatus) {
+				s.LastVideoId = meta.VideoId
+				s.Videos++
+				s.Captions += len(captions)
+			})
+		}
+
+		after = videos[len(videos)-1].VideoId
+		err = r.repo.SaveCheckpoint(ctx, rebuildCheckpoint, after)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Finished, so the next rebuild starts from the beginning
+	return r.repo.SaveCheckpoint(ctx, rebuildCheckpoint, "")
+}
+
+func (r *Rebuilder) update(fn func(s *RebuildStatus)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fn(r.status)
+}
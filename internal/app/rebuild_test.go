@@ -0,0 +1,80 @@
+package app
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRebuilderResumesFromCheckpoint(t *testing.T) {
+
+	repo := newFakeCaptionRepo()
+	repo.failOn = "d"
+	search := &fakeSearcher{}
+
+	rebuilder := NewRebuilder(repo, search, "captions", 2)
+
+	// The first run dies on video d, after the batch a, b was checkpointed
+	if err := rebuilder.Run(context.Background(), false); err == nil {
+		t.Fatalf("expected the first rebuild to fail")
+	}
+	if got := repo.checkpoints[rebuildCheckpoint]; got != "b" {
+		t.Fatalf("expected checkpoint b, got %q", got)
+	}
+	if status, _ := rebuilder.Status(); status.State != RebuildFailed {
+		t.Fatalf("expected a failed rebuild, got %+v", status)
+	}
+
+	repo.failOn = ""
+	search.indexed = nil
+
+	if err := rebuilder.Run(context.Background(), false); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	want := []string{"c", "d", "e"}
+	if len(search.indexed) != len(want) {
+		t.Fatalf("expected videos %v to be indexed, got %v", want, search.indexed)
+	}
+	for i := range want {
+		if search.indexed[i] != want[i] {
+			t.Fatalf("expected videos %v to be indexed, got %v", want, search.indexed)
+		}
+	}
+
+	status, _ := rebuilder.Status()
+	if status.State != RebuildSucceeded || status.ResumedFrom != "b" || status.Videos != 3 || status.Captions != 3 {
+		t.Fatalf("unexpected status %+v", status)
+	}
+	if got := repo.checkpoints[rebuildCheckpoint]; got != "" {
+		t.Fatalf("expected the checkpoint to be cleared, got %q", got)
+	}
+}
+
+func TestRebuilderFresh(t *testing.T) {
+
+	repo := newFakeCaptionRepo()
+	repo.checkpoints[rebuildCheckpoint] = "c"
+	search := &fakeSearcher{}
+
+	if err := NewRebuilder(repo, search, "captions", 2).Run(context.Background(), true); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if len(search.indexed) != len(repo.videos) {
+		t.Fatalf("expected every video to be indexed, got %v", search.indexed)
+	}
+}
+
+func TestRebuilderReplacesStaleDocuments(t *testing.T) {
+
+	repo := newFakeCaptionRepo()
+	search := &fakeSearcher{docs: map[string][]CaptionEntry{
+		"a": {{VideoId: "a", Start: 0, End: 1000, Text: "indexed under an old id"}},
+	}}
+
+	if err := NewRebuilder(repo, search, "captions", 2).Run(context.Background(), true); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if got := search.docs["a"]; len(got) != 1 || got[0].Text != "caption a" {
+		t.Fatalf("expected only the stored caption of a to be indexed, got %+v", got)
+	}
+}
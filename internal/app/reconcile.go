@@ -0,0 +1,207 @@
+package app
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	searcher "banditsecret/internal/search"
+)
+
+// Drift problems
+const (
+	// DriftMissing means the database has captions for a video the search index has none of
+	DriftMissing = "missing"
+	// DriftChanged means both stores have the video but its captions differ
+	DriftChanged = "changed"
+	// DriftOrphaned means the search index has captions for a video the database doesn't know
+	DriftOrphaned = "orphaned"
+)
+
+// Drift is a video whose captions differ between the database and the search index
+type Drift struct {
+	VideoId        string `json:"video_id"`
+	Problem        string `json:"problem"`
+	DbCaptions     int    `json:"db_captions"`
+	SearchCaptions int    `json:"search_captions"`
+	Repaired       bool   `json:"repaired"`
+	Error          string `json:"error,omitempty"`
+}
+
+// ReconcileReport is the outcome of comparing the database with the search index
+type ReconcileReport struct {
+	Repair     bool      `json:"repair"`
+	Videos     int       `json:"videos"`
+	InSync     int       `json:"in_sync"`
+	Drift      []Drift   `json:"drift"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+}
+
+// Reconciler compares each video's captions in the database, the source of truth, with the
+// documents in the search index by count and checksum
+type Reconciler struct {
+	repo      CaptionRepository
+	searcher  searcher.Searcher
+	index     string
+	batchSize int
+}
+
+func NewReconciler(repo CaptionRepository, searcher searcher.Searcher, index string, batchSize int) *Reconciler {
+	if batchSize <= 0 {
+		batchSize = defaultRebuildBatchSize
+	}
+	return &Reconciler{
+		repo:      repo,
+		searcher:  searcher,
+		index:     index,
+		batchSize: batchSize,
+	}
+}
+
+// Reconcile reports every video that has drifted. With repair set, orphaned videos are deleted
+// from the search index and missing or changed ones are re-indexed from the database.
+func (r *Reconciler) Reconcile(ctx context.Context, repair bool) (*ReconcileReport, error) {
+
+	report := &ReconcileReport{Repair: repair, Drift: []Drift{}, StartedAt: time.Now().UTC()}
+	known := make(map[string]bool)
+
+	var after string
+	for {
+		videos, err := r.repo.ListVideos(ctx, after, r.batchSize)
+		if err != nil {
+			return nil, err
+		}
+		if len(videos) == 0 {
+			break
+		}
+
+		for i := range videos {
+			meta := &videos[i]
+			known[meta.VideoId] = true
+			report.Videos++
+
+			drift, err := r.checkVideo(ctx, meta, repair)
+			if err != nil {
+				return nil, err
+			}
+			if drift == nil {
+				report.InSync++
+				continue
+			}
+			report.Drift = append(report.Drift, *drift)
+		}
+		after = videos[len(videos)-1].VideoId
+	}
+
+	// Anything left in the index that the database doesn't have is orphaned
+	after = ""
+	for {
+		ids, err := r.searcher.ListVideoIds(ctx, r.index, after, r.batchSize)
+		if err != nil {
+			return nil, err
+		}
+		if len(ids) == 0 {
+			break
+		}
+
+		for _, id := range ids {
+			if known[id] {
+				continue
+			}
+			captions, err := r.searcher.GetVideoCaptions(ctx, r.index, id)
+			if err != nil {
+				return nil, err
+			}
+			drift := Drift{VideoId: id, Problem: DriftOrphaned, SearchCaptions: len(captions)}
+			if repair {
+				_, err := r.searcher.DeleteVideo(ctx, r.index, id)
+				drift.setRepaired(err)
+			}
+			report.Drift = append(report.Drift, drift)
+		}
+		after = ids[len(ids)-1]
+	}
+
+	report.FinishedAt = time.Now().UTC()
+	log.Printf("Reconciled %d videos: %d in sync, %d drifted", report.Videos, report.InSync, len(report.Drift))
+	return report, nil
+}
+
+// checkVideo compares one video across both stores, returning nil when they agree
+func (r *Reconciler) checkVideo(ctx context.Context, meta *CaptionMetadata, repair bool) (*Drift, error) {
+
+	dbCaptions, err := r.repo.GetCaptions(ctx, meta.VideoId)
+	if err != nil {
+		return nil, err
+	}
+	searchCaptions, err := r.searcher.GetVideoCaptions(ctx, r.index, meta.VideoId)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(dbCaptions) == len(searchCaptions) && captionChecksum(dbCaptions) == captionChecksum(searchCaptions) {
+		return nil, nil
+	}
+
+	drift := &Drift{VideoId: meta.VideoId, Problem: DriftChanged, DbCaptions: len(dbCaptions), SearchCaptions: len(searchCaptions)}
+	if len(searchCaptions) == 0 {
+		drift.Problem = DriftMissing
+	}
+
+	if repair {
+		drift.setRepaired(r.reindexVideo(ctx, meta, dbCaptions, len(searchCaptions) > 0))
+	}
+	return drift, nil
+}
+
+// reindexVideo replaces a video's documents in the search index with its captions from the database
+func (r *Reconciler) reindexVideo(ctx context.Context, meta *CaptionMetadata, captions []CaptionEntry, hasDocuments bool) error {
+	if hasDocuments {
+		if _, err := r.searcher.DeleteVideo(ctx, r.index, meta.VideoId); err != nil {
+			return err
+		}
+	}
+	if len(captions) == 0 {
+		return nil
+	}
+	return r.searcher.IndexCaptions(ctx, meta, captions)
+}
+
+func (d *Drift) setRepaired(err error) {
+	if err != nil {
+		log.Printf("Failed to repair video %s: %v", d.VideoId, err)
+		d.Error = err.Error()
+		return
+	}
+	d.Repaired = true
+}
+
+// captionChecksum hashes a video's captions independently of the order they are stored in
+func captionChecksum(captions []CaptionEntry) string {
+
+	sorted := append([]CaptionEntry(nil), captions...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Language != sorted[j].Language {
+			return sorted[i].Language < sorted[j].Language
+		}
+		if sorted[i].Start != sorted[j].Start {
+			return sorted[i].Start < sorted[j].Start
+		}
+		return sorted[i].Text < sorted[j].Text
+	})
+
+	h := sha256.New()
+	for _, c := range sorted {
+		fmt.Fprintf(h, "%s\x00%d\x00%d\x00%s\x00", c.Language, c.Start, c.End, c.Text)
+		for _, w := range c.Words {
+			fmt.Fprintf(h, "%d\x00%s\x00", w.Start, w.Text)
+		}
+		h.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,59 @@
+package app
+
+import (
+	"context"
+	"testing"
+)
+
+func TestReconcile(t *testing.T) {
+
+	repo := newFakeCaptionRepo()
+	search := &fakeSearcher{docs: map[string][]CaptionEntry{
+		// a is in sync, stored in a different order
+		"a": {repo.captions["a"][0]},
+		// b has a stale caption left over from an earlier ingestion
+		"b": {repo.captions["b"][0], {VideoId: "b", Start: 5000, End: 6000, Text: "stale"}},
+		// c has different text
+		"c": {{VideoId: "c", Start: 0, End: 1000, Text: "old text"}},
+		// d and e are missing, z is unknown to the database
+		"z": {{VideoId: "z", Start: 0, End: 1000, Text: "orphan"}},
+	}}
+
+	reconciler := NewReconciler(repo, search, "captions", 2)
+
+	report, err := reconciler.Reconcile(context.Background(), false)
+	if err != nil {
+		t.Fatalf("Reconcile failed: %v", err)
+	}
+
+	want := map[string]string{"b": DriftChanged, "c": DriftChanged, "d": DriftMissing, "e": DriftMissing, "z": DriftOrphaned}
+	if report.Videos != 5 || report.InSync != 1 || len(report.Drift) != len(want) {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	for _, drift := range report.Drift {
+		if want[drift.VideoId] != drift.Problem || drift.Repaired {
+			t.Fatalf("unexpected drift %+v", drift)
+		}
+	}
+	if len(search.indexed) != 0 {
+		t.Fatalf("a report-only reconcile must not index anything, indexed %v", search.indexed)
+	}
+
+	report, err = reconciler.Reconcile(context.Background(), true)
+	if err != nil {
+		t.Fatalf("Reconcile failed: %v", err)
+	}
+	for _, drift := range report.Drift {
+		if !drift.Repaired {
+			t.Fatalf("expected drift to be repaired: %+v", drift)
+		}
+	}
+
+	report, err = reconciler.Reconcile(context.Background(), false)
+	if err != nil {
+		t.Fatalf("Reconcile failed: %v", err)
+	}
+	if report.InSync != 5 || len(report.Drift) != 0 {
+		t.Fatalf("expected every video to be in sync after repairing, got %+v", report)
+	}
+}
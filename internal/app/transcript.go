@@ -0,0 +1,60 @@
+package app
+
+import (
+	"context"
+	"fmt"
+
+	"banditsecret/internal/storage"
+	"banditsecret/internal/transcript"
+)
+
+// ErrUnknownLanguage is returned when a transcript is asked for in a language the video has no captions in
+var ErrUnknownLanguage = fmt.Errorf("%w: no captions in that language", storage.ErrInvalidVideoQuery)
+
+// Transcript loads a video's captions in one language within the window. Without a language
+// the video's only language is used, or English if it has several, or else the first.
+func (s *ApplicationServices) Transcript(ctx context.Context, videoId string, window storage.CaptionWindow) (*transcript.Transcript, error) {
+
+	video, err := s.Repo.GetVideoDetails(ctx, videoId)
+	if err != nil {
+		return nil, err
+	}
+
+	language, err := transcriptLanguage(video.Languages, window.Language)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q for video %s", err, window.Language, videoId)
+	}
+	window.Language = language
+
+	captions, err := s.Repo.GetCaptionWindow(ctx, videoId, window)
+	if err != nil {
+		return nil, err
+	}
+
+	return &transcript.Transcript{
+		VideoId:  video.VideoId,
+		Title:    video.Title,
+		Url:      video.Url,
+		Language: language,
+		Captions: captions,
+	}, nil
+}
+
+// transcriptLanguage picks the language of a transcript from those the video has
+func transcriptLanguage(languages []storage.VideoLanguage, want string) (string, error) {
+	if len(languages) == 0 {
+		return want, nil
+	}
+	for _, lang := range languages {
+		if want != "" && lang.Language == want {
+			return want, nil
+		}
+		if want == "" && lang.Language == "en" {
+			return "en", nil
+		}
+	}
+	if want == "" {
+		return languages[0].Language, nil
+	}
+	return "", ErrUnknownLanguage
+}
@@ -0,0 +1,32 @@
+package app
+
+import (
+	"errors"
+	"testing"
+
+	"banditsecret/internal/storage"
+)
+
+func TestTranscriptLanguage(t *testing.T) {
+
+	languages := []storage.VideoLanguage{{Language: "de"}, {Language: "en"}, {Language: "fr"}}
+
+	tests := []struct {
+		languages []storage.VideoLanguage
+		want      string
+		got       string
+		err       error
+	}{
+		{languages: languages, want: "fr", got: "fr"},
+		{languages: languages, want: "", got: "en"},
+		{languages: languages[2:], want: "", got: "fr"},
+		{languages: languages, want: "es", err: ErrUnknownLanguage},
+	}
+
+	for _, tt := range tests {
+		got, err := transcriptLanguage(tt.languages, tt.want)
+		if !errors.Is(err, tt.err) || got != tt.got {
+			t.Fatalf("transcriptLanguage(%q) = %q, %v; want %q, %v", tt.want, got, err, tt.got, tt.err)
+		}
+	}
+}
@@ -0,0 +1,361 @@
+// Package jobs provides a bounded worker pool for running caption ingestion jobs in the background.
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+type Stage string
+
+const (
+	StageFetching    Stage = "fetching"
+	StageConverting  Stage = "converting"
+	StageParsing     Stage = "parsing"
+	StageNormalizing Stage = "normalizing"
+	StageLoading     Stage = "loading"
+	StageIndexing    Stage = "indexing"
+)
+
+// Stages lists every ingestion stage in the order they are run
+var Stages = []Stage{StageFetching, StageConverting, StageParsing, StageNormalizing, StageLoading, StageIndexing}
+
+type Status string
+
+const (
+	StatusPending   Status = "pending"
+	StatusRunning   Status = "running"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+	StatusSkipped   Status = "skipped"
+)
+
+var ErrQueueFull = errors.New("job queue is full")
+
+const (
+	// finishedJobTTL is how long a finished job can still be looked up
+	finishedJobTTL = time.Hour
+	// maxFinishedJobs caps how many finished jobs are kept, the oldest are dropped first
+	maxFinishedJobs = 1000
+)
+
+// Request holds everything a worker needs to ingest a video
+type Request struct {
+	Url       string   `json:"url"`
+	Languages []string `json:"languages,omitempty"`
+}
+
+// StageProgress reports the state of a single ingestion stage
+type StageProgress struct {
+	Stage      Stage      `json:"stage"`
+	Status     Status     `json:"status"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// Job is a snapshot of an ingestion job and its per-stage progress
+type Job struct {
+	Id         string          `json:"id"`
+	Request    Request         `json:"request"`
+	Status     Status          `json:"status"`
+	Stages     []StageProgress `json:"stages"`
+	CreatedAt  time.Time       `json:"created_at"`
+	StartedAt  *time.Time      `json:"started_at,omitempty"`
+	FinishedAt *time.Time      `json:"finished_at,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	// Counters holds figures the handler reports, such as how many cues were collapsed
+	Counters map[string]int `json:"counters,omitempty"`
+}
+
+// Handler runs a job, reporting its progress through the Tracker
+type Handler func(ctx context.Context, t *Tracker) error
+
+// Queue stores jobs in memory and runs them on a fixed number of workers
+type Queue struct {
+	mu   sync.RWMutex
+	jobs map[string]*Job
+	// finished holds the ids of finished jobs in the order they finished, for pruning
+	finished    []string
+	finishedTTL time.Duration
+	maxFinished int
+	pending     chan string
+	handler     Handler
+	workers     int
+	timeout     time.Duration
+	wg          sync.WaitGroup
+}
+
+// Factory to create a Queue with the given number of workers and queue capacity
+func NewQueue(workers, capacity int, timeout time.Duration, handler Handler) (*Queue, error) {
+
+	if workers < 1 || capacity < 1 {
+		return nil, errors.New("workers and capacity must be at least 1")
+	}
+	if handler == nil {
+		return nil, errors.New("handler cannot be nil")
+	}
+
+	return &Queue{
+		jobs:        make(map[string]*Job),
+		finishedTTL: finishedJobTTL,
+		maxFinished: maxFinishedJobs,
+		pending:     make(chan string, capacity),
+		handler:     handler,
+		workers:     workers,
+		timeout:     timeout,
+	}, nil
+}
+
+// Start launches the workers, they exit once ctx is cancelled
+func (q *Queue) Start(ctx context.Context) {
+	for i := 0; i < q.workers; i++ {
+		q.wg.Add(1)
+		go q.work(ctx)
+	}
+}
+
+// Wait blocks until all workers have exited
+func (q *Queue) Wait() {
+	q.wg.Wait()
+}
+
+// Enqueue registers a new job and hands it to the workers, it fails with ErrQueueFull if no slot is free
+func (q *Queue) Enqueue(req Request) (Job, error) {
+
+	id, err := newJobId()
+	if err != nil {
+		return Job{}, err
+	}
+
+	job := &Job{
+		Id:        id,
+		Request:   req,
+		Status:    StatusPending,
+		CreatedAt: time.Now().UTC(),
+	}
+	for _, stage := range Stages {
+		job.Stages = append(job.Stages, StageProgress{Stage: stage, Status: StatusPending})
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.prune(time.Now().UTC())
+
+	select {
+	case q.pending <- id:
+		q.jobs[id] = job
+	default:
+		return Job{}, ErrQueueFull
+	}
+
+	return job.snapshot(), nil
+}
+
+// Get returns a snapshot of the job with the given id
+func (q *Queue) Get(id string) (Job, bool) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	job, ok := q.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return job.snapshot(), true
+}
+
+func (q *Queue) work(ctx context.Context) {
+	defer q.wg.Done()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case id := <-q.pending:
+			q.run(ctx, id)
+		}
+	}
+}
+
+func (q *Queue) run(ctx context.Context, id string) {
+
+	q.mu.Lock()
+	job := q.jobs[id]
+	now := time.Now().UTC()
+	job.Status = StatusRunning
+	job.StartedAt = &now
+	req := job.Request
+	q.mu.Unlock()
+
+	if q.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, q.timeout)
+		defer cancel()
+	}
+
+	tracker := &Tracker{queue: q, id: id, req: req}
+	err := q.runHandler(ctx, tracker)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now = time.Now().UTC()
+	job.FinishedAt = &now
+	q.finished = append(q.finished, id)
+	if err != nil {
+		job.Status = StatusFailed
+		job.Error = err.Error()
+		log.Printf("Job %s failed: %v", id, err)
+	} else {
+		job.Status = StatusSucceeded
+		log.Printf("Job %s succeeded", id)
+	}
+
+	// Anything the handler never reached is marked as skipped, a stage it panicked in as failed
+	for i := range job.Stages {
+		switch job.Stages[i].Status {
+		case StatusPending:
+			job.Stages[i].Status = StatusSkipped
+		case StatusRunning:
+			job.Stages[i].Status = StatusFailed
+			job.Stages[i].FinishedAt = &now
+			job.Stages[i].Error = job.Error
+		}
+	}
+	q.prune(now)
+}
+
+// runHandler runs the handler, turning a panic into an error so one bad job can't take the server down
+func (q *Queue) runHandler(ctx context.Context, t *Tracker) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Job %s panicked: %v\n%s", t.id, r, debug.Stack())
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return q.handler(ctx, t)
+}
+
+// prune forgets finished jobs older than finishedTTL and the oldest beyond maxFinished.
+// The caller must hold q.mu.
+func (q *Queue) prune(now time.Time) {
+	drop := 0
+	for drop < len(q.finished) {
+		job := q.jobs[q.finished[drop]]
+		if len(q.finished)-drop <= q.maxFinished && now.Sub(*job.FinishedAt) < q.finishedTTL {
+			break
+		}
+		delete(q.jobs, q.finished[drop])
+		drop++
+	}
+	q.finished = q.finished[drop:]
+}
+
+func (q *Queue) updateStage(id string, stage Stage, update func(p *StageProgress)) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, ok := q.jobs[id]
+	if !ok {
+		return
+	}
+	for i := range job.Stages {
+		if job.Stages[i].Stage == stage {
+			update(&job.Stages[i])
+			return
+		}
+	}
+}
+
+// Tracker is handed to a Handler so it can report progress on its job
+type Tracker struct {
+	queue *Queue
+	id    string
+	req   Request
+}
+
+func (t *Tracker) JobId() string {
+	return t.id
+}
+
+func (t *Tracker) Request() Request {
+	return t.req
+}
+
+// Run executes fn as the given stage, recording its timestamps and any error
+func (t *Tracker) Run(stage Stage, fn func() error) error {
+
+	start := time.Now().UTC()
+	t.queue.updateStage(t.id, stage, func(p *StageProgress) {
+		p.Status = StatusRunning
+		p.StartedAt = &start
+	})
+
+	err := fn()
+
+	end := time.Now().UTC()
+	t.queue.updateStage(t.id, stage, func(p *StageProgress) {
+		p.FinishedAt = &end
+		if err != nil {
+			p.Status = StatusFailed
+			p.Error = err.Error()
+		} else {
+			p.Status = StatusSucceeded
+		}
+	})
+
+	if err != nil {
+		return fmt.Errorf("%s: %w", stage, err)
+	}
+	return nil
+}
+
+// Count records a named figure on the job, overwriting any previous value
+func (t *Tracker) Count(name string, n int) {
+	t.queue.mu.Lock()
+	defer t.queue.mu.Unlock()
+
+	job, ok := t.queue.jobs[t.id]
+	if !ok {
+		return
+	}
+	if job.Counters == nil {
+		job.Counters = make(map[string]int)
+	}
+	job.Counters[name] = n
+}
+
+// Skip marks a stage as intentionally not run
+func (t *Tracker) Skip(stage Stage) {
+	t.queue.updateStage(t.id, stage, func(p *StageProgress) {
+		p.Status = StatusSkipped
+	})
+}
+
+func (j *Job) snapshot() Job {
+	cp := *j
+	cp.Stages = append([]StageProgress(nil), j.Stages...)
+	if j.Counters != nil {
+		cp.Counters = make(map[string]int, len(j.Counters))
+		for k, v := range j.Counters {
+			cp.Counters[k] = v
+		}
+	}
+	return cp
+}
+
+func newJobId() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate job id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
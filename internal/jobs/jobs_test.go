@@ -0,0 +1,223 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func waitForJob(t *testing.T, q *Queue, id string) Job {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		job, ok := q.Get(id)
+		if !ok {
+			t.Fatalf("job %s not found", id)
+		}
+		if job.Status == StatusSucceeded || job.Status == StatusFailed {
+			return job
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("job %s did not finish in time", id)
+	return Job{}
+}
+
+func TestQueueRunsStages(t *testing.T) {
+
+	handler := func(ctx context.Context, tr *Tracker) error {
+		for _, stage := range Stages {
+			err := tr.Run(stage, func() error { return nil })
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	q, err := NewQueue(1, 1, time.Second, handler)
+	if err != nil {
+		t.Fatalf("NewQueue failed: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	q.Start(ctx)
+
+	job, err := q.Enqueue(Request{Url: "https://youtu.be/abc"})
+	if err != nil {
+		t.Fatalf("Enqueue failed: %v", err)
+	}
+
+	got := waitForJob(t, q, job.Id)
+	if got.Status != StatusSucceeded {
+		t.Fatalf("expected status %s, got %s (%s)", StatusSucceeded, got.Status, got.Error)
+	}
+	if got.StartedAt == nil || got.FinishedAt == nil {
+		t.Fatalf("expected job timestamps to be set, got %+v", got)
+	}
+	for _, p := range got.Stages {
+		if p.Status != StatusSucceeded || p.StartedAt == nil || p.FinishedAt == nil {
+			t.Fatalf("stage %s not completed: %+v", p.Stage, p)
+		}
+	}
+}
+
+func TestQueueRecordsStageError(t *testing.T) {
+
+	handler := func(ctx context.Context, tr *Tracker) error {
+		err := tr.Run(StageFetching, func() error { return nil })
+		if err != nil {
+			return err
+		}
+		return tr.Run(StageConverting, func() error { return errors.New("bad vtt") })
+	}
+
+	q, err := NewQueue(1, 1, time.Second, handler)
+	if err != nil {
+		t.Fatalf("NewQueue failed: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	q.Start(ctx)
+
+	job, err := q.Enqueue(Request{Url: "https://youtu.be/abc"})
+	if err != nil {
+		t.Fatalf("Enqueue failed: %v", err)
+	}
+
+	got := waitForJob(t, q, job.Id)
+	if got.Status != StatusFailed {
+		t.Fatalf("expected status %s, got %s", StatusFailed, got.Status)
+	}
+	if got.Error != "converting: bad vtt" {
+		t.Fatalf("expected job error %q, got %q", "converting: bad vtt", got.Error)
+	}
+
+	want := map[Stage]Status{
+		StageFetching:    StatusSucceeded,
+		StageConverting:  StatusFailed,
+		StageParsing:     StatusSkipped,
+		StageNormalizing: StatusSkipped,
+		StageLoading:     StatusSkipped,
+		StageIndexing:    StatusSkipped,
+	}
+	for _, p := range got.Stages {
+		if p.Status != want[p.Stage] {
+			t.Errorf("stage %s: expected %s, got %s", p.Stage, want[p.Stage], p.Status)
+		}
+	}
+}
+
+func TestQueueFull(t *testing.T) {
+
+	// Workers are never started so the single slot stays occupied
+	q, err := NewQueue(1, 1, time.Second, func(ctx context.Context, tr *Tracker) error { return nil })
+	if err != nil {
+		t.Fatalf("NewQueue failed: %v", err)
+	}
+
+	_, err = q.Enqueue(Request{Url: "first"})
+	if err != nil {
+		t.Fatalf("Enqueue failed: %v", err)
+	}
+
+	_, err = q.Enqueue(Request{Url: "second"})
+	if !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("expected ErrQueueFull, got %v", err)
+	}
+}
+
+func TestQueueRecoversFromPanic(t *testing.T) {
+
+	handler := func(ctx context.Context, tr *Tracker) error {
+		return tr.Run(StageParsing, func() error {
+			var cues []string
+			_ = cues[3]
+			return nil
+		})
+	}
+
+	q, err := NewQueue(1, 2, time.Second, handler)
+	if err != nil {
+		t.Fatalf("NewQueue failed: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	q.Start(ctx)
+
+	// The worker survives the first job and runs the second
+	first, err := q.Enqueue(Request{Url: "first"})
+	if err != nil {
+		t.Fatalf("Enqueue failed: %v", err)
+	}
+	second, err := q.Enqueue(Request{Url: "second"})
+	if err != nil {
+		t.Fatalf("Enqueue failed: %v", err)
+	}
+
+	for _, id := range []string{first.Id, second.Id} {
+		got := waitForJob(t, q, id)
+		if got.Status != StatusFailed || !strings.HasPrefix(got.Error, "panic: ") {
+			t.Fatalf("expected a failed job with a panic error, got %s %q", got.Status, got.Error)
+		}
+		for _, p := range got.Stages {
+			if p.Stage == StageParsing && p.Status != StatusFailed {
+				t.Fatalf("expected the panicking stage to fail, got %+v", p)
+			}
+		}
+	}
+}
+
+func TestQueuePrunesFinishedJobs(t *testing.T) {
+
+	q, err := NewQueue(1, 10, time.Second, func(ctx context.Context, tr *Tracker) error { return nil })
+	if err != nil {
+		t.Fatalf("NewQueue failed: %v", err)
+	}
+	q.maxFinished = 2
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	q.Start(ctx)
+
+	var ids []string
+	for i := 0; i < 3; i++ {
+		job, err := q.Enqueue(Request{Url: "video"})
+		if err != nil {
+			t.Fatalf("Enqueue failed: %v", err)
+		}
+		waitForJob(t, q, job.Id)
+		ids = append(ids, job.Id)
+	}
+
+	// Only the two most recent finished jobs are kept
+	if _, ok := q.Get(ids[0]); ok {
+		t.Fatalf("expected the oldest job to be pruned")
+	}
+	for _, id := range ids[1:] {
+		if _, ok := q.Get(id); !ok {
+			t.Fatalf("expected job %s to be kept", id)
+		}
+	}
+
+	// Finished jobs past their TTL are dropped on the next enqueue, pending ones are kept
+	q.mu.Lock()
+	q.finishedTTL = time.Nanosecond
+	q.mu.Unlock()
+	cancel()
+	q.Wait()
+	pending, err := q.Enqueue(Request{Url: "video"})
+	if err != nil {
+		t.Fatalf("Enqueue failed: %v", err)
+	}
+	for _, id := range ids[1:] {
+		if _, ok := q.Get(id); ok {
+			t.Fatalf("expected expired job %s to be pruned", id)
+		}
+	}
+	if _, ok := q.Get(pending.Id); !ok {
+		t.Fatalf("expected the pending job to be kept")
+	}
+}
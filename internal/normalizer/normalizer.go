@@ -0,0 +1,196 @@
+// Package normalizer cleans up parsed captions before they are stored and indexed.
+package normalizer
+
+import (
+	"sort"
+	"strings"
+
+	"banditsecret/internal/parser"
+)
+
+type CaptionEntry = parser.CaptionEntry
+type TimeMs = parser.TimeMs
+
+// defaultMaxGap is how far apart two cues can be and still count as one rolling caption.
+// YouTube's auto-captions hand over from one cue to the next with no gap at all.
+const defaultMaxGap TimeMs = 50
+
+// Stats reports what a normalization pass did
+type Stats struct {
+	Input     int `json:"input"`
+	Output    int `json:"output"`
+	Collapsed int `json:"collapsed"`
+}
+
+type Normalizer interface {
+	Normalize(captions []CaptionEntry) ([]CaptionEntry, Stats)
+}
+
+// Concrete NormalizerService implements Normalizer
+type NormalizerService struct {
+	maxGap TimeMs
+}
+
+func NewNormalizerService() *NormalizerService {
+	return &NormalizerService{
+		maxGap: defaultMaxGap,
+	}
+}
+
+// Normalize merges rolling and overlapping cues into clean, non-overlapping segments.
+//
+// Auto-generated YouTube captions scroll: each cue repeats the last line of the cue before it,
+// and short transitional cues repeat it on its own. Lines a cue shares with the end of the
+// previous cue are dropped, cues with nothing new extend the previous segment, and cues that
+// only grow the previous cue's text are merged into it. Each video and language is handled separately.
+func (s *NormalizerService) Normalize(captions []CaptionEntry) ([]CaptionEntry, Stats) {
+
+	stats := Stats{Input: len(captions)}
+
+	var out []CaptionEntry
+	for _, group := range groupCaptions(captions) {
+		out = append(out, s.normalizeGroup(group)...)
+	}
+
+	stats.Output = len(out)
+	stats.Collapsed = stats.Input - stats.Output
+	return out, stats
+}
+
+func (s *NormalizerService) normalizeGroup(captions []CaptionEntry) []CaptionEntry {
+
+	sorted := append([]CaptionEntry(nil), captions...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Start < sorted[j].Start
+	})
+
+	var segments []CaptionEntry
+	var prevLines []string
+	var prevEnd TimeMs
+
+	for i, cue := range sorted {
+		lines := splitLines(cue.Text)
+
+		linked := i > 0 && cue.Start <= prevEnd+s.maxGap
+		if !linked {
+			segments = append(segments, cue)
+			prevLines, prevEnd = lines, cue.End
+			continue
+		}
+
+		last := &segments[len(segments)-1]
+
+		if k := lineOverlap(prevLines, lines); k > 0 {
+			newLines := lines[k:]
+			if len(newLines) == 0 {
+				// Nothing new, the cue only keeps the previous text on screen
+				last.End = max(last.End, cue.End)
+			} else {
+				segment := cue
+				segment.Text = strings.Join(newLines, "\n")
+				segments = append(segments, segment)
+			}
+		} else if rest, ok := wordsAfterPrefix(prevLines, lines); ok {
+			// The cue grows the previous text word by word
+			if rest != "" {
+				last.Text += " " + rest
+			}
+			last.End = max(last.End, cue.End)
+			last.Words = mergeWords(last.Words, cue.Words)
+		} else {
+			segments = append(segments, cue)
+		}
+
+		prevLines, prevEnd = lines, max(prevEnd, cue.End)
+	}
+
+	// Clip each segment so it ends no later than the next one starts
+	for i := 0; i+1 < len(segments); i++ {
+		if segments[i].End > segments[i+1].Start {
+			segments[i].End = max(segments[i].Start, segments[i+1].Start)
+		}
+	}
+
+	return segments
+}
+
+// mergeWords appends the timed words of a growing cue that come after the words already kept
+func mergeWords(kept, words []parser.Word) []parser.Word {
+	if len(kept) == 0 {
+		return append([]parser.Word(nil), words...)
+	}
+	lastStart := kept[len(kept)-1].Start
+	merged := append([]parser.Word(nil), kept...)
+	for _, w := range words {
+		if w.Start > lastStart {
+			merged = append(merged, w)
+		}
+	}
+	return merged
+}
+
+// groupCaptions splits captions by video and language, keeping the order each group first appears in
+func groupCaptions(captions []CaptionEntry) [][]CaptionEntry {
+	type key struct{ videoId, language string }
+
+	var order []key
+	groups := make(map[key][]CaptionEntry)
+	for _, caption := range captions {
+		k := key{caption.VideoId, caption.Language}
+		if _, ok := groups[k]; !ok {
+			order = append(order, k)
+		}
+		groups[k] = append(groups[k], caption)
+	}
+
+	out := make([][]CaptionEntry, 0, len(order))
+	for _, k := range order {
+		out = append(out, groups[k])
+	}
+	return out
+}
+
+// splitLines splits caption text into lines with normalized whitespace, dropping empty lines
+func splitLines(text string) []string {
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.Join(strings.Fields(line), " ")
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// lineOverlap returns the largest k such that the last k lines of prev are the first k lines of cur
+func lineOverlap(prev, cur []string) int {
+	for k := min(len(prev), len(cur)); k > 0; k-- {
+		match := true
+		for i := 0; i < k; i++ {
+			if prev[len(prev)-k+i] != cur[i] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return k
+		}
+	}
+	return 0
+}
+
+// wordsAfterPrefix reports whether cur starts with all of prev's words, returning the words that follow
+func wordsAfterPrefix(prev, cur []string) (string, bool) {
+	prevWords := strings.Fields(strings.Join(prev, " "))
+	curWords := strings.Fields(strings.Join(cur, " "))
+
+	if len(prevWords) == 0 || len(curWords) < len(prevWords) {
+		return "", false
+	}
+	for i, word := range prevWords {
+		if curWords[i] != word {
+			return "", false
+		}
+	}
+	return strings.Join(curWords[len(prevWords):], " "), true
+}
@@ -0,0 +1,110 @@
+package normalizer
+
+import (
+	"reflect"
+	"testing"
+
+	"banditsecret/internal/parser"
+)
+
+func TestNormalize(t *testing.T) {
+
+	tests := []struct {
+		name          string
+		input         []CaptionEntry
+		want          []CaptionEntry
+		wantCollapsed int
+	}{
+		{
+			name: "Rolling auto-captions",
+			input: []CaptionEntry{
+				{VideoId: "v", Start: 0, End: 2000, Text: "hello world"},
+				{VideoId: "v", Start: 2000, End: 2010, Text: "hello world"},
+				{VideoId: "v", Start: 2010, End: 4000, Text: "hello world\nthis is next"},
+				{VideoId: "v", Start: 4000, End: 4010, Text: "this is next"},
+				{VideoId: "v", Start: 4010, End: 6000, Text: "this is next\nand more"},
+			},
+			want: []CaptionEntry{
+				{VideoId: "v", Start: 0, End: 2010, Text: "hello world"},
+				{VideoId: "v", Start: 2010, End: 4010, Text: "this is next"},
+				{VideoId: "v", Start: 4010, End: 6000, Text: "and more"},
+			},
+			wantCollapsed: 2,
+		},
+		{
+			name: "Growing word by word",
+			input: []CaptionEntry{
+				{VideoId: "v", Start: 0, End: 1000, Text: "the quick", Words: []parser.Word{{Start: 0, Text: "the"}, {Start: 300, Text: "quick"}}},
+				{VideoId: "v", Start: 500, End: 1500, Text: "the quick brown", Words: []parser.Word{{Start: 0, Text: "the"}, {Start: 300, Text: "quick"}, {Start: 700, Text: "brown"}}},
+				{VideoId: "v", Start: 1000, End: 2000, Text: "the quick brown fox"},
+			},
+			want: []CaptionEntry{
+				{VideoId: "v", Start: 0, End: 2000, Text: "the quick brown fox", Words: []parser.Word{{Start: 0, Text: "the"}, {Start: 300, Text: "quick"}, {Start: 700, Text: "brown"}}},
+			},
+			wantCollapsed: 2,
+		},
+		{
+			name: "Clean captions are untouched",
+			input: []CaptionEntry{
+				{VideoId: "v", Start: 0, End: 5000, Text: "SampleText1"},
+				{VideoId: "v", Start: 6000, End: 10000, Text: "SampleText2"},
+				{VideoId: "v", Start: 20000, End: 25000, Text: "SampleText2"},
+			},
+			want: []CaptionEntry{
+				{VideoId: "v", Start: 0, End: 5000, Text: "SampleText1"},
+				{VideoId: "v", Start: 6000, End: 10000, Text: "SampleText2"},
+				{VideoId: "v", Start: 20000, End: 25000, Text: "SampleText2"},
+			},
+			wantCollapsed: 0,
+		},
+		{
+			name: "Overlapping distinct cues are clipped",
+			input: []CaptionEntry{
+				{VideoId: "v", Start: 0, End: 3000, Text: "first"},
+				{VideoId: "v", Start: 2000, End: 4000, Text: "second"},
+			},
+			want: []CaptionEntry{
+				{VideoId: "v", Start: 0, End: 2000, Text: "first"},
+				{VideoId: "v", Start: 2000, End: 4000, Text: "second"},
+			},
+			wantCollapsed: 0,
+		},
+		{
+			name: "Languages are normalized separately",
+			input: []CaptionEntry{
+				{VideoId: "v", Language: "en", Start: 0, End: 1000, Text: "hello"},
+				{VideoId: "v", Language: "fr", Start: 0, End: 1000, Text: "bonjour"},
+				{VideoId: "v", Language: "en", Start: 1000, End: 1010, Text: "hello"},
+			},
+			want: []CaptionEntry{
+				{VideoId: "v", Language: "en", Start: 0, End: 1010, Text: "hello"},
+				{VideoId: "v", Language: "fr", Start: 0, End: 1000, Text: "bonjour"},
+			},
+			wantCollapsed: 1,
+		},
+	}
+
+	normalizerService := NewNormalizerService()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, stats := normalizerService.Normalize(tt.input)
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("expected %d segments, got %d: %+v", len(tt.want), len(got), got)
+			}
+			for i := range got {
+				if !reflect.DeepEqual(got[i], tt.want[i]) {
+					t.Fatalf("segment %d does not match expected:\nreceived: %+v\nexpected: %+v", i, got[i], tt.want[i])
+				}
+			}
+
+			if stats.Collapsed != tt.wantCollapsed {
+				t.Errorf("expected %d collapsed cues, got %d", tt.wantCollapsed, stats.Collapsed)
+			}
+			if stats.Input != len(tt.input) || stats.Output != len(got) {
+				t.Errorf("unexpected stats %+v", stats)
+			}
+		})
+	}
+}
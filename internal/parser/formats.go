@@ -0,0 +1,159 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// sniffLen is how many leading bytes are handed to Format.Sniff
+const sniffLen = 512
+
+// Format decodes a single caption file format into caption entries
+type Format interface {
+	// Name is a short identifier such as "vtt" or "srt"
+	Name() string
+	// Extensions lists the file extensions, including the leading dot, that identify the format
+	Extensions() []string
+	// Sniff reports whether the leading bytes of a file look like this format
+	Sniff(head []byte) bool
+	Decode(r io.Reader, videoId string) ([]CaptionEntry, error)
+}
+
+// Registry holds the caption formats the parser can decode
+type Registry struct {
+	mu      sync.RWMutex
+	formats []Format
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+var defaultRegistry = NewRegistry()
+
+// DefaultRegistry returns the registry that the built-in formats register themselves with
+func DefaultRegistry() *Registry {
+	return defaultRegistry
+}
+
+// RegisterFormat adds a format to the default registry
+func RegisterFormat(f Format) {
+	defaultRegistry.Register(f)
+}
+
+// Register adds a format, replacing any existing format with the same name
+func (r *Registry) Register(f Format) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, existing := range r.formats {
+		if existing.Name() == f.Name() {
+			r.formats[i] = f
+			return
+		}
+	}
+	r.formats = append(r.formats, f)
+}
+
+// Extensions returns the file extensions of every registered format
+func (r *Registry) Extensions() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var exts []string
+	for _, f := range r.formats {
+		exts = append(exts, f.Extensions()...)
+	}
+	return exts
+}
+
+// ByName looks up a format by its name
+func (r *Registry) ByName(name string) (Format, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, f := range r.formats {
+		if f.Name() == name {
+			return f, true
+		}
+	}
+	return nil, false
+}
+
+// ByExtension looks up a format by the extension of path
+func (r *Registry) ByExtension(path string) (Format, bool) {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == "" {
+		return nil, false
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, f := range r.formats {
+		for _, fext := range f.Extensions() {
+			if fext == ext {
+				return f, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// Sniff returns the first format that recognises the leading bytes of a file
+func (r *Registry) Sniff(head []byte) (Format, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, f := range r.formats {
+		if f.Sniff(head) {
+			return f, true
+		}
+	}
+	return nil, false
+}
+
+// Detect picks a format from the file extension, falling back to sniffing the content
+func (r *Registry) Detect(path string, head []byte) (Format, error) {
+	if f, ok := r.ByExtension(path); ok {
+		return f, nil
+	}
+	if f, ok := r.Sniff(head); ok {
+		return f, nil
+	}
+	return nil, fmt.Errorf("unrecognised caption format for %s", path)
+}
+
+// Decode detects the format of the named caption data and decodes it
+func (r *Registry) Decode(rd io.Reader, name, videoId string) ([]CaptionEntry, error) {
+
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(rd, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, fmt.Errorf("failed to read caption data: %w", err)
+	}
+	head = head[:n]
+
+	format, err := r.Detect(name, head)
+	if err != nil {
+		return nil, err
+	}
+
+	captions, err := format.Decode(io.MultiReader(bytes.NewReader(head), rd), videoId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s captions: %w", format.Name(), err)
+	}
+	return captions, nil
+}
+
+// appendWords splits a chunk of text into words that all start at the given time
+func appendWords(words []Word, chunk string, at TimeMs) []Word {
+	for _, w := range strings.Fields(chunk) {
+		words = append(words, Word{Start: at, Text: w})
+	}
+	return words
+}
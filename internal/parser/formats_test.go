@@ -0,0 +1,152 @@
+package parser
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestParseFileFormats(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		input string
+		want  []CaptionEntry
+	}{
+		{
+			name:  "SubRip",
+			input: "testdata/sample.srt",
+			want: []CaptionEntry{
+				{VideoId: "SampleVideoId", Start: 0, End: 5000, Text: "SampleText1"},
+				{VideoId: "SampleVideoId", Start: 6000, End: 10000, Text: "Sample Text2\nsecond line"},
+			},
+		},
+		{
+			name:  "TTML",
+			input: "testdata/sample.ttml",
+			want: []CaptionEntry{
+				{VideoId: "SampleVideoId", Start: 0, End: 5000, Text: "SampleText1"},
+				{VideoId: "SampleVideoId", Start: 6000, End: 10000, Text: "Sample Text2\nsecond line"},
+			},
+		},
+		{
+			name:  "json3",
+			input: "testdata/sample.json3",
+			want: []CaptionEntry{
+				{VideoId: "SampleVideoId", Start: 0, End: 5000, Text: "SampleText1"},
+				{VideoId: "SampleVideoId", Start: 6000, End: 10000, Text: "Sample Text2", Words: []Word{
+					{Start: 6000, Text: "Sample"},
+					{Start: 6500, Text: "Text2"},
+				}},
+			},
+		},
+		{
+			name:  "srv3",
+			input: "testdata/sample.srv3",
+			want: []CaptionEntry{
+				{VideoId: "SampleVideoId", Start: 0, End: 5000, Text: "SampleText1"},
+				{VideoId: "SampleVideoId", Start: 6000, End: 10000, Text: "Sample Text2", Words: []Word{
+					{Start: 6000, Text: "Sample"},
+					{Start: 6500, Text: "Text2"},
+				}},
+			},
+		},
+	}
+
+	parserService := NewParserService()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parserService.ParseFile(tt.input, "SampleVideoId")
+			if err != nil {
+				t.Fatalf("ParseFile failed: %v", err)
+			}
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("expected %d entries, got %d: %+v", len(tt.want), len(got), got)
+			}
+			for i, entry := range got {
+				if !reflect.DeepEqual(entry, tt.want[i]) {
+					t.Fatalf("parsed entry does not match expected:\nreceived: %+v\nexpected: %+v", entry, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRegistrySniff(t *testing.T) {
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{input: "testdata/sample.vtt", want: "vtt"},
+		{input: "testdata/sample.srt", want: "srt"},
+		{input: "testdata/sample.ttml", want: "ttml"},
+		{input: "testdata/sample.json3", want: "json3"},
+		{input: "testdata/sample.srv3", want: "srv3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			data, err := os.ReadFile(tt.input)
+			if err != nil {
+				t.Fatalf("failed to read %s: %v", tt.input, err)
+			}
+
+			// Decode without a usable name so the format must come from the content
+			got, err := DefaultRegistry().Decode(bytes.NewReader(data), "captions", "SampleVideoId")
+			if err != nil {
+				t.Fatalf("Decode failed: %v", err)
+			}
+			if len(got) == 0 {
+				t.Fatalf("expected entries from sniffed %s data", tt.want)
+			}
+
+			format, ok := DefaultRegistry().Sniff(data)
+			if !ok || format.Name() != tt.want {
+				t.Fatalf("expected sniffed format %s, got %v", tt.want, format)
+			}
+		})
+	}
+}
+
+func TestRegistryUnknownFormat(t *testing.T) {
+	_, err := DefaultRegistry().Decode(bytes.NewReader([]byte("just some text")), "captions.txt", "SampleVideoId")
+	if err == nil {
+		t.Fatalf("expected an error for unrecognised data, got nil")
+	}
+}
+
+func TestParseTTMLTime(t *testing.T) {
+
+	timing := ttmlTiming{frameRate: 25, tickRate: 10000000}
+
+	tests := []struct {
+		input   string
+		want    TimeMs
+		wantErr bool
+	}{
+		{input: "00:00:01.500", want: 1500},
+		{input: "01:00:00:05", want: 3600200},
+		{input: "1.5s", want: 1500},
+		{input: "250ms", want: 250},
+		{input: "2m", want: 120000},
+		{input: "10f", want: 400},
+		{input: "15000000t", want: 1500},
+		{input: "soon", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := parseTTMLTime(tt.input, timing)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error = %v, got %v", tt.wantErr, err)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("expected %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
@@ -10,12 +10,23 @@ import (
 
 type Parser interface {
 	ParseJSON(jsonFile string) ([]CaptionEntry, error)
+	ParseVTT(vttFile, videoId string) ([]CaptionEntry, error)
+	ParseFile(captionFile, videoId string) ([]CaptionEntry, error)
 }
 
-type ParserService struct{}
+type ParserService struct {
+	formats *Registry
+}
 
+// NewParserService returns a ParserService that decodes every format in the default registry
 func NewParserService() *ParserService {
-	return &ParserService{}
+	return NewParserServiceWithRegistry(DefaultRegistry())
+}
+
+func NewParserServiceWithRegistry(formats *Registry) *ParserService {
+	return &ParserService{
+		formats: formats,
+	}
 }
 
 func (s *ParserService) ParseJSON(jsonFile string) ([]CaptionEntry, error) {
@@ -37,3 +48,42 @@ func (s *ParserService) ParseJSON(jsonFile string) ([]CaptionEntry, error) {
 	}
 	return captions, nil
 }
+
+func (s *ParserService) ParseVTT(vttFile, videoId string) ([]CaptionEntry, error) {
+
+	if !cmdutil.FileExists(vttFile) {
+		return nil, fmt.Errorf("VTT caption file not found at %s", vttFile)
+	}
+
+	f, err := os.Open(vttFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open VTT file %s: %w", vttFile, err)
+	}
+	defer f.Close()
+
+	captions, err := ParseVTT(f, videoId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse VTT data from %s: %w", vttFile, err)
+	}
+	return captions, nil
+}
+
+// ParseFile decodes a caption file of any registered format, chosen by its extension or by sniffing its content
+func (s *ParserService) ParseFile(captionFile, videoId string) ([]CaptionEntry, error) {
+
+	if !cmdutil.FileExists(captionFile) {
+		return nil, fmt.Errorf("caption file not found at %s", captionFile)
+	}
+
+	f, err := os.Open(captionFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open caption file %s: %w", captionFile, err)
+	}
+	defer f.Close()
+
+	captions, err := s.formats.Decode(f, captionFile, videoId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", captionFile, err)
+	}
+	return captions, nil
+}
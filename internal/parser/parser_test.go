@@ -2,6 +2,7 @@ package parser
 
 import (
 	"fmt"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -35,7 +36,7 @@ func TestParseJSON(t *testing.T) {
 	}
 
 	for i, entry := range got {
-		if entry != want[i] {
+		if !reflect.DeepEqual(entry, want[i]) {
 			t.Fatalf("ParseJSON failed: parsed entry does not match expected:\nreceived: %+v\nexpected: %+v", entry, want[i])
 		}
 	}
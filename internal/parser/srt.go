@@ -0,0 +1,139 @@
+package parser
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// srtOverridePattern matches ASS style overrides such as {\an8} that some SubRip files carry
+var srtOverridePattern = regexp.MustCompile(`\{\\[^}]*\}`)
+
+func init() {
+	RegisterFormat(srtFormat{})
+}
+
+// srtFormat decodes SubRip (.srt) files
+type srtFormat struct{}
+
+func (srtFormat) Name() string {
+	return "srt"
+}
+
+func (srtFormat) Extensions() []string {
+	return []string{".srt"}
+}
+
+// Sniff looks for a numeric cue index followed by a timing line using a comma before the milliseconds
+func (srtFormat) Sniff(head []byte) bool {
+	head = bytes.TrimPrefix(head, []byte("\ufeff"))
+	lines := strings.Split(strings.ReplaceAll(string(head), "\r\n", "\n"), "\n")
+
+	i := 0
+	for i < len(lines) && strings.TrimSpace(lines[i]) == "" {
+		i++
+	}
+	if i+1 >= len(lines) {
+		return false
+	}
+	if _, err := strconv.Atoi(strings.TrimSpace(lines[i])); err != nil {
+		return false
+	}
+	timing := lines[i+1]
+	return strings.Contains(timing, vttTimingSeparator) && strings.Contains(timing, ",")
+}
+
+func (srtFormat) Decode(r io.Reader, videoId string) ([]CaptionEntry, error) {
+	return ParseSRT(r, videoId)
+}
+
+// ParseSRT reads a SubRip document and returns one CaptionEntry per cue
+func ParseSRT(r io.Reader, videoId string) ([]CaptionEntry, error) {
+
+	lines, err := readCaptionLines(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var captions []CaptionEntry
+
+	i := 0
+	for i < len(lines) {
+		if strings.TrimSpace(lines[i]) == "" {
+			i++
+			continue
+		}
+
+		start := i
+		for i < len(lines) && strings.TrimSpace(lines[i]) != "" {
+			i++
+		}
+		block := lines[start:i]
+
+		// The numeric index is optional in practice, so only skip it when the timing line follows
+		timingIdx := 0
+		if !strings.Contains(block[0], vttTimingSeparator) {
+			timingIdx = 1
+		}
+		if timingIdx >= len(block) || !strings.Contains(block[timingIdx], vttTimingSeparator) {
+			return nil, fmt.Errorf("line %d: expected cue timings", start+timingIdx+1)
+		}
+
+		cueStart, cueEnd, err := parseSRTTimings(block[timingIdx])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", start+timingIdx+1, err)
+		}
+
+		payload := make([]string, 0, len(block)-timingIdx-1)
+		for _, line := range block[timingIdx+1:] {
+			payload = append(payload, srtOverridePattern.ReplaceAllString(line, ""))
+		}
+
+		text := cleanCuePayload(payload)
+		if text == "" {
+			continue
+		}
+
+		captions = append(captions, CaptionEntry{
+			VideoId: videoId,
+			Start:   cueStart,
+			End:     cueEnd,
+			Text:    text,
+		})
+	}
+
+	return captions, nil
+}
+
+// parseSRTTimings parses a "00:00:01,000 --> 00:00:02,000" line, ignoring any trailing coordinates
+func parseSRTTimings(line string) (TimeMs, TimeMs, error) {
+
+	startStr, rest, _ := strings.Cut(line, vttTimingSeparator)
+
+	fields := strings.Fields(rest)
+	if len(fields) == 0 {
+		return 0, 0, errors.New("missing cue end time")
+	}
+
+	start, err := parseSRTTimestamp(strings.TrimSpace(startStr))
+	if err != nil {
+		return 0, 0, err
+	}
+	end, err := parseSRTTimestamp(fields[0])
+	if err != nil {
+		return 0, 0, err
+	}
+	if end < start {
+		return 0, 0, fmt.Errorf("cue ends (%s) before it starts (%s)", fields[0], strings.TrimSpace(startStr))
+	}
+	return start, end, nil
+}
+
+// parseSRTTimestamp accepts both the standard comma and the dot some encoders write before the milliseconds
+func parseSRTTimestamp(s string) (TimeMs, error) {
+	return ParseTimestamp(strings.Replace(s, ",", ".", 1))
+}
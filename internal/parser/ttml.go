@@ -0,0 +1,284 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	ttmlDefaultFrameRate = 30
+	ttmlDefaultTickRate  = 1
+)
+
+var ttmlWhitespaceReplacer = strings.NewReplacer("\r", " ", "\n", " ", "\t", " ")
+
+func init() {
+	RegisterFormat(ttmlFormat{})
+}
+
+// ttmlFormat decodes TTML and its DFXP predecessor
+type ttmlFormat struct{}
+
+func (ttmlFormat) Name() string {
+	return "ttml"
+}
+
+func (ttmlFormat) Extensions() []string {
+	return []string{".ttml", ".dfxp", ".xml"}
+}
+
+func (ttmlFormat) Sniff(head []byte) bool {
+	return bytes.Contains(head, []byte("<tt")) &&
+		(bytes.Contains(head, []byte("http://www.w3.org/ns/ttml")) || bytes.Contains(head, []byte("http://www.w3.org/2006/10/ttaf1")))
+}
+
+func (ttmlFormat) Decode(r io.Reader, videoId string) ([]CaptionEntry, error) {
+	return ParseTTML(r, videoId)
+}
+
+// ttmlTiming carries the timing parameters declared on the root <tt> element
+type ttmlTiming struct {
+	frameRate float64
+	tickRate  float64
+}
+
+// ParseTTML reads a TTML/DFXP document and returns one CaptionEntry per <p> element.
+// Begin times declared on enclosing <body> and <div> elements offset the paragraphs they contain.
+func ParseTTML(r io.Reader, videoId string) ([]CaptionEntry, error) {
+
+	decoder := xml.NewDecoder(r)
+	decoder.Strict = false
+
+	timing := ttmlTiming{frameRate: ttmlDefaultFrameRate, tickRate: ttmlDefaultTickRate}
+
+	var captions []CaptionEntry
+
+	// Offsets of the enclosing timed containers, innermost last
+	offsets := []TimeMs{0}
+
+	var inParagraph bool
+	var text strings.Builder
+	var cueStart, cueEnd TimeMs
+
+	for {
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read TTML: %w", err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "tt":
+				timing, err = parseTTMLTimingParams(t)
+				if err != nil {
+					return nil, err
+				}
+			case "body", "div":
+				begin, err := parseTTMLAttrTime(t, "begin", timing)
+				if err != nil {
+					return nil, err
+				}
+				offsets = append(offsets, offsets[len(offsets)-1]+begin)
+			case "p":
+				inParagraph = true
+				text.Reset()
+				cueStart, cueEnd, err = parseTTMLParagraphTimes(t, offsets[len(offsets)-1], timing)
+				if err != nil {
+					return nil, err
+				}
+			case "br":
+				if inParagraph {
+					text.WriteString("\n")
+				}
+			}
+
+		case xml.CharData:
+			// Line breaks in the markup are only indentation, real breaks come from <br/>
+			if inParagraph {
+				text.WriteString(ttmlWhitespaceReplacer.Replace(string(t)))
+			}
+
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "body", "div":
+				if len(offsets) > 1 {
+					offsets = offsets[:len(offsets)-1]
+				}
+			case "p":
+				inParagraph = false
+				content := normalizeCaptionText(text.String())
+				if content == "" {
+					continue
+				}
+				captions = append(captions, CaptionEntry{
+					VideoId: videoId,
+					Start:   cueStart,
+					End:     cueEnd,
+					Text:    content,
+				})
+			}
+		}
+	}
+
+	return captions, nil
+}
+
+func parseTTMLTimingParams(el xml.StartElement) (ttmlTiming, error) {
+	timing := ttmlTiming{frameRate: ttmlDefaultFrameRate, tickRate: ttmlDefaultTickRate}
+
+	for _, attr := range el.Attr {
+		switch attr.Name.Local {
+		case "frameRate":
+			rate, err := strconv.ParseFloat(attr.Value, 64)
+			if err != nil || rate <= 0 {
+				return timing, fmt.Errorf("invalid frameRate %q", attr.Value)
+			}
+			timing.frameRate = rate
+		case "tickRate":
+			rate, err := strconv.ParseFloat(attr.Value, 64)
+			if err != nil || rate <= 0 {
+				return timing, fmt.Errorf("invalid tickRate %q", attr.Value)
+			}
+			timing.tickRate = rate
+		}
+	}
+	return timing, nil
+}
+
+func parseTTMLParagraphTimes(el xml.StartElement, offset TimeMs, timing ttmlTiming) (TimeMs, TimeMs, error) {
+
+	begin, err := parseTTMLAttrTime(el, "begin", timing)
+	if err != nil {
+		return 0, 0, err
+	}
+	start := offset + begin
+
+	if attrValue(el, "end") != "" {
+		end, err := parseTTMLAttrTime(el, "end", timing)
+		if err != nil {
+			return 0, 0, err
+		}
+		return start, offset + end, nil
+	}
+
+	if attrValue(el, "dur") != "" {
+		dur, err := parseTTMLAttrTime(el, "dur", timing)
+		if err != nil {
+			return 0, 0, err
+		}
+		return start, start + dur, nil
+	}
+
+	return 0, 0, errors.New("paragraph has neither an end nor a dur attribute")
+}
+
+func parseTTMLAttrTime(el xml.StartElement, name string, timing ttmlTiming) (TimeMs, error) {
+	value := attrValue(el, name)
+	if value == "" {
+		return 0, nil
+	}
+	t, err := parseTTMLTime(value, timing)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s on <%s>: %w", name, el.Name.Local, err)
+	}
+	return t, nil
+}
+
+func attrValue(el xml.StartElement, name string) string {
+	for _, attr := range el.Attr {
+		if attr.Name.Local == name {
+			return strings.TrimSpace(attr.Value)
+		}
+	}
+	return ""
+}
+
+// parseTTMLTime parses a TTML time expression, either a clock time (hh:mm:ss[.fff] or hh:mm:ss:ff)
+// or an offset time such as 1.5s, 1500ms, 2m, 1h, 12f or 10000t
+func parseTTMLTime(s string, timing ttmlTiming) (TimeMs, error) {
+
+	if strings.Contains(s, ":") {
+		return parseTTMLClockTime(s, timing)
+	}
+
+	units := []struct {
+		suffix string
+		ms     float64
+	}{
+		{"ms", 1},
+		{"h", 3600000},
+		{"m", 60000},
+		{"s", 1000},
+		{"f", 1000 / timing.frameRate},
+		{"t", 1000 / timing.tickRate},
+	}
+
+	for _, unit := range units {
+		if !strings.HasSuffix(s, unit.suffix) {
+			continue
+		}
+		value, err := strconv.ParseFloat(strings.TrimSuffix(s, unit.suffix), 64)
+		if err != nil || value < 0 {
+			return 0, fmt.Errorf("invalid time expression %q", s)
+		}
+		return TimeMs(math.Round(value * unit.ms)), nil
+	}
+
+	return 0, fmt.Errorf("invalid time expression %q", s)
+}
+
+func parseTTMLClockTime(s string, timing ttmlTiming) (TimeMs, error) {
+
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 && len(parts) != 4 {
+		return 0, fmt.Errorf("invalid clock time %q", s)
+	}
+
+	hours, err := strconv.Atoi(parts[0])
+	if err != nil || hours < 0 {
+		return 0, fmt.Errorf("invalid clock time %q", s)
+	}
+	minutes, err := strconv.Atoi(parts[1])
+	if err != nil || minutes < 0 || minutes > 59 {
+		return 0, fmt.Errorf("invalid clock time %q", s)
+	}
+	seconds, err := strconv.ParseFloat(parts[2], 64)
+	if err != nil || seconds < 0 || seconds >= 60 {
+		return 0, fmt.Errorf("invalid clock time %q", s)
+	}
+
+	ms := float64((hours*60+minutes)*60)*1000 + seconds*1000
+
+	// A fourth component counts frames
+	if len(parts) == 4 {
+		frames, err := strconv.ParseFloat(parts[3], 64)
+		if err != nil || frames < 0 {
+			return 0, fmt.Errorf("invalid clock time %q", s)
+		}
+		ms += frames * 1000 / timing.frameRate
+	}
+
+	return TimeMs(math.Round(ms)), nil
+}
+
+// normalizeCaptionText collapses runs of spaces on each line and drops empty lines
+func normalizeCaptionText(s string) string {
+	var lines []string
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.Join(strings.Fields(line), " ")
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
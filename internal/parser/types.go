@@ -1,16 +1,26 @@
 package parser
 
 import (
+	"fmt"
 	"strings"
 	"time"
 )
 
 type TimeMs uint32
 type CaptionEntry struct {
-	VideoId string `json:"video_id"`
-	Start   TimeMs `json:"start"`
-	End     TimeMs `json:"end"`
-	Text    string `json:"text"`
+	VideoId  string `json:"video_id"`
+	Language string `json:"language,omitempty"`
+	Start    TimeMs `json:"start"`
+	End      TimeMs `json:"end"`
+	Text     string `json:"text"`
+	// Words holds per-word timings when the source format carries them
+	Words []Word `json:"words,omitempty"`
+}
+
+// Word is a single spoken word and the time it starts
+type Word struct {
+	Start TimeMs `json:"start"`
+	Text  string `json:"text"`
 }
 
 func (t *TimeMs) UnmarshalJSON(data []byte) error {
@@ -31,3 +41,9 @@ func (t *TimeMs) UnmarshalJSON(data []byte) error {
 
 	return nil
 }
+
+// String formats the time as HH:MM:SS.mmm, the same layout UnmarshalJSON accepts
+func (t TimeMs) String() string {
+	ms := uint32(t)
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
@@ -56,3 +56,19 @@ func TestUnmarshalJSON(t *testing.T) {
 	}
 
 }
+
+func TestTimeMsString(t *testing.T) {
+
+	var ts TimeMs = 1*(60*60*1000) + 2*(60*1000) + 3*1000 + 4
+
+	if got := ts.String(); got != "01:02:03.004" {
+		t.Fatalf("expected %s, got %s", "01:02:03.004", got)
+	}
+
+	// String output must round trip through UnmarshalJSON
+	var parsed TimeMs
+	err := parsed.UnmarshalJSON([]byte(`"` + ts.String() + `"`))
+	if err != nil || parsed != ts {
+		t.Fatalf("expected %d to round trip, got %d (err: %v)", ts, parsed, err)
+	}
+}
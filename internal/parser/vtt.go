@@ -0,0 +1,343 @@
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const vttTimingSeparator = "-->"
+
+func init() {
+	RegisterFormat(vttFormat{})
+}
+
+// vttFormat decodes WebVTT files
+type vttFormat struct{}
+
+func (vttFormat) Name() string {
+	return "vtt"
+}
+
+func (vttFormat) Extensions() []string {
+	return []string{".vtt"}
+}
+
+func (vttFormat) Sniff(head []byte) bool {
+	head = bytes.TrimPrefix(head, []byte("\ufeff"))
+	line, _, _ := bytes.Cut(head, []byte("\n"))
+	return isVTTSignature(strings.TrimRight(string(line), "\r"))
+}
+
+func (vttFormat) Decode(r io.Reader, videoId string) ([]CaptionEntry, error) {
+	return ParseVTT(r, videoId)
+}
+
+var (
+	cueTagPattern = regexp.MustCompile(`<[^>]*>`)
+
+	vttTimestampTagPattern = regexp.MustCompile(`<((?:\d+:)?\d{2}:\d{2}\.\d{3})>`)
+
+	cueEntityReplacer = strings.NewReplacer(
+		"&amp;", "&",
+		"&lt;", "<",
+		"&gt;", ">",
+		"&nbsp;", " ",
+		"&lrm;", "\u200e",
+		"&rlm;", "\u200f",
+	)
+)
+
+// ParseVTT reads a WebVTT document and returns one CaptionEntry per cue.
+// Header, NOTE, STYLE and REGION blocks are skipped, cue identifiers and cue
+// settings are discarded, and multi-line payloads are joined with newlines.
+// Malformed cue blocks are logged and skipped as the WebVTT spec asks, the
+// document only fails if none of its cue blocks could be read.
+func ParseVTT(r io.Reader, videoId string) ([]CaptionEntry, error) {
+
+	lines, err := readCaptionLines(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(lines) == 0 || !isVTTSignature(lines[0]) {
+		return nil, errors.New("missing WEBVTT signature")
+	}
+
+	// Skip the rest of the header, which ends at the first blank line
+	i := 1
+	for i < len(lines) && lines[i] != "" {
+		i++
+	}
+
+	var captions []CaptionEntry
+	var firstErr error
+	skipped := 0
+
+	for i < len(lines) {
+		// Skip blank lines between blocks
+		if lines[i] == "" {
+			i++
+			continue
+		}
+
+		// Collect the block
+		start := i
+		for i < len(lines) && lines[i] != "" {
+			i++
+		}
+		block := lines[start:i]
+
+		if isVTTMetadataBlock(block[0]) {
+			continue
+		}
+
+		timingIdx, cueStart, cueEnd, err := parseVTTCueTimings(block, start)
+		if err != nil {
+			log.Printf("Skipping malformed cue block of video %s: %v", videoId, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			skipped++
+			continue
+		}
+
+		text := cleanCuePayload(block[timingIdx+1:])
+		if text == "" {
+			continue
+		}
+
+		captions = append(captions, CaptionEntry{
+			VideoId: videoId,
+			Start:   cueStart,
+			End:     cueEnd,
+			Text:    text,
+			Words:   parseVTTWords(block[timingIdx+1:], cueStart),
+		})
+	}
+
+	if len(captions) == 0 && skipped > 0 {
+		return nil, fmt.Errorf("no readable cues, skipped %d malformed blocks: %w", skipped, firstErr)
+	}
+	return captions, nil
+}
+
+// parseVTTCueTimings finds the timing line of a cue block starting at line start, after an
+// optional cue identifier, and returns its index in the block and the cue's times
+func parseVTTCueTimings(block []string, start int) (int, TimeMs, TimeMs, error) {
+
+	timingIdx := 0
+	if !strings.Contains(block[0], vttTimingSeparator) {
+		timingIdx = 1
+	}
+	if timingIdx >= len(block) || !strings.Contains(block[timingIdx], vttTimingSeparator) {
+		return 0, 0, 0, fmt.Errorf("line %d: expected cue timings", start+timingIdx+1)
+	}
+
+	cueStart, cueEnd, err := parseVTTTimings(block[timingIdx])
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("line %d: %w", start+timingIdx+1, err)
+	}
+	return timingIdx, cueStart, cueEnd, nil
+}
+
+// parseVTTWords extracts per-word timings from payload lines carrying inline <hh:mm:ss.ttt> tags.
+// Text before the first tag on a line starts with the cue. Lines without any timestamp tag are
+// repeats of earlier text in YouTube's rolling auto-captions, so they contribute no words.
+func parseVTTWords(payload []string, cueStart TimeMs) []Word {
+	var words []Word
+	for _, line := range payload {
+		locs := vttTimestampTagPattern.FindAllStringSubmatchIndex(line, -1)
+		if len(locs) == 0 {
+			continue
+		}
+
+		at := cueStart
+		prev := 0
+		for _, loc := range locs {
+			words = appendWords(words, cleanCueText(line[prev:loc[0]]), at)
+			ts, err := ParseTimestamp(line[loc[2]:loc[3]])
+			if err == nil {
+				at = ts
+			}
+			prev = loc[1]
+		}
+		words = appendWords(words, cleanCueText(line[prev:]), at)
+	}
+	return words
+}
+
+func readCaptionLines(r io.Reader) ([]string, error) {
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	scanner.Split(scanCaptionLines)
+
+	var lines []string
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read caption data: %w", err)
+	}
+
+	if len(lines) > 0 {
+		lines[0] = strings.TrimPrefix(lines[0], "\ufeff")
+	}
+	return lines, nil
+}
+
+// scanCaptionLines splits on LF, CRLF and lone CR line terminators
+func scanCaptionLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	for i, b := range data {
+		switch b {
+		case '\n':
+			return i + 1, data[:i], nil
+		case '\r':
+			if i+1 < len(data) {
+				if data[i+1] == '\n' {
+					return i + 2, data[:i], nil
+				}
+				return i + 1, data[:i], nil
+			}
+			if atEOF {
+				return i + 1, data[:i], nil
+			}
+			// Need more data to know whether a \n follows
+			return 0, nil, nil
+		}
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+func isVTTSignature(line string) bool {
+	if !strings.HasPrefix(line, "WEBVTT") {
+		return false
+	}
+	rest := line[len("WEBVTT"):]
+	return rest == "" || rest[0] == ' ' || rest[0] == '\t'
+}
+
+func isVTTMetadataBlock(line string) bool {
+	for _, keyword := range []string{"NOTE", "STYLE", "REGION"} {
+		if line == keyword || strings.HasPrefix(line, keyword+" ") || strings.HasPrefix(line, keyword+"\t") {
+			return true
+		}
+	}
+	return false
+}
+
+// parseVTTTimings parses a "start --> end [settings]" line, ignoring any cue settings
+func parseVTTTimings(line string) (TimeMs, TimeMs, error) {
+
+	startStr, rest, _ := strings.Cut(line, vttTimingSeparator)
+
+	fields := strings.Fields(rest)
+	if len(fields) == 0 {
+		return 0, 0, errors.New("missing cue end time")
+	}
+
+	start, err := ParseTimestamp(strings.TrimSpace(startStr))
+	if err != nil {
+		return 0, 0, err
+	}
+	end, err := ParseTimestamp(fields[0])
+	if err != nil {
+		return 0, 0, err
+	}
+	if end < start {
+		return 0, 0, fmt.Errorf("cue ends (%s) before it starts (%s)", fields[0], strings.TrimSpace(startStr))
+	}
+	return start, end, nil
+}
+
+// ParseTimestamp parses a WebVTT timestamp of the form [hh:]mm:ss.ttt
+func ParseTimestamp(s string) (TimeMs, error) {
+
+	clock, frac, ok := strings.Cut(s, ".")
+	if !ok || len(frac) != 3 {
+		return 0, fmt.Errorf("invalid timestamp %q", s)
+	}
+
+	parts := strings.Split(clock, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, fmt.Errorf("invalid timestamp %q", s)
+	}
+
+	var hours, minutes, seconds, millis int
+	idx := 0
+	if len(parts) == 3 {
+		hours, ok = timestampField(parts[0], 0)
+		if !ok {
+			return 0, fmt.Errorf("invalid hours in timestamp %q", s)
+		}
+		if hours > math.MaxUint32/(60*60*1000) {
+			return 0, fmt.Errorf("timestamp %q is too large", s)
+		}
+		idx = 1
+	}
+
+	minutes, ok = timestampField(parts[idx], 2)
+	if !ok || minutes > 59 {
+		return 0, fmt.Errorf("invalid minutes in timestamp %q", s)
+	}
+	seconds, ok = timestampField(parts[idx+1], 2)
+	if !ok || seconds > 59 {
+		return 0, fmt.Errorf("invalid seconds in timestamp %q", s)
+	}
+	millis, ok = timestampField(frac, 3)
+	if !ok {
+		return 0, fmt.Errorf("invalid milliseconds in timestamp %q", s)
+	}
+
+	total := ((int64(hours)*60+int64(minutes))*60+int64(seconds))*1000 + int64(millis)
+	if total > math.MaxUint32 {
+		return 0, fmt.Errorf("timestamp %q is too large", s)
+	}
+	return TimeMs(total), nil
+}
+
+// timestampField parses a field of a timestamp, which must be ASCII digits only, exactly width
+// of them unless width is 0
+func timestampField(s string, width int) (int, bool) {
+	if s == "" || (width > 0 && len(s) != width) {
+		return 0, false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return 0, false
+		}
+	}
+	n, err := strconv.Atoi(s)
+	return n, err == nil
+}
+
+// cleanCuePayload strips cue markup and entities, joining lines with newlines.
+// It is shared by the line based formats (WebVTT and SubRip).
+func cleanCuePayload(payload []string) string {
+	var lines []string
+	for _, line := range payload {
+		line = strings.TrimSpace(cleanCueText(line))
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func cleanCueText(s string) string {
+	return cueEntityReplacer.Replace(cueTagPattern.ReplaceAllString(s, ""))
+}
@@ -0,0 +1,192 @@
+package parser
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseVTT(t *testing.T) {
+
+	want := []CaptionEntry{
+		{
+			VideoId: "SampleVideoId",
+			Start:   0,
+			End:     5000,
+			Text:    "SampleText1",
+		},
+		{
+			VideoId: "SampleVideoId",
+			Start:   6000,
+			End:     10000,
+			Text:    "Sample & Text2\nsecond line",
+		},
+		{
+			VideoId: "SampleVideoId",
+			Start:   1*(60*60*1000) + 500,
+			End:     1*(60*60*1000) + 1250,
+			Text:    "Last cue",
+		},
+	}
+	inpFile := "testdata/sample.vtt"
+	parserService := NewParserService()
+
+	got, err := parserService.ParseVTT(inpFile, "SampleVideoId")
+	if err != nil {
+		t.Fatalf("ParseVTT failed: %v", err)
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("ParseVTT failed: expected %d entries, got %d: %+v", len(want), len(got), got)
+	}
+
+	for i, entry := range got {
+		if !reflect.DeepEqual(entry, want[i]) {
+			t.Fatalf("ParseVTT failed: parsed entry does not match expected:\nreceived: %+v\nexpected: %+v", entry, want[i])
+		}
+	}
+}
+
+func TestParseVTTCRLF(t *testing.T) {
+	parserService := NewParserService()
+
+	got, err := parserService.ParseVTT("testdata/crlf.vtt", "SampleVideoId")
+	if err != nil {
+		t.Fatalf("ParseVTT failed: %v", err)
+	}
+
+	want := CaptionEntry{VideoId: "SampleVideoId", Start: 1000, End: 2000, Text: "CRLF cue"}
+	if len(got) != 1 || !reflect.DeepEqual(got[0], want) {
+		t.Fatalf("ParseVTT failed: expected [%+v], got %+v", want, got)
+	}
+}
+
+func TestParseVTTFileDoesNotExist(t *testing.T) {
+	inpFile := "testdata/does_not_exist.vtt"
+	parserService := NewParserService()
+
+	_, err := parserService.ParseVTT(inpFile, "SampleVideoId")
+	if err == nil {
+		t.Fatalf("TestParseVTTFileDoesNotExist failed: expected an error, got nil")
+	}
+
+	expected := fmt.Sprintf("VTT caption file not found at %s", inpFile)
+	if !strings.Contains(err.Error(), expected) {
+		t.Fatalf("TestParseVTTFileDoesNotExist failed: expected error to contain %s, but got %s", expected, err.Error())
+	}
+}
+
+func TestParseVTTBadTimestamp(t *testing.T) {
+	inpFile := "testdata/badsample.vtt"
+	parserService := NewParserService()
+
+	_, err := parserService.ParseVTT(inpFile, "SampleVideoId")
+	if err == nil {
+		t.Fatalf("TestParseVTTBadTimestamp failed: expected an error, got nil")
+	}
+
+	// A file with nothing but malformed cues fails with the first problem
+	expected := "line 3: invalid seconds in timestamp \"00:00:xx.000\""
+	if !strings.Contains(err.Error(), expected) {
+		t.Fatalf("TestParseVTTBadTimestamp failed: expected error to contain \"%s\", but got \"%s\"", expected, err.Error())
+	}
+}
+
+func TestParseVTTSkipsMalformedCues(t *testing.T) {
+
+	input := "WEBVTT\n\n" +
+		"00:00:01.000 --> 00:00:02.000\nfirst\n\n" +
+		"an identifier without timings\nlost text\n\n" +
+		"00:00:05.000 --> 00:00:04.000\nends before it starts\n\n" +
+		"00:00:0x.000 --> 00:00:07.000\nbad timestamp\n\n" +
+		"00:00:08.000 --> 00:00:09.000\nlast\n"
+
+	captions, err := ParseVTT(strings.NewReader(input), "SampleVideoId")
+	if err != nil {
+		t.Fatalf("ParseVTT failed: %v", err)
+	}
+	var texts []string
+	for _, c := range captions {
+		texts = append(texts, c.Text)
+	}
+	if !reflect.DeepEqual(texts, []string{"first", "last"}) {
+		t.Fatalf("expected the well-formed cues only, got %q", texts)
+	}
+}
+
+func TestParseVTTMissingSignature(t *testing.T) {
+	_, err := ParseVTT(strings.NewReader("00:00:01.000 --> 00:00:02.000\nNo header\n"), "SampleVideoId")
+	if err == nil {
+		t.Fatalf("TestParseVTTMissingSignature failed: expected an error, got nil")
+	}
+}
+
+func TestParseTimestamp(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		input   string
+		want    TimeMs
+		wantErr bool
+	}{
+		{name: "With hours", input: "01:02:03.004", want: 3723004},
+		{name: "Without hours", input: "02:03.004", want: 123004},
+		{name: "Long hours", input: "100:00:00.000", want: 360000000},
+		{name: "Missing fraction", input: "00:00:01", wantErr: true},
+		{name: "Minutes out of range", input: "00:60:00.000", wantErr: true},
+		{name: "Garbage", input: "invalid", wantErr: true},
+		{name: "Signed minutes", input: "00:-1:00.000", wantErr: true},
+		{name: "Signed seconds", input: "00:+5.000", wantErr: true},
+		{name: "Signed hours", input: "-1:00:00.000", wantErr: true},
+		{name: "Signed milliseconds", input: "00:00.+12", wantErr: true},
+		{name: "Largest time", input: "1193:02:47.295", want: 4294967295},
+		{name: "Overflows milliseconds", input: "1193:02:47.296", wantErr: true},
+		{name: "Huge hours", input: "99999999999999999999:00:00.000", wantErr: true},
+		{name: "Hours overflowing int64", input: "9999999999999:00:00.000", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseTimestamp(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error = %v, got %v", tt.wantErr, err)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("expected %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestParseVTTWordTimings(t *testing.T) {
+
+	want := []CaptionEntry{
+		{VideoId: "SampleVideoId", Start: 0, End: 2000, Text: "hello world", Words: []Word{
+			{Start: 0, Text: "hello"},
+			{Start: 480, Text: "world"},
+		}},
+		{VideoId: "SampleVideoId", Start: 2000, End: 2010, Text: "hello world"},
+		{VideoId: "SampleVideoId", Start: 2010, End: 4000, Text: "hello world\nthis is next", Words: []Word{
+			{Start: 2010, Text: "this"},
+			{Start: 2500, Text: "is"},
+			{Start: 3000, Text: "next"},
+		}},
+	}
+
+	parserService := NewParserService()
+
+	got, err := parserService.ParseVTT("testdata/autogenerated.vtt", "SampleVideoId")
+	if err != nil {
+		t.Fatalf("ParseVTT failed: %v", err)
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("ParseVTT failed: expected %d entries, got %d: %+v", len(want), len(got), got)
+	}
+	for i, entry := range got {
+		if !reflect.DeepEqual(entry, want[i]) {
+			t.Fatalf("ParseVTT failed: parsed entry does not match expected:\nreceived: %+v\nexpected: %+v", entry, want[i])
+		}
+	}
+}
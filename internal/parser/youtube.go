@@ -0,0 +1,222 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	RegisterFormat(json3Format{})
+	RegisterFormat(srv3Format{})
+}
+
+// json3Format decodes YouTube's json3 timed text format
+type json3Format struct{}
+
+type json3Document struct {
+	Events []json3Event `json:"events"`
+}
+
+type json3Event struct {
+	TStartMs    int64          `json:"tStartMs"`
+	DDurationMs int64          `json:"dDurationMs"`
+	Segs        []json3Segment `json:"segs"`
+}
+
+type json3Segment struct {
+	Utf8      string `json:"utf8"`
+	TOffsetMs int64  `json:"tOffsetMs"`
+}
+
+func (json3Format) Name() string {
+	return "json3"
+}
+
+func (json3Format) Extensions() []string {
+	return []string{".json3"}
+}
+
+func (json3Format) Sniff(head []byte) bool {
+	head = bytes.TrimSpace(head)
+	return bytes.HasPrefix(head, []byte("{")) &&
+		(bytes.Contains(head, []byte(`"wireMagic"`)) || bytes.Contains(head, []byte(`"tStartMs"`)))
+}
+
+func (json3Format) Decode(r io.Reader, videoId string) ([]CaptionEntry, error) {
+	return ParseJSON3(r, videoId)
+}
+
+// ParseJSON3 reads a YouTube json3 document and returns one CaptionEntry per event that carries text.
+// Window and style events without segments, and the newline-only append events, are skipped.
+// Each segment's tOffsetMs, relative to its event, gives the timing of the words in it.
+func ParseJSON3(r io.Reader, videoId string) ([]CaptionEntry, error) {
+
+	var doc json3Document
+	err := json.NewDecoder(r).Decode(&doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal json3 data: %w", err)
+	}
+
+	var captions []CaptionEntry
+
+	for i, event := range doc.Events {
+		if len(event.Segs) == 0 {
+			continue
+		}
+		if event.TStartMs < 0 || event.DDurationMs < 0 {
+			return nil, fmt.Errorf("event %d has a negative start or duration", i)
+		}
+
+		var text strings.Builder
+		var words []Word
+		for _, seg := range event.Segs {
+			text.WriteString(seg.Utf8)
+			words = appendWords(words, seg.Utf8, TimeMs(event.TStartMs+seg.TOffsetMs))
+		}
+		// A single segment carries no timing beyond the event's own start
+		if len(event.Segs) == 1 {
+			words = nil
+		}
+
+		content := normalizeCaptionText(text.String())
+		if content == "" {
+			continue
+		}
+
+		captions = append(captions, CaptionEntry{
+			VideoId: videoId,
+			Start:   TimeMs(event.TStartMs),
+			End:     TimeMs(event.TStartMs + event.DDurationMs),
+			Text:    content,
+			Words:   words,
+		})
+	}
+
+	return captions, nil
+}
+
+// srv3Format decodes YouTube's srv3 XML timed text format
+type srv3Format struct{}
+
+func (srv3Format) Name() string {
+	return "srv3"
+}
+
+func (srv3Format) Extensions() []string {
+	return []string{".srv3"}
+}
+
+func (srv3Format) Sniff(head []byte) bool {
+	return bytes.Contains(head, []byte("<timedtext"))
+}
+
+func (srv3Format) Decode(r io.Reader, videoId string) ([]CaptionEntry, error) {
+	return ParseSRV3(r, videoId)
+}
+
+// ParseSRV3 reads a YouTube srv3 document and returns one CaptionEntry per <p> element.
+// Times are the t (start) and d (duration) attributes, both in milliseconds.
+func ParseSRV3(r io.Reader, videoId string) ([]CaptionEntry, error) {
+
+	decoder := xml.NewDecoder(r)
+	decoder.Strict = false
+
+	var captions []CaptionEntry
+
+	var inParagraph bool
+	var text strings.Builder
+	var cueStart, cueEnd TimeMs
+
+	// Word timings come from <s> elements, whose t attribute is relative to the enclosing <p>
+	var words []Word
+	var inSegment bool
+	var segmentStart TimeMs
+
+	for {
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read srv3: %w", err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "p":
+				start, err := parseSRV3Millis(t, "t")
+				if err != nil {
+					return nil, err
+				}
+				dur, err := parseSRV3Millis(t, "d")
+				if err != nil {
+					return nil, err
+				}
+				inParagraph = true
+				text.Reset()
+				words = nil
+				cueStart, cueEnd = start, start+dur
+			case "s":
+				offset, err := parseSRV3Millis(t, "t")
+				if err != nil {
+					return nil, err
+				}
+				inSegment = true
+				segmentStart = cueStart + offset
+			case "br":
+				if inParagraph {
+					text.WriteString("\n")
+				}
+			}
+
+		case xml.CharData:
+			if inParagraph {
+				text.Write(t)
+			}
+			if inSegment {
+				words = appendWords(words, string(t), segmentStart)
+			}
+
+		case xml.EndElement:
+			if t.Name.Local == "s" {
+				inSegment = false
+				continue
+			}
+			if t.Name.Local != "p" {
+				continue
+			}
+			inParagraph = false
+			content := normalizeCaptionText(text.String())
+			if content == "" {
+				continue
+			}
+			captions = append(captions, CaptionEntry{
+				VideoId: videoId,
+				Start:   cueStart,
+				End:     cueEnd,
+				Text:    content,
+				Words:   words,
+			})
+		}
+	}
+
+	return captions, nil
+}
+
+func parseSRV3Millis(el xml.StartElement, name string) (TimeMs, error) {
+	value := attrValue(el, name)
+	if value == "" {
+		return 0, nil
+	}
+	ms, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s attribute %q on <%s>", name, value, el.Name.Local)
+	}
+	return TimeMs(ms), nil
+}
@@ -1,59 +1,109 @@
-// Package converter provides tools to convert VTT files to desired JSON format
+// Package converter provides tools to convert caption files to desired JSON format
 package captionconverter
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
+	"os"
+	"path/filepath"
+	"strings"
 
+	parser "banditsecret/internal/parser"
 	cmdutil "banditsecret/internal/pkg/cmdutil"
 )
 
 type Converter interface {
-	ConvertVTTToJSON(vttPath, jsonPath string) error
+	ConvertToJSON(captionPath, jsonPath string) error
 }
 
 // Concrete ConverterService implements Converter
 type ConverterService struct {
-	pythonExecutable    string
-	converterScriptPath string
-	cmdRunner           cmdutil.CmdRunner
+	parser parser.Parser
+}
+
+// jsonCaption mirrors the layout parser.ParseJSON reads back, with timestamps as HH:MM:SS.mmm strings
+type jsonCaption struct {
+	VideoId  string     `json:"video_id"`
+	Language string     `json:"language,omitempty"`
+	Start    string     `json:"start"`
+	End      string     `json:"end"`
+	Text     string     `json:"text"`
+	Words    []jsonWord `json:"words,omitempty"`
+}
+
+type jsonWord struct {
+	Start string `json:"start"`
+	Text  string `json:"text"`
 }
 
 // Factory to create a concrete ConverterService
-func NewConverterService(pythonExecutable, converterScriptPath string, cmdRunner cmdutil.CmdRunner) (*ConverterService, error) {
+func NewConverterService(p parser.Parser) (*ConverterService, error) {
 
-	if pythonExecutable == "" || converterScriptPath == "" {
-		return nil, errors.New("pythonExecutable or converterScriptPath cannot be empty")
+	if p == nil {
+		return nil, errors.New("parser cannot be nil")
 	}
 
 	return &ConverterService{
-		pythonExecutable:    pythonExecutable,
-		converterScriptPath: converterScriptPath,
-		cmdRunner:           cmdRunner,
+		parser: p,
 	}, nil
 }
 
-func (cs *ConverterService) ConvertVTTToJSON(vttFilePath, jsonFilePath string) error {
+// ConvertToJSON converts a caption file in any format the parser understands
+func (cs *ConverterService) ConvertToJSON(captionFilePath, jsonFilePath string) error {
 
-	log.Printf("Attempting to convert %s to %s", vttFilePath, jsonFilePath)
+	log.Printf("Attempting to convert %s to %s", captionFilePath, jsonFilePath)
 
 	if cmdutil.FileExists(jsonFilePath) {
 		log.Printf("Json file %s already exists! Skipping download\n", jsonFilePath)
 		return nil
 	}
 
-	log.Printf("Converting VTT file: %s to JSON.", vttFilePath)
-	cmdOutput, err := cs.cmdRunner.CombinedOutput(
-		cs.pythonExecutable,
-		cs.converterScriptPath,
-		vttFilePath,
-		jsonFilePath)
+	videoId, language := captionFileParts(captionFilePath)
+	captions, err := cs.parser.ParseFile(captionFilePath, videoId)
+	if err != nil {
+		return fmt.Errorf("failed to convert captions to json: %w", err)
+	}
+
+	out := make([]jsonCaption, 0, len(captions))
+	for _, caption := range captions {
+		var words []jsonWord
+		for _, w := range caption.Words {
+			words = append(words, jsonWord{Start: w.Start.String(), Text: w.Text})
+		}
+		out = append(out, jsonCaption{
+			VideoId:  caption.VideoId,
+			Language: language,
+			Start:    caption.Start.String(),
+			End:      caption.End.String(),
+			Text:     caption.Text,
+			Words:    words,
+		})
+	}
+
+	data, err := json.MarshalIndent(out, "", "    ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal captions to json: %w", err)
+	}
+
+	err = os.MkdirAll(filepath.Dir(jsonFilePath), 0o755)
+	if err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", jsonFilePath, err)
+	}
 
+	err = os.WriteFile(jsonFilePath, data, 0o644)
 	if err != nil {
-		return fmt.Errorf("failed to run python script convert captions to json: %w\nOutput: %s", err, cmdOutput)
+		return fmt.Errorf("failed to write json file %s: %w", jsonFilePath, err)
 	}
 
-	log.Println("Done extracting captions (Python script output):", string(cmdOutput))
+	log.Printf("Done converting %d captions to %s", len(captions), jsonFilePath)
 	return nil
 }
+
+// captionFileParts extracts the video id and language from caption files named <videoId>.<lang>.<ext>
+func captionFileParts(path string) (string, string) {
+	base := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	videoId, language, _ := strings.Cut(base, ".")
+	return videoId, language
+}
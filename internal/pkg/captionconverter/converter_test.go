@@ -0,0 +1,49 @@
+package captionconverter
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	parser "banditsecret/internal/parser"
+)
+
+func TestConvertToJSONRoundTrip(t *testing.T) {
+
+	parserService := parser.NewParserService()
+	converterService, err := NewConverterService(parserService)
+	if err != nil {
+		t.Fatalf("NewConverterService failed: %v", err)
+	}
+
+	vttFile := "testdata/SampleVideoId.en.vtt"
+	jsonFile := filepath.Join(t.TempDir(), "SampleVideoId.en.json")
+
+	err = converterService.ConvertToJSON(vttFile, jsonFile)
+	if err != nil {
+		t.Fatalf("ConvertToJSON failed: %v", err)
+	}
+
+	want, err := parserService.ParseVTT(vttFile, "SampleVideoId")
+	if err != nil {
+		t.Fatalf("ParseVTT failed: %v", err)
+	}
+	// The language is taken from the <videoId>.<lang>.vtt file name
+	for i := range want {
+		want[i].Language = "en"
+	}
+
+	got, err := parserService.ParseJSON(jsonFile)
+	if err != nil {
+		t.Fatalf("ParseJSON failed: %v", err)
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("expected %d entries, got %d", len(want), len(got))
+	}
+	for i := range got {
+		if !reflect.DeepEqual(got[i], want[i]) {
+			t.Fatalf("entry %d does not match:\nreceived: %+v\nexpected: %+v", i, got[i], want[i])
+		}
+	}
+}
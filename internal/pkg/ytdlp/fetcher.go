@@ -10,60 +10,89 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
 
 	cmdutil "banditsecret/internal/pkg/cmdutil"
 )
 
+// AllLanguages requests every caption language a video has available
+const AllLanguages = "all"
+
+// DefaultLanguage is used when no caption language is requested
+const DefaultLanguage = "en"
+
 // CaptionMetadata holds metadata about a YouTube video and its captions.
 type CaptionMetadata struct {
-	VideoId     string
-	VideoTitle  string
-	Url         string
-	CaptionPath string // Path to JSON
+	VideoId    string
+	VideoTitle string
+	Url        string
+	// ChannelId and UploadDate (YYYY-MM-DD) are empty when they aren't known
+	ChannelId  string
+	UploadDate string
+}
+
+// CaptionFile is a downloaded caption file and the language it is written in
+type CaptionFile struct {
+	Language string
+	Path     string
 }
 
 type MetadataResp struct {
-	Id    string `json:"id"`
-	Title string `json:"title"`
+	Id        string `json:"id"`
+	Title     string `json:"title"`
+	ChannelId string `json:"channel_id"`
+	// UploadDate is YYYYMMDD, as yt-dlp gives it
+	UploadDate string `json:"upload_date"`
 }
 type CaptionsReq struct {
-	Url       string `json:"url"`
-	OutputDir string `json:"output_dir"`
+	Url       string   `json:"url"`
+	OutputDir string   `json:"output_dir"`
+	SubFormat string   `json:"sub_format,omitempty"`
+	Languages []string `json:"languages,omitempty"`
 }
 
 // Defines the interface to fetch youtube video data
 type YTFetcher interface {
-	GetMetadata(url, outputPath string) (*CaptionMetadata, error)
-	DownloadCaptions(videoId, url, outputDir string) (string, error)
+	GetMetadata(url string) (*CaptionMetadata, error)
+	DownloadCaptions(videoId, url, outputDir string, languages []string) ([]CaptionFile, error)
 }
 
 // Concrete implementation of YTFetcher
 type FetchYTService struct {
-	executable string
-	cmdRunner  cmdutil.CmdRunner
+	executable  string
+	captionExts []string
+	cmdRunner   cmdutil.CmdRunner
 }
 
-// Factory to return a new FetchYTService Service
-func NewFetchYTService(executable string, cmdRunner cmdutil.CmdRunner) (*FetchYTService, error) {
+// Factory to return a new FetchYTService Service.
+// captionExts lists the caption file extensions we can parse, in order of preference.
+func NewFetchYTService(executable string, captionExts []string, cmdRunner cmdutil.CmdRunner) (*FetchYTService, error) {
 
 	if executable == "" {
 		return nil, errors.New("executable cannot be empty")
 	}
+	if len(captionExts) == 0 {
+		return nil, errors.New("captionExts cannot be empty")
+	}
 
 	return &FetchYTService{
-		executable: executable,
-		cmdRunner:  cmdRunner,
+		executable:  executable,
+		captionExts: captionExts,
+		cmdRunner:   cmdRunner,
 	}, nil
 }
 
 // GetMetadata fetches the video ID and title from a YouTube URL using yt-dlp
-func (s *FetchYTService) GetMetadata(url, outputPath string) (*CaptionMetadata, error) {
+func (s *FetchYTService) GetMetadata(url string) (*CaptionMetadata, error) {
 
-	if url == "" || outputPath == "" {
-		return nil, errors.New("GetMetadata requires a valid url and outputPath")
+	if url == "" {
+		return nil, errors.New("GetMetadata requires a valid url")
 	}
 
-	fmt.Println(url, outputPath)
+	log.Printf("Fetching metadata for URL: %s", url)
 
 	// make http request to ytdlp container
 	reqUrl := fmt.Sprintf("http://%s:%s/get_metadata?url=%s", os.Getenv("YTDLP_HOST"), os.Getenv("YTDLP_PORT"), url)
@@ -79,45 +108,88 @@ func (s *FetchYTService) GetMetadata(url, outputPath string) (*CaptionMetadata,
 		return nil, fmt.Errorf("unable to read response: %w", err)
 	}
 
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("metadata request failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
 	var parsedResp MetadataResp
-	json.Unmarshal(body, &parsedResp)
+	err = json.Unmarshal(body, &parsedResp)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse metadata response: %w", err)
+	}
+	if parsedResp.Id == "" {
+		return nil, errors.New("metadata response did not contain a video id")
+	}
 
-	metadata := CaptionMetadata{VideoId: parsedResp.Id, VideoTitle: parsedResp.Title, Url: url, CaptionPath: outputPath + parsedResp.Id + ".en.json"}
+	metadata := CaptionMetadata{
+		VideoId:    parsedResp.Id,
+		VideoTitle: parsedResp.Title,
+		Url:        url,
+		ChannelId:  parsedResp.ChannelId,
+		UploadDate: uploadDate(parsedResp.UploadDate),
+	}
 
 	return &metadata, nil
 }
 
-func (s *FetchYTService) DownloadCaptions(videoId, url, outputDir string) (string, error) {
+// uploadDate turns yt-dlp's YYYYMMDD upload date into YYYY-MM-DD, or empty if it isn't a date
+func uploadDate(raw string) string {
+	if raw == "" {
+		return ""
+	}
+	date, err := time.Parse("20060102", raw)
+	if err != nil {
+		log.Printf("Ignoring upload date %q: %v", raw, err)
+		return ""
+	}
+	return date.Format(time.DateOnly)
+}
+
+// DownloadCaptions downloads the captions of a video in each requested language, or in every
+// available language if languages contains AllLanguages. An empty list means DefaultLanguage.
+func (s *FetchYTService) DownloadCaptions(videoId, url, outputDir string, languages []string) ([]CaptionFile, error) {
 
-	log.Printf("Attempting to download captions for URL: %s into %s", url, outputDir)
+	if len(languages) == 0 {
+		languages = []string{DefaultLanguage}
+	}
+	allLanguages := slices.Contains(languages, AllLanguages)
+	if allLanguages {
+		languages = []string{AllLanguages}
+	}
 
-	vttCaptionsFile := outputDir + videoId + ".en.vtt"
+	log.Printf("Attempting to download %v captions for URL: %s into %s", languages, url, outputDir)
 
-	if cmdutil.FileExists(vttCaptionsFile) {
-		log.Printf("Vtt file %s already exists! Skipping download\n", vttCaptionsFile)
-		return vttCaptionsFile, nil
+	// Only a specific list of languages can be served from the cache, "all" always asks yt-dlp
+	if !allLanguages {
+		captionFiles, missing := s.findCaptionFiles(videoId, outputDir, languages)
+		if len(missing) == 0 {
+			log.Printf("Caption files %v already exist! Skipping download\n", captionFiles)
+			return captionFiles, nil
+		}
 	}
 
 	captionsReq := CaptionsReq{
 		Url:       url,
 		OutputDir: outputDir + videoId,
+		SubFormat: os.Getenv("CAPTION_SUB_FORMAT"),
+		Languages: languages,
 	}
 
 	reqBytes, err := json.Marshal(captionsReq)
 	if err != nil {
-		return "", fmt.Errorf("unable to convert request struct to bytes: %w", err)
+		return nil, fmt.Errorf("unable to convert request struct to bytes: %w", err)
 	}
 
 	reqUrl := fmt.Sprintf("http://%s:%s/get_captions", os.Getenv("YTDLP_HOST"), os.Getenv("YTDLP_PORT"))
 	resp, err := http.Post(reqUrl, "application/json; charset=utf-8", bytes.NewReader(reqBytes))
 	if err != nil {
-		return "", fmt.Errorf("unable to get a valid response: %w", err)
+		return nil, fmt.Errorf("unable to get a valid response: %w", err)
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", fmt.Errorf("unable to read response: %w", err)
+		return nil, fmt.Errorf("unable to read response: %w", err)
 	}
 
 	// if err != nil {
@@ -125,7 +197,73 @@ func (s *FetchYTService) DownloadCaptions(videoId, url, outputDir string) (strin
 	// }
 
 	log.Println(string(body))
-	log.Printf("Downloaded vtt file for videoId: %s", videoId)
 
-	return vttCaptionsFile, nil
+	var captionFiles []CaptionFile
+	if allLanguages {
+		captionFiles = s.findAllCaptionFiles(videoId, outputDir)
+	} else {
+		var missing []string
+		captionFiles, missing = s.findCaptionFiles(videoId, outputDir, languages)
+		if len(missing) > 0 {
+			log.Printf("No captions found in languages %v for videoId: %s", missing, videoId)
+		}
+	}
+
+	if len(captionFiles) == 0 {
+		return nil, fmt.Errorf("no caption file with a supported extension %v found for videoId %s", s.captionExts, videoId)
+	}
+	log.Printf("Downloaded caption files %v for videoId: %s", captionFiles, videoId)
+
+	return captionFiles, nil
+}
+
+// findCaptionFiles looks for a <videoId>.<lang>.<ext> file for each language, reporting the languages it could not find
+func (s *FetchYTService) findCaptionFiles(videoId, outputDir string, languages []string) ([]CaptionFile, []string) {
+	var found []CaptionFile
+	var missing []string
+
+	for _, lang := range languages {
+		path, ok := s.findCaptionFile(videoId, outputDir, lang)
+		if ok {
+			found = append(found, CaptionFile{Language: lang, Path: path})
+		} else {
+			missing = append(missing, lang)
+		}
+	}
+	return found, missing
+}
+
+// findCaptionFile returns the first <videoId>.<lang>.<ext> file in outputDir with a supported extension
+func (s *FetchYTService) findCaptionFile(videoId, outputDir, lang string) (string, bool) {
+	for _, ext := range s.captionExts {
+		path := outputDir + videoId + "." + lang + ext
+		if cmdutil.FileExists(path) {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// findAllCaptionFiles returns one caption file per language found in outputDir, preferring extensions listed first
+func (s *FetchYTService) findAllCaptionFiles(videoId, outputDir string) []CaptionFile {
+
+	matches, err := filepath.Glob(outputDir + videoId + ".*")
+	if err != nil {
+		return nil
+	}
+
+	var languages []string
+	for _, match := range matches {
+		ext := filepath.Ext(match)
+		if !slices.Contains(s.captionExts, ext) {
+			continue
+		}
+		lang := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(match), videoId+"."), ext)
+		if lang != "" && !slices.Contains(languages, lang) {
+			languages = append(languages, lang)
+		}
+	}
+
+	found, _ := s.findCaptionFiles(videoId, outputDir, languages)
+	return found
 }
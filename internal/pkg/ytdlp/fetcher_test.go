@@ -0,0 +1,116 @@
+package ytdlp
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func newTestFetcher(t *testing.T, files ...string) (*FetchYTService, string) {
+	t.Helper()
+
+	dir := t.TempDir() + string(filepath.Separator)
+	for _, name := range files {
+		if err := os.WriteFile(dir+name, []byte("WEBVTT\n"), 0o644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+
+	s, err := NewFetchYTService("yt-dlp", []string{".json3", ".vtt"}, nil)
+	if err != nil {
+		t.Fatalf("NewFetchYTService failed: %v", err)
+	}
+	return s, dir
+}
+
+func TestFindCaptionFiles(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		files       []string
+		languages   []string
+		wantFound   map[string]string
+		wantMissing []string
+	}{
+		{
+			name:      "one language",
+			files:     []string{"abc.en.vtt"},
+			languages: []string{"en"},
+			wantFound: map[string]string{"en": "abc.en.vtt"},
+		},
+		{
+			name:      "preferred extension first",
+			files:     []string{"abc.en.vtt", "abc.en.json3"},
+			languages: []string{"en"},
+			wantFound: map[string]string{"en": "abc.en.json3"},
+		},
+		{
+			name:        "missing languages are reported",
+			files:       []string{"abc.en.vtt", "abc.fr.srt", "xyz.de.vtt"},
+			languages:   []string{"en", "fr", "de"},
+			wantFound:   map[string]string{"en": "abc.en.vtt"},
+			wantMissing: []string{"fr", "de"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, dir := newTestFetcher(t, tt.files...)
+
+			found, missing := s.findCaptionFiles("abc", dir, tt.languages)
+
+			got := make(map[string]string)
+			for _, f := range found {
+				got[f.Language] = filepath.Base(f.Path)
+			}
+			if !reflect.DeepEqual(got, tt.wantFound) {
+				t.Fatalf("expected files %v, got %v", tt.wantFound, got)
+			}
+			if !reflect.DeepEqual(missing, tt.wantMissing) {
+				t.Fatalf("expected missing %v, got %v", tt.wantMissing, missing)
+			}
+		})
+	}
+}
+
+func TestFindAllCaptionFiles(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		files []string
+		want  map[string]string
+	}{
+		{
+			name: "none",
+			want: map[string]string{},
+		},
+		{
+			name:  "every language once, preferred extension first",
+			files: []string{"abc.en.vtt", "abc.en.json3", "abc.fr.vtt", "abc.pt-BR.vtt"},
+			want:  map[string]string{"en": "abc.en.json3", "fr": "abc.fr.vtt", "pt-BR": "abc.pt-BR.vtt"},
+		},
+		{
+			name:  "unsupported extensions and other videos are ignored",
+			files: []string{"abc.de.srt", "abc.info.json", "abcd.en.vtt", "xyz.en.vtt", "abc.es.vtt"},
+			want:  map[string]string{"es": "abc.es.vtt"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, dir := newTestFetcher(t, tt.files...)
+
+			got := make(map[string]string)
+			for _, f := range s.findAllCaptionFiles("abc", dir) {
+				if _, ok := got[f.Language]; ok {
+					t.Fatalf("language %s found twice", f.Language)
+				}
+				got[f.Language] = filepath.Base(f.Path)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("expected files %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package searcher
+
+import (
+	"strings"
+	"unicode"
+
+	porterstemmer "github.com/blevesearch/go-porterstemmer"
+)
+
+// englishStopWords are the stop words of Elasticsearch's english analyzer
+var englishStopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true, "be": true, "but": true,
+	"by": true, "for": true, "if": true, "in": true, "into": true, "is": true, "it": true, "no": true,
+	"not": true, "of": true, "on": true, "or": true, "such": true, "that": true, "the": true,
+	"their": true, "then": true, "there": true, "these": true, "they": true, "this": true, "to": true,
+	"was": true, "will": true, "with": true,
+}
+
+// token is an analyzed term and where it came from. Start and End are character (rune) offsets
+// into the text, Pos counts words including stop words so phrases keep their gaps.
+type token struct {
+	Term  string
+	Pos   int
+	Start int
+	End   int
+}
+
+// analyzeEnglish approximates the english analyzer of the Elasticsearch mapping: it splits text
+// into words, drops possessive 's, lower-cases, removes stop words and applies the Porter stemmer
+func analyzeEnglish(text string) []token {
+
+	var tokens []token
+	runes := []rune(text)
+	pos := 0
+
+	for i := 0; i < len(runes); {
+		if !isWordRune(runes[i]) {
+			i++
+			continue
+		}
+		start := i
+		for i < len(runes) && (isWordRune(runes[i]) || runes[i] == '\'' || runes[i] == '’') {
+			i++
+		}
+		end := i
+		// Apostrophes only count inside words
+		for end > start && !isWordRune(runes[end-1]) {
+			end--
+		}
+
+		word := strings.ToLower(string(runes[start:end]))
+		word = strings.TrimSuffix(strings.TrimSuffix(word, "'s"), "’s")
+		if !englishStopWords[word] {
+			tokens = append(tokens, token{Term: porterstemmer.StemString(word), Pos: pos, Start: start, End: end})
+		}
+		pos++
+	}
+	return tokens
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,46 @@
+package searcher
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// InitCaptionSearchRepository connects to the search backend selected by SEARCH_BACKEND,
+// Elasticsearch by default or the local index kept under SEARCH_DATA_DIR. Elasticsearch searches
+// fail over to db's FULLTEXT index while the cluster is down, unless SEARCH_FALLBACK is none.
+func InitCaptionSearchRepository(db *sql.DB) (CaptionSearchRepository, error) {
+
+	switch backend := os.Getenv("SEARCH_BACKEND"); backend {
+	case "", BackendElasticsearch:
+		esClient, err := InitEsClient()
+		if err != nil {
+			return nil, err
+		}
+		return withFallback(NewElasticSearchRepository(esClient), db)
+	case BackendLocal:
+		return NewLocalSearchRepository(os.Getenv("SEARCH_DATA_DIR")), nil
+	default:
+		return nil, fmt.Errorf("unknown SEARCH_BACKEND %q, expected %s or %s", backend, BackendElasticsearch, BackendLocal)
+	}
+}
+
+// withFallback wraps primary so searches fail over to the database selected by SEARCH_FALLBACK
+func withFallback(primary CaptionSearchRepository, db *sql.DB) (CaptionSearchRepository, error) {
+
+	switch fallback := os.Getenv("SEARCH_FALLBACK"); fallback {
+	case "", BackendMySQL:
+		if _, ok := db.Driver().(*mysql.MySQLDriver); !ok {
+			log.Printf("Search fallback disabled, it needs a MySQL database")
+			return primary, nil
+		}
+		return NewFailoverSearchRepository(primary, NewSQLSearchRepository(db)), nil
+	case "none":
+		return primary, nil
+	default:
+		return nil, fmt.Errorf("unknown SEARCH_FALLBACK %q, expected %s or none", fallback, BackendMySQL)
+	}
+}
@@ -0,0 +1,104 @@
+package searcher
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// Circuit breaker states
+const (
+	circuitClosed   = "closed"
+	circuitOpen     = "open"
+	circuitHalfOpen = "half_open"
+)
+
+// circuitBreaker stops calls to a backend after it fails threshold times in a row. Once it has
+// been open for openFor it lets a single call through, which closes it again if it succeeds.
+type circuitBreaker struct {
+	name      string
+	threshold int
+	openFor   time.Duration
+	now       func() time.Time
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func newCircuitBreaker(name string, threshold int, openFor time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		name:      name,
+		threshold: threshold,
+		openFor:   openFor,
+		now:       time.Now,
+	}
+}
+
+// allow reports whether a call may go ahead, every allowed call must be followed by success,
+// failure or release
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.stateLocked() {
+	case circuitClosed:
+		return true
+	case circuitHalfOpen:
+		b.probing = true
+		return true
+	}
+	return false
+}
+
+func (b *circuitBreaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures >= b.threshold {
+		log.Printf("Circuit for %s closed, it is answering again", b.name)
+	}
+	b.failures = 0
+	b.probing = false
+}
+
+func (b *circuitBreaker) failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.probing = false
+	if b.failures >= b.threshold {
+		// A failed probe keeps it open for another full period
+		b.openedAt = b.now()
+		if b.failures == b.threshold {
+			log.Printf("Circuit for %s opened after %d failures in a row", b.name, b.failures)
+		}
+	}
+}
+
+// release ends a call that neither succeeded nor failed, for example because the caller gave up
+func (b *circuitBreaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+}
+
+func (b *circuitBreaker) state() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.stateLocked()
+}
+
+func (b *circuitBreaker) stateLocked() string {
+	switch {
+	case b.failures < b.threshold:
+		return circuitClosed
+	case !b.probing && b.now().Sub(b.openedAt) >= b.openFor:
+		return circuitHalfOpen
+	}
+	return circuitOpen
+}
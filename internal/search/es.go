@@ -3,26 +3,41 @@ package searcher
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"html"
 	"log"
 	"os"
 	"runtime"
+	"slices"
+	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/cenkalti/backoff/v5"
 
 	es "github.com/elastic/go-elasticsearch/v9"
 	"github.com/elastic/go-elasticsearch/v9/esutil"
+	"github.com/elastic/go-elasticsearch/v9/typedapi/core/closepointintime"
 	"github.com/elastic/go-elasticsearch/v9/typedapi/core/search"
 	"github.com/elastic/go-elasticsearch/v9/typedapi/types"
+	"github.com/elastic/go-elasticsearch/v9/typedapi/types/enums/sortorder"
+	"github.com/elastic/go-elasticsearch/v9/typedapi/types/enums/suggestmode"
 )
 
+// pitKeepAlive is how long a search's point in time stays open between pages
+const pitKeepAlive = "2m"
+
 type CaptionSearchRepository interface {
 	CreateIndex(ctx context.Context, index string) error
 	IndexCaptions(ctx context.Context, meta *CaptionMetadata, captions []CaptionEntry) error
-	SearchCaptions(ctx context.Context, index string, query string) ([]map[string]any, error)
+	SearchCaptions(ctx context.Context, index string, params SearchParams) (*SearchResult, error)
+	ListVideoIds(ctx context.Context, index string, afterId string, limit int) ([]string, error)
+	GetVideoCaptions(ctx context.Context, index string, videoId string) ([]CaptionEntry, error)
+	DeleteVideo(ctx context.Context, index string, videoId string) (int64, error)
 }
 
 type ElasticCaptionSearchRepository struct {
@@ -35,15 +50,40 @@ func NewElasticSearchRepository(se *es.TypedClient) *ElasticCaptionSearchReposit
 	}
 }
 
+// CreateIndex makes sure index names an alias of a caption index, creating the first versioned
+// index behind it if neither exists. If it already exists its mapping version is checked. An
+// older mapping that only lacks fields has them added, otherwise ErrMappingMismatch is returned.
 func (s *ElasticCaptionSearchRepository) CreateIndex(ctx context.Context, index string) error {
-	_, err := s.se.Indices.
-		Create(index).
-		Do(ctx)
+	exists, err := s.se.Indices.Exists(index).IsSuccess(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to check whether index %v exists: %w", index, err)
+	}
+	if !exists {
+		physical := versionedIndexName(index, 1)
+		log.Printf("Creating index %s behind alias %s with mapping version %d", physical, index, CaptionMappingVersion)
+		if err := s.createCaptionIndex(ctx, physical); err != nil {
+			return err
+		}
+		return s.pointAlias(ctx, index, "", physical, false)
+	}
 
+	version, err := s.mappingVersion(ctx, index)
 	if err != nil {
-		return fmt.Errorf("failed to create index %v: %v", index, err)
+		return err
 	}
-	return nil
+	if version == CaptionMappingVersion {
+		return nil
+	}
+
+	upgraded, err := s.upgradeMapping(ctx, index, version)
+	if err != nil {
+		return err
+	}
+	if upgraded {
+		log.Printf("Upgraded mapping of index %s from version %d to %d", index, version, CaptionMappingVersion)
+		return nil
+	}
+	return fmt.Errorf("%w: index %s has version %d, expected %d", ErrMappingMismatch, index, version, CaptionMappingVersion)
 }
 
 func (s *ElasticCaptionSearchRepository) IndexCaptions(ctx context.Context, meta *CaptionMetadata, captions []CaptionEntry) error {
@@ -66,26 +106,19 @@ func (s *ElasticCaptionSearchRepository) IndexCaptions(ctx context.Context, meta
 	if err != nil {
 		return fmt.Errorf("error creating the indexer: %s", err)
 	}
-	defer bi.Close(ctx)
 
 	// Add captions to bulk indexer
 	for _, caption := range captions {
-		doc := map[string]any{
-			"VideoId":    meta.VideoId,
-			"VideoTitle": meta.VideoTitle,
-			"Url":        meta.Url,
-			"Start":      caption.Start,
-			"End":        caption.End,
-			"Text":       caption.Text,
-		}
+		doc := newCaptionDocument(meta, caption)
 		docJson, err := json.Marshal(doc)
 		if err != nil {
+			bi.Close(ctx)
 			return fmt.Errorf("failed to marshal caption document to JSON: %w", err)
 		}
 
 		err = bi.Add(ctx, esutil.BulkIndexerItem{
 			Action:     "index",
-			DocumentID: fmt.Sprintf("%s_%d", meta.VideoId, caption.Start),
+			DocumentID: captionDocumentId(meta.VideoId, caption),
 			Body:       bytes.NewReader(docJson),
 			OnSuccess: func(ctx context.Context, item esutil.BulkIndexerItem, res esutil.BulkIndexerResponseItem) {
 				// atomic.AddUint64(&countSuccessful, 1)
@@ -100,10 +133,16 @@ func (s *ElasticCaptionSearchRepository) IndexCaptions(ctx context.Context, meta
 		})
 
 		if err != nil {
+			bi.Close(ctx)
 			return fmt.Errorf("failed to add caption to bulk indexer")
 		}
 	}
 
+	// Flush everything before looking at the stats, otherwise failures in the last batch are missed
+	if err := bi.Close(ctx); err != nil {
+		return fmt.Errorf("failed to flush bulk indexer: %w", err)
+	}
+
 	biStats := bi.Stats()
 	if biStats.NumFailed > 0 {
 		return fmt.Errorf(
@@ -116,16 +155,227 @@ func (s *ElasticCaptionSearchRepository) IndexCaptions(ctx context.Context, meta
 	return nil
 }
 
-func (s *ElasticCaptionSearchRepository) SearchCaptions(ctx context.Context, index string, query string) ([]map[string]any, error) {
+// captionDocumentId identifies a caption by video, language and start time so re-indexing overwrites it
+func captionDocumentId(videoId string, caption CaptionEntry) string {
+	return fmt.Sprintf("%s_%s_%d", videoId, caption.Language, caption.Start)
+}
+
+// esCaption is the caption document stored in the index, with times in milliseconds
+type esCaption struct {
+	VideoId    string   `json:"VideoId"`
+	VideoTitle string   `json:"VideoTitle"`
+	Url        string   `json:"Url"`
+	ChannelId  string   `json:"ChannelId,omitempty"`
+	UploadDate string   `json:"UploadDate,omitempty"`
+	Language   string   `json:"Language"`
+	Start      uint32   `json:"Start"`
+	End        uint32   `json:"End"`
+	Text       string   `json:"Text"`
+	Words      []esWord `json:"Words"`
+}
 
+// newCaptionDocument is the document a caption of a video is indexed as
+func newCaptionDocument(meta *CaptionMetadata, caption CaptionEntry) esCaption {
+	return esCaption{
+		VideoId:    meta.VideoId,
+		VideoTitle: meta.VideoTitle,
+		Url:        meta.Url,
+		ChannelId:  meta.ChannelId,
+		UploadDate: meta.UploadDate,
+		Language:   caption.Language,
+		Start:      uint32(caption.Start),
+		End:        uint32(caption.End),
+		Text:       caption.Text,
+		Words:      wordDocuments(caption.Words),
+	}
+}
+
+// esWord is how a timed word is stored on a caption document, with Start in milliseconds
+type esWord struct {
+	Start uint32 `json:"Start"`
+	Text  string `json:"Text"`
+}
+
+func wordDocuments(words []Word) []esWord {
+	if len(words) == 0 {
+		return nil
+	}
+	docs := make([]esWord, 0, len(words))
+	for _, w := range words {
+		docs = append(docs, esWord{Start: uint32(w.Start), Text: w.Text})
+	}
+	return docs
+}
+
+// SearchCaptions searches one page of captions. A first page is a plain from/size search. Its
+// next cursor carries the offset, and following it opens a point in time that the cursor carries
+// from then on, so no point in time is held open for searches nobody pages through.
+func (s *ElasticCaptionSearchRepository) SearchCaptions(ctx context.Context, index string, params SearchParams) (result *SearchResult, err error) {
+
+	var cursor searchCursor
+	if params.Cursor != "" {
+		cursor, err = decodeSearchCursor(params.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		params.Query, params.Languages, params.Fuzziness = cursor.Query, cursor.Languages, cursor.Fuzziness
+		params.Filters = cursor.Filters
+	} else {
+		cursor = searchCursor{
+			Offset:    (params.Page - 1) * params.Size,
+			Query:     params.Query,
+			Languages: params.Languages,
+			Fuzziness: params.Fuzziness,
+			Filters:   params.Filters,
+		}
+	}
+
+	query, err := ParseQuery(params.Query)
+	if err != nil {
+		return nil, err
+	}
+
+	if params.Cursor != "" && cursor.PitId == "" {
+		pit, err := s.se.OpenPointInTime(index).KeepAlive(pitKeepAlive).Do(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open point in time on %s: %w", index, err)
+		}
+		cursor.PitId = pit.Id
+	}
+	// A point in time is of no more use once a search through it fails
+	defer func() {
+		if err != nil && cursor.PitId != "" {
+			s.closePointInTime(ctx, cursor.PitId)
+		}
+	}()
+
+	// Pages by offset can't reach past the result window, the page following one is cut short instead
+	size := params.Size
+	if cursor.After == nil {
+		size = min(size, maxResultWindow-cursor.Offset)
+	}
+
+	req := &search.Request{
+		Query:          buildCaptionQuery(query, params),
+		Sort:           captionSort(),
+		Size:           &size,
+		TrackTotalHits: true,
+		Highlight:      captionHighlight(),
+	}
+	if cursor.After != nil {
+		req.SearchAfter = cursor.After
+	} else {
+		req.From = &cursor.Offset
+	}
+
+	searchReq := s.se.Search()
+	if cursor.PitId != "" {
+		// Searches against a point in time must not name an index
+		req.Pit = &types.PointInTimeReference{Id: cursor.PitId, KeepAlive: pitKeepAlive}
+	} else {
+		searchReq = searchReq.Index(index)
+	}
+
+	res, err := searchReq.Request(req).Do(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("search failed: %s", err)
+	}
+
+	result = &SearchResult{
+		TookMs:  res.Took,
+		Backend: BackendElasticsearch,
+		Hits:    make([]SearchHit, 0, len(res.Hits.Hits)),
+	}
+	if res.Hits.Total != nil {
+		result.Total = res.Hits.Total.Value
+	}
+
+	for _, hit := range res.Hits.Hits {
+
+		var doc esCaption
+		err = json.Unmarshal(hit.Source_, &doc)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal caption document %v: %w", hit.Id_, err)
+		}
+
+		var score float64
+		if hit.Score_ != nil {
+			score = float64(*hit.Score_)
+		}
+
+		var wordStart *TimeMs
+		if start, ok := matchedWordStart(doc.Words, query.FreeText()); ok {
+			wordStart = &start
+		}
+
+		meta := doc.metadata()
+		searchHit := NewSearchHit(score, meta, doc.captionEntry(), wordStart)
+		for _, fragment := range hit.Highlight["Text"] {
+			highlighted, matches := parseHighlight(fragment, params.PreTag, params.PostTag)
+			searchHit.Highlights = append(searchHit.Highlights, highlighted)
+			searchHit.Matches = append(searchHit.Matches, matches...)
+		}
+		result.Hits = append(result.Hits, searchHit)
+	}
+
+	// A full page may have more after it, otherwise the point in time is no longer needed
+	n := len(res.Hits.Hits)
+	switch {
+	case n == 0 || n < size:
+		if cursor.PitId != "" {
+			s.closePointInTime(ctx, cursor.PitId)
+		}
+	case cursor.PitId != "":
+		if res.PitId != nil {
+			cursor.PitId = *res.PitId
+		}
+		cursor.After = res.Hits.Hits[n-1].Sort
+		cursor.Offset = 0
+		result.Next, err = cursor.encode()
+	case cursor.Offset+n < maxResultWindow && result.Total > int64(cursor.Offset+n):
+		cursor.Offset += n
+		result.Next, err = cursor.encode()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if params.Cursor == "" && result.Total < suggestBelow {
+		result.Suggestions = s.suggest(ctx, index, query, params)
+	}
+
+	return result, nil
+}
+
+// suggest asks the phrase suggester for corrections of the words the query looks for, drawn from
+// the caption vocabulary. Suggestions are optional, so failing to get them is only logged.
+func (s *ElasticCaptionSearchRepository) suggest(ctx context.Context, index string, query *Query, params SearchParams) []Suggestion {
+
+	text := query.FreeText()
+	if text == "" {
+		return nil
+	}
+
+	field := "Text.suggest"
+	size, gramSize, none := maxSuggestions, 3, 0
+	mode := suggestmode.Always
 	res, err := s.se.
 		Search().
 		Index(index).
+		TypedKeys(true).
 		Request(&search.Request{
-			Query: &types.Query{
-				Match: map[string]types.MatchQuery{
-					"Text": {
-						Query: query,
+			Size: &none,
+			Suggest: &types.Suggester{
+				Text: &text,
+				Suggesters: map[string]types.FieldSuggester{
+					"did_you_mean": {
+						Phrase: &types.PhraseSuggester{
+							Field:           field,
+							Size:            &size,
+							GramSize:        &gramSize,
+							DirectGenerator: []types.DirectGenerator{{Field: field, SuggestMode: &mode}},
+						},
 					},
 				},
 			},
@@ -133,25 +383,175 @@ func (s *ElasticCaptionSearchRepository) SearchCaptions(ctx context.Context, ind
 		Do(ctx)
 
 	if err != nil {
-		return nil, fmt.Errorf("search failed: %s", err)
+		log.Printf("failed to get search suggestions: %v", err)
+		return nil
 	}
 
-	var results []map[string]any
+	var suggestions []Suggestion
+	for _, suggest := range res.Suggest["did_you_mean"] {
+		phrase, ok := suggest.(*types.PhraseSuggest)
+		if !ok {
+			continue
+		}
+		for _, option := range phrase.Options {
+			if suggestion, ok := newSuggestion(query, option.Text, params.PreTag, params.PostTag); ok {
+				suggestions = append(suggestions, suggestion)
+			}
+		}
+	}
+	return suggestions
+}
 
-	for _, hit := range res.Hits.Hits {
+// ES wraps matches in these control characters, which never appear in caption text, so their
+// positions give exact offsets whatever tags the caller asked for
+const (
+	highlightPreMark  = "\x02"
+	highlightPostMark = "\x03"
+)
+
+// captionHighlight highlights the whole caption text rather than fragments of it, captions are short
+func captionHighlight() *types.Highlight {
+	wholeField := 0
+	return &types.Highlight{
+		Fields: map[string]types.HighlightField{
+			"Text": {NumberOfFragments: &wholeField},
+		},
+		PreTags:  []string{highlightPreMark},
+		PostTags: []string{highlightPostMark},
+	}
+}
 
-		// var entry CaptionEntry
-		var entry map[string]any
-		err = json.Unmarshal(hit.Source_, &entry)
+// parseHighlight swaps the highlight marks in an ES fragment for the requested tags and
+// returns the character offsets of each match in the unmarked text. The caption text is HTML
+// escaped so only the tags are markup.
+func parseHighlight(fragment, preTag, postTag string) (string, []MatchOffset) {
 
-		if err != nil {
-			return nil, errors.New("unmarshal to struct failed")
+	var out strings.Builder
+	var matches []MatchOffset
+	pos, start, last := 0, -1, 0
+
+	for i, r := range fragment {
+		if string(r) != highlightPreMark && string(r) != highlightPostMark {
+			pos++
+			continue
+		}
+		out.WriteString(html.EscapeString(fragment[last:i]))
+		last = i + utf8.RuneLen(r)
+		if string(r) == highlightPreMark {
+			start = pos
+			out.WriteString(preTag)
+			continue
+		}
+		if start >= 0 {
+			matches = append(matches, MatchOffset{Start: start, End: pos})
+			start = -1
+		}
+		out.WriteString(postTag)
+	}
+	out.WriteString(html.EscapeString(fragment[last:]))
+	return out.String(), matches
+}
+
+// captionSort orders by relevance, then by the fields that make up a caption's document id. The
+// tie-breakers are unique per caption so search_after never depends on the implicit _shard_doc
+// tie-breaker, whose values the typed client decodes into float64 and can lose precision.
+func captionSort() []types.SortCombinations {
+	return []types.SortCombinations{
+		types.SortOptions{Score_: &types.ScoreSort{Order: &sortorder.Desc}},
+		types.SortOptions{SortOptions: map[string]types.FieldSort{"VideoId": {Order: &sortorder.Asc}}},
+		types.SortOptions{SortOptions: map[string]types.FieldSort{"Language": {Order: &sortorder.Asc}}},
+		types.SortOptions{SortOptions: map[string]types.FieldSort{"Start": {Order: &sortorder.Asc}}},
+	}
+}
+
+// closePointInTime closes a point in time even when ctx has been cancelled, as happens when a
+// search times out
+func (s *ElasticCaptionSearchRepository) closePointInTime(ctx context.Context, pitId string) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+
+	_, err := s.se.ClosePointInTime().Request(&closepointintime.Request{Id: pitId}).Do(ctx)
+	if err != nil {
+		log.Printf("failed to close point in time: %v", err)
+	}
+}
+
+// searchCursor is the state needed to fetch the page after a search result. The cursor of a
+// first page has an Offset into the results, later ones a point in time and the sort values of
+// the last hit to search after.
+type searchCursor struct {
+	PitId     string             `json:"pit,omitempty"`
+	Offset    int                `json:"offset,omitempty"`
+	After     []types.FieldValue `json:"after,omitempty"`
+	Query     string             `json:"query"`
+	Languages []string           `json:"languages,omitempty"`
+	Fuzziness string             `json:"fuzziness,omitempty"`
+	Filters   SearchFilters      `json:"filters"`
+}
+
+func (c searchCursor) encode() (string, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode search cursor: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeSearchCursor(s string) (searchCursor, error) {
+	var c searchCursor
+
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, fmt.Errorf("%w: malformed cursor", ErrInvalidSearch)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&c); err != nil || (c.PitId == "") != (len(c.After) == 0) || (c.PitId == "" && c.Offset <= 0) {
+		return c, fmt.Errorf("%w: malformed cursor", ErrInvalidSearch)
+	}
+	return c, nil
+}
+
+// matchedWordStart returns the start of the first word matching a query term, preferring exact
+// matches over prefix matches so "run" lands on "run" before "running"
+func matchedWordStart(words []esWord, query string) (TimeMs, bool) {
+
+	var terms []string
+	for _, term := range strings.Fields(query) {
+		if term = normalizeWord(term); term != "" {
+			terms = append(terms, term)
 		}
+	}
+	if len(words) == 0 || len(terms) == 0 {
+		return 0, false
+	}
+
+	normalized := make([]string, len(words))
+	for i, w := range words {
+		normalized[i] = normalizeWord(w.Text)
+	}
 
-		results = append(results, entry)
+	for i, word := range normalized {
+		if slices.Contains(terms, word) {
+			return TimeMs(words[i].Start), true
+		}
 	}
+	for i, word := range normalized {
+		for _, term := range terms {
+			if word != "" && strings.HasPrefix(word, term) {
+				return TimeMs(words[i].Start), true
+			}
+		}
+	}
+	return 0, false
+}
 
-	return results, nil
+// normalizeWord lower-cases a word and strips the punctuation around it
+func normalizeWord(w string) string {
+	return strings.ToLower(strings.TrimFunc(w, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}))
 }
 
 func InitEsClient() (*es.TypedClient, error) {
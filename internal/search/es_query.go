@@ -0,0 +1,161 @@
+package searcher
+
+import (
+	"strings"
+
+	"github.com/elastic/go-elasticsearch/v9/typedapi/types"
+)
+
+// buildCaptionQuery compiles a parsed query into a bool query. Languages and the search filters
+// become filter clauses, so they narrow the hits down without changing their scores.
+// Fuzziness applies to words, phrases and ids always match exactly.
+func buildCaptionQuery(query *Query, params SearchParams) *types.Query {
+
+	boolQuery := &types.BoolQuery{
+		Must: []types.Query{compileQueryNode(query.root, params.Fuzziness)},
+	}
+
+	// Captions containing the query's words as a phrase rank above ones that merely contain them
+	if text := query.FreeText(); text != "" {
+		boolQuery.Should = []types.Query{
+			{
+				Match: map[string]types.MatchQuery{
+					"Text.shingles": {
+						Query: text,
+					},
+				},
+			},
+		}
+	}
+
+	boolQuery.Filter = filterClauses(params.Languages, params.Filters)
+
+	return &types.Query{Bool: boolQuery}
+}
+
+// filterClauses compiles the languages and filters of a search into filter clauses
+func filterClauses(languages []string, filters SearchFilters) []types.Query {
+
+	var clauses []types.Query
+	if len(languages) > 0 {
+		clauses = append(clauses, termsQuery("Language", languages))
+	}
+	if len(filters.VideoIds) > 0 {
+		clauses = append(clauses, termsQuery("VideoId", filters.VideoIds))
+	}
+	if filters.ChannelId != "" {
+		clauses = append(clauses, types.Query{Term: map[string]types.TermQuery{"ChannelId": {Value: filters.ChannelId}}})
+	}
+
+	if filters.UploadedAfter != "" || filters.UploadedBefore != "" {
+		uploaded := types.DateRangeQuery{}
+		if filters.UploadedAfter != "" {
+			uploaded.Gte = &filters.UploadedAfter
+		}
+		if filters.UploadedBefore != "" {
+			uploaded.Lte = &filters.UploadedBefore
+		}
+		clauses = append(clauses, types.Query{Range: map[string]types.RangeQuery{"UploadDate": uploaded}})
+	}
+
+	if filters.MinStart != 0 || filters.MaxStart != 0 {
+		start := types.NumberRangeQuery{}
+		if filters.MinStart != 0 {
+			gte := types.Float64(filters.MinStart)
+			start.Gte = &gte
+		}
+		if filters.MaxStart != 0 {
+			lte := types.Float64(filters.MaxStart)
+			start.Lte = &lte
+		}
+		clauses = append(clauses, types.Query{Range: map[string]types.RangeQuery{"Start": start}})
+	}
+	return clauses
+}
+
+func termsQuery(field string, values []string) types.Query {
+	fieldValues := make([]types.FieldValue, 0, len(values))
+	for _, v := range values {
+		fieldValues = append(fieldValues, v)
+	}
+	return types.Query{
+		Terms: &types.TermsQuery{
+			TermsQuery: map[string]types.TermsQueryField{
+				field: fieldValues,
+			},
+		},
+	}
+}
+
+// compileQueryNode turns a group into a bool query whose exclusions are must_not clauses, and a
+// term into a match, match_phrase or term query on its field
+func compileQueryNode(node queryNode, fuzziness string) types.Query {
+
+	switch n := node.(type) {
+	case *queryTerm:
+		return compileQueryTerm(n, fuzziness)
+	case *queryNot:
+		return types.Query{Bool: &types.BoolQuery{MustNot: []types.Query{compileQueryNode(n.Clause, fuzziness)}}}
+	}
+
+	group := node.(*queryBool)
+
+	// Plain words searched together are one match query, the same as a search without operators
+	var clauses []types.Query
+	var words []string
+	for _, clause := range positiveClauses(group) {
+		if t, ok := clause.(*queryTerm); ok && group.Or && t.Field == fieldText && !t.Phrase {
+			words = append(words, t.Text)
+			continue
+		}
+		clauses = append(clauses, compileQueryNode(clause, fuzziness))
+	}
+	if len(words) > 0 {
+		clauses = append([]types.Query{matchQuery("Text", strings.Join(words, " "), fuzziness)}, clauses...)
+	}
+
+	var exclusions []types.Query
+	for _, clause := range negativeClauses(group) {
+		exclusions = append(exclusions, compileQueryNode(clause, fuzziness))
+	}
+	if len(clauses) == 1 && len(exclusions) == 0 {
+		return clauses[0]
+	}
+
+	boolQuery := &types.BoolQuery{MustNot: exclusions}
+	if group.Or {
+		boolQuery.Should = clauses
+		boolQuery.MinimumShouldMatch = 1
+	} else {
+		boolQuery.Must = clauses
+	}
+	return types.Query{Bool: boolQuery}
+}
+
+func compileQueryTerm(t *queryTerm, fuzziness string) types.Query {
+
+	switch t.Field {
+	case fieldVideo:
+		return types.Query{Term: map[string]types.TermQuery{"VideoId": {Value: t.Text}}}
+	case fieldChannel:
+		return types.Query{Term: map[string]types.TermQuery{"ChannelId": {Value: t.Text}}}
+	}
+
+	field := "Text"
+	if t.Field == fieldTitle {
+		field = "VideoTitle"
+	}
+	if t.Phrase {
+		slop := t.Slop
+		return types.Query{MatchPhrase: map[string]types.MatchPhraseQuery{field: {Query: t.Text, Slop: &slop}}}
+	}
+	return matchQuery(field, t.Text, fuzziness)
+}
+
+func matchQuery(field, text, fuzziness string) types.Query {
+	match := types.MatchQuery{Query: text}
+	if fuzziness != "" {
+		match.Fuzziness = fuzziness
+	}
+	return types.Query{Match: map[string]types.MatchQuery{field: match}}
+}
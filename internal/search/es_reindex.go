@@ -0,0 +1,203 @@
+package searcher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v9/typedapi/core/reindex"
+	"github.com/elastic/go-elasticsearch/v9/typedapi/indices/updatealiases"
+	"github.com/elastic/go-elasticsearch/v9/typedapi/types"
+	"github.com/elastic/go-elasticsearch/v9/typedapi/types/enums/conflicts"
+)
+
+// reindexPollInterval is how often a running reindex task is checked on
+const reindexPollInterval = 2 * time.Second
+
+// Reindex copies the index behind alias into the next versioned index and swaps alias over to it.
+//
+// Captions written while the backfill runs still land in the old index. They aren't copied again
+// here, the Reindexer replays the videos written in the meantime from the database once alias
+// points at the new index. An index created before aliases were used has the alias's own name;
+// it has to be removed in the same step as the alias is added, so it is always dropped.
+func (s *ElasticCaptionSearchRepository) Reindex(ctx context.Context, alias string, deleteOld bool, progress func(ReindexProgress)) error {
+
+	source, isAlias, err := s.resolveAlias(ctx, alias)
+	if err != nil {
+		return err
+	}
+
+	target := versionedIndexName(alias, indexGeneration(alias, source)+1)
+	p := ReindexProgress{Step: "creating", Source: source, Target: target}
+	progress(p)
+
+	if err := s.createCaptionIndex(ctx, target); err != nil {
+		return err
+	}
+
+	p.Step = "backfilling"
+	progress(p)
+	if err := s.copyIndex(ctx, source, target, p, progress); err != nil {
+		return fmt.Errorf("failed to backfill %s from %s: %w", target, source, err)
+	}
+
+	p.Step = "swapping"
+	progress(p)
+	if err := s.pointAlias(ctx, alias, source, target, !isAlias); err != nil {
+		return err
+	}
+	log.Printf("Alias %s now points at %s", alias, target)
+
+	if isAlias && deleteOld {
+		p.Step = "deleting_old"
+		progress(p)
+		if _, err := s.se.Indices.Delete(source).Do(ctx); err != nil {
+			return fmt.Errorf("failed to delete old index %s: %w", source, err)
+		}
+	}
+	return nil
+}
+
+// resolveAlias returns the index alias points at, or alias itself if it is a plain index
+func (s *ElasticCaptionSearchRepository) resolveAlias(ctx context.Context, alias string) (string, bool, error) {
+
+	isAlias, err := s.se.Indices.ExistsAlias(alias).IsSuccess(ctx)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to check alias %s: %w", alias, err)
+	}
+
+	if !isAlias {
+		exists, err := s.se.Indices.Exists(alias).IsSuccess(ctx)
+		if err != nil {
+			return "", false, fmt.Errorf("failed to check whether index %s exists: %w", alias, err)
+		}
+		if !exists {
+			return "", false, fmt.Errorf("index %s does not exist", alias)
+		}
+		return alias, false, nil
+	}
+
+	res, err := s.se.Indices.GetAlias().Name(alias).Do(ctx)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to get alias %s: %w", alias, err)
+	}
+	if len(res) != 1 {
+		return "", false, fmt.Errorf("alias %s points at %d indices, expected 1", alias, len(res))
+	}
+	for index := range res {
+		return index, true, nil
+	}
+	return "", false, nil
+}
+
+// pointAlias atomically moves alias from one index to another. When removeFrom is set the old
+// index itself is deleted in the same step, which is needed when it has the alias's name.
+func (s *ElasticCaptionSearchRepository) pointAlias(ctx context.Context, alias, from, to string, removeFrom bool) error {
+
+	isWriteIndex := true
+	var actions []types.IndicesAction
+
+	if from != "" && removeFrom {
+		actions = append(actions, types.IndicesAction{RemoveIndex: &types.RemoveIndexAction{Index: &from}})
+	} else if from != "" {
+		actions = append(actions, types.IndicesAction{Remove: &types.RemoveAction{Index: &from, Alias: &alias}})
+	}
+	actions = append(actions, types.IndicesAction{Add: &types.AddAction{Index: &to, Alias: &alias, IsWriteIndex: &isWriteIndex}})
+
+	_, err := s.se.Indices.
+		UpdateAliases().
+		Request(&updatealiases.Request{Actions: actions}).
+		Do(ctx)
+
+	if err != nil {
+		return fmt.Errorf("failed to point alias %s at %s: %w", alias, to, err)
+	}
+	return nil
+}
+
+// copyIndex runs an ES reindex task from source to target and waits for it, reporting its progress
+func (s *ElasticCaptionSearchRepository) copyIndex(ctx context.Context, source, target string, p ReindexProgress, progress func(ReindexProgress)) error {
+
+	res, err := s.se.Reindex().
+		Request(&reindex.Request{
+			Source:    types.ReindexSource{Index: []string{source}},
+			Dest:      types.ReindexDestination{Index: target},
+			Conflicts: &conflicts.Proceed,
+		}).
+		WaitForCompletion(false).
+		Do(ctx)
+
+	if err != nil {
+		return fmt.Errorf("failed to start reindex task: %w", err)
+	}
+	taskId := fmt.Sprint(res.Task)
+
+	ticker := time.NewTicker(reindexPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		task, err := s.se.Tasks.Get(taskId).Do(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get reindex task %s: %w", taskId, err)
+		}
+
+		var status struct {
+			Total   int64 `json:"total"`
+			Created int64 `json:"created"`
+			Updated int64 `json:"updated"`
+		}
+		if len(task.Task.Status) > 0 {
+			if err := json.Unmarshal(task.Task.Status, &status); err == nil {
+				p.Total, p.Created, p.Updated = status.Total, status.Created, status.Updated
+				progress(p)
+			}
+		}
+
+		if !task.Completed {
+			continue
+		}
+
+		if task.Error != nil {
+			reason := task.Error.Type
+			if task.Error.Reason != nil {
+				reason = *task.Error.Reason
+			}
+			return fmt.Errorf("reindex task %s failed: %s", taskId, reason)
+		}
+		var result struct {
+			Failures []json.RawMessage `json:"failures"`
+		}
+		if err := json.Unmarshal(task.Response, &result); err == nil && len(result.Failures) > 0 {
+			return fmt.Errorf("reindex task %s had %d failures, first: %s", taskId, len(result.Failures), result.Failures[0])
+		}
+		return nil
+	}
+}
+
+// versionedIndexName names the physical index behind alias, e.g. captions_v3
+func versionedIndexName(alias string, generation int) string {
+	return fmt.Sprintf("%s_v%d", alias, generation)
+}
+
+// indexGeneration is the inverse of versionedIndexName, 0 for an index not named after alias
+func indexGeneration(alias, index string) int {
+	suffix, ok := strings.CutPrefix(index, alias+"_v")
+	if !ok {
+		return 0
+	}
+	n, err := strconv.Atoi(suffix)
+	if err != nil {
+		return 0
+	}
+	return n
+}
@@ -0,0 +1,214 @@
+package searcher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	es "github.com/elastic/go-elasticsearch/v9"
+	"github.com/elastic/go-elasticsearch/v9/typedapi/types"
+)
+
+func TestMatchedWordStart(t *testing.T) {
+
+	words := []esWord{
+		{Start: 1000, Text: "Running"},
+		{Start: 1400, Text: "to"},
+		{Start: 1600, Text: "run,"},
+		{Start: 2100, Text: "again"},
+	}
+
+	tests := []struct {
+		name   string
+		query  string
+		want   TimeMs
+		wantOk bool
+	}{
+		{name: "Exact match wins over prefix", query: "run", want: 1600, wantOk: true},
+		{name: "Case and punctuation are ignored", query: "AGAIN!", want: 2100, wantOk: true},
+		{name: "Prefix match", query: "runn", want: 1000, wantOk: true},
+		{name: "First matching term", query: "again to", want: 1400, wantOk: true},
+		{name: "No match", query: "walk", wantOk: false},
+		{name: "Empty query", query: "  ", wantOk: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := matchedWordStart(words, tt.query)
+			if ok != tt.wantOk {
+				t.Fatalf("expected ok = %v, got %v", tt.wantOk, ok)
+			}
+			if ok && got != tt.want {
+				t.Errorf("expected %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestSearchCursorRoundTrip(t *testing.T) {
+
+	cursor := searchCursor{
+		PitId:     "pit-id",
+		After:     []types.FieldValue{1.25, "SampleVideoId", "en", 6000, 12884901889},
+		Query:     "hello",
+		Languages: []string{"en"},
+	}
+
+	encoded, err := cursor.encode()
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+
+	got, err := decodeSearchCursor(encoded)
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if got.PitId != cursor.PitId || got.Query != cursor.Query || len(got.After) != len(cursor.After) {
+		t.Fatalf("unexpected cursor %+v", got)
+	}
+	// Sort values must survive as exact numbers, not float64
+	if n, ok := got.After[4].(json.Number); !ok || n.String() != "12884901889" {
+		t.Fatalf("expected exact sort value, got %#v", got.After[4])
+	}
+
+	if _, err := decodeSearchCursor("not a cursor"); !errors.Is(err, ErrInvalidSearch) {
+		t.Fatalf("expected ErrInvalidSearch, got %v", err)
+	}
+}
+
+func TestParseHighlight(t *testing.T) {
+
+	fragment := "the \x02mystery\x03 of the café \x02colony\x03"
+
+	got, matches := parseHighlight(fragment, "<b>", "</b>")
+
+	if want := "the <b>mystery</b> of the café <b>colony</b>"; got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+
+	want := []MatchOffset{{Start: 4, End: 11}, {Start: 24, End: 30}}
+	if !reflect.DeepEqual(matches, want) {
+		t.Fatalf("expected offsets %+v, got %+v", want, matches)
+	}
+
+	text := []rune("the mystery of the café colony")
+	if string(text[24:30]) != "colony" {
+		t.Fatalf("offset does not point at the match: %q", string(text[24:30]))
+	}
+}
+
+func TestParseHighlightEscapesText(t *testing.T) {
+
+	fragment := "<script>x</script> & \x02<b>\x03 \"q\""
+
+	got, matches := parseHighlight(fragment, "<mark>", "</mark>")
+
+	if want := "&lt;script&gt;x&lt;/script&gt; &amp; <mark>&lt;b&gt;</mark> &#34;q&#34;"; got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+	// Offsets still count characters of the unescaped text
+	if want := []MatchOffset{{Start: 21, End: 24}}; !reflect.DeepEqual(matches, want) {
+		t.Fatalf("expected offsets %+v, got %+v", want, matches)
+	}
+}
+
+// fakePitCluster answers searches with full pages and counts the points in time opened and
+// closed through it
+type fakePitCluster struct {
+	mu         sync.Mutex
+	opened     int
+	closed     int
+	failPitted bool
+}
+
+func (f *fakePitCluster) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	w.Header().Set("X-Elastic-Product", "Elasticsearch")
+	w.Header().Set("Content-Type", "application/json")
+
+	switch {
+	case r.URL.Path == "/captions/_pit":
+		f.opened++
+		fmt.Fprint(w, `{"id":"pit-1"}`)
+	case r.URL.Path == "/_pit" && r.Method == http.MethodDelete:
+		f.closed++
+		fmt.Fprint(w, `{"succeeded":true,"num_freed":1}`)
+	case r.URL.Path == "/_search" && f.failPitted:
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, `{"error":{"type":"search_phase_execution_exception","reason":"all shards failed"},"status":500}`)
+	case strings.HasSuffix(r.URL.Path, "/_search"):
+		pit := ""
+		if r.URL.Path == "/_search" {
+			pit = `"pit_id":"pit-1",`
+		}
+		fmt.Fprintf(w, `{"took":1,"timed_out":false,%s"_shards":{"total":1,"successful":1,"skipped":0,"failed":0},
+			"hits":{"total":{"value":50,"relation":"eq"},"max_score":1,"hits":[
+			{"_index":"captions","_id":"v_en_0","_score":1,"_source":{"VideoId":"v","Language":"en","Start":0,"End":1000,"Text":"hello"},"sort":[1,"v","en",0]},
+			{"_index":"captions","_id":"v_en_1000","_score":1,"_source":{"VideoId":"v","Language":"en","Start":1000,"End":2000,"Text":"hello"},"sort":[1,"v","en",1000]}]}}`, pit)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestSearchCaptionsPointInTime(t *testing.T) {
+
+	cluster := &fakePitCluster{}
+	srv := httptest.NewServer(cluster)
+	defer srv.Close()
+
+	client, err := es.NewTypedClient(es.Config{Addresses: []string{srv.URL}})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	repo := NewElasticSearchRepository(client)
+	ctx := context.Background()
+
+	// A first page searches the index and only remembers its offset
+	first, err := repo.SearchCaptions(ctx, "captions", SearchParams{Query: "hello", Page: 1, Size: 2})
+	if err != nil {
+		t.Fatalf("first page failed: %v", err)
+	}
+	if cluster.opened != 0 || first.Next == "" {
+		t.Fatalf("expected a next cursor and no point in time, opened %d, next %q", cluster.opened, first.Next)
+	}
+
+	// Following the cursor pins the results to a point in time
+	second, err := repo.SearchCaptions(ctx, "captions", SearchParams{Cursor: first.Next, Size: 2})
+	if err != nil {
+		t.Fatalf("second page failed: %v", err)
+	}
+	cursor, err := decodeSearchCursor(second.Next)
+	if err != nil || cursor.PitId != "pit-1" || len(cursor.After) != 4 {
+		t.Fatalf("unexpected cursor %+v, %v", cursor, err)
+	}
+	if cluster.opened != 1 || cluster.closed != 0 {
+		t.Fatalf("expected one open point in time, opened %d closed %d", cluster.opened, cluster.closed)
+	}
+
+	// A failed search closes the point in time it searched
+	cluster.failPitted = true
+	if _, err := repo.SearchCaptions(ctx, "captions", SearchParams{Cursor: second.Next, Size: 2}); err == nil {
+		t.Fatal("expected the search to fail")
+	}
+	if cluster.closed != 1 {
+		t.Fatalf("expected the point in time to be closed, closed %d", cluster.closed)
+	}
+
+	// So does one opened for a first page's cursor
+	if _, err := repo.SearchCaptions(ctx, "captions", SearchParams{Cursor: first.Next, Size: 2}); err == nil {
+		t.Fatal("expected the search to fail")
+	}
+	if cluster.opened != 2 || cluster.closed != 2 {
+		t.Fatalf("expected every point in time to be closed, opened %d closed %d", cluster.opened, cluster.closed)
+	}
+}
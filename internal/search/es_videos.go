@@ -0,0 +1,148 @@
+package searcher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/elastic/go-elasticsearch/v9/typedapi/core/search"
+	"github.com/elastic/go-elasticsearch/v9/typedapi/types"
+	"github.com/elastic/go-elasticsearch/v9/typedapi/types/enums/conflicts"
+	"github.com/elastic/go-elasticsearch/v9/typedapi/types/enums/sortorder"
+)
+
+// videoCaptionsPageSize is how many caption documents are read per request when loading a video
+const videoCaptionsPageSize = 1000
+
+// ListVideoIds returns up to limit ids of videos with captions in the index, ordered by id and
+// starting after afterId, the same way the database lists videos
+func (s *ElasticCaptionSearchRepository) ListVideoIds(ctx context.Context, index string, afterId string, limit int) ([]string, error) {
+
+	field := "VideoId"
+	composite := &types.CompositeAggregation{
+		Size: &limit,
+		Sources: []map[string]types.CompositeAggregationSource{
+			{"video_id": {Terms: &types.CompositeTermsAggregation{Field: &field}}},
+		},
+	}
+	if afterId != "" {
+		composite.After = types.CompositeAggregateKey{"video_id": afterId}
+	}
+
+	size := 0
+	res, err := s.se.
+		Search().
+		Index(index).
+		Request(&search.Request{
+			Size:         &size,
+			Aggregations: map[string]types.Aggregations{"videos": {Composite: composite}},
+		}).
+		Do(ctx)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list videos in %s: %w", index, err)
+	}
+
+	agg, ok := res.Aggregations["videos"].(*types.CompositeAggregate)
+	if !ok {
+		return nil, fmt.Errorf("unexpected videos aggregation %T", res.Aggregations["videos"])
+	}
+	buckets, _ := agg.Buckets.([]types.CompositeBucket)
+
+	ids := make([]string, 0, len(buckets))
+	for _, bucket := range buckets {
+		if id, ok := bucket.Key["video_id"].(string); ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// GetVideoCaptions returns every caption document of a video, ordered by language and start time
+func (s *ElasticCaptionSearchRepository) GetVideoCaptions(ctx context.Context, index string, videoId string) ([]CaptionEntry, error) {
+
+	size := videoCaptionsPageSize
+	req := &search.Request{
+		Query: &types.Query{
+			Term: map[string]types.TermQuery{"VideoId": {Value: videoId}},
+		},
+		Sort: []types.SortCombinations{
+			types.SortOptions{SortOptions: map[string]types.FieldSort{"Language": {Order: &sortorder.Asc}}},
+			types.SortOptions{SortOptions: map[string]types.FieldSort{"Start": {Order: &sortorder.Asc}}},
+		},
+		Size: &size,
+	}
+
+	var captions []CaptionEntry
+	for {
+		res, err := s.se.Search().Index(index).Request(req).Do(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get captions of video %s: %w", videoId, err)
+		}
+
+		for _, hit := range res.Hits.Hits {
+			var doc esCaption
+			if err := json.Unmarshal(hit.Source_, &doc); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal caption document %v: %w", hit.Id_, err)
+			}
+			captions = append(captions, doc.captionEntry())
+		}
+
+		if len(res.Hits.Hits) < size {
+			return captions, nil
+		}
+		req.SearchAfter = res.Hits.Hits[len(res.Hits.Hits)-1].Sort
+	}
+}
+
+// DeleteVideo removes every caption document of a video, returning how many were deleted
+func (s *ElasticCaptionSearchRepository) DeleteVideo(ctx context.Context, index string, videoId string) (int64, error) {
+
+	res, err := s.se.
+		DeleteByQuery(index).
+		Query(&types.Query{
+			Term: map[string]types.TermQuery{"VideoId": {Value: videoId}},
+		}).
+		Conflicts(conflicts.Proceed).
+		Refresh(true).
+		Do(ctx)
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete captions of video %s: %w", videoId, err)
+	}
+	if len(res.Failures) > 0 {
+		return 0, fmt.Errorf("failed to delete %d captions of video %s", len(res.Failures), videoId)
+	}
+
+	var deleted int64
+	if res.Deleted != nil {
+		deleted = *res.Deleted
+	}
+	return deleted, nil
+}
+
+// captionEntry converts a stored document back into the caption it was indexed from
+func (doc esCaption) captionEntry() CaptionEntry {
+	caption := CaptionEntry{
+		VideoId:  doc.VideoId,
+		Language: doc.Language,
+		Start:    TimeMs(doc.Start),
+		End:      TimeMs(doc.End),
+		Text:     doc.Text,
+	}
+	for _, w := range doc.Words {
+		caption.Words = append(caption.Words, Word{Start: TimeMs(w.Start), Text: w.Text})
+	}
+	return caption
+}
+
+// metadata is the video metadata stored on a document
+func (doc esCaption) metadata() CaptionMetadata {
+	return CaptionMetadata{
+		VideoId:    doc.VideoId,
+		VideoTitle: doc.VideoTitle,
+		Url:        doc.Url,
+		ChannelId:  doc.ChannelId,
+		UploadDate: doc.UploadDate,
+	}
+}
@@ -0,0 +1,107 @@
+package searcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+const (
+	// failoverThreshold is how many searches in a row the primary has to fail before failing over
+	failoverThreshold = 3
+	// failoverOpenFor is how long searches stay on the fallback before the primary is tried again
+	failoverOpenFor = 30 * time.Second
+	// primarySearchTimeout bounds a search on the primary, so a hung cluster fails over quickly
+	primarySearchTimeout = 5 * time.Second
+)
+
+// cursorOwner is implemented by backends that can tell their own cursors apart
+type cursorOwner interface {
+	ownsCursor(cursor string) bool
+}
+
+// FailoverCaptionSearchRepository searches the primary backend and fails over to the fallback
+// while the primary's circuit is open. Everything other than searching goes to the primary, the
+// fallback is expected to read captions from where they are stored, such as the database.
+type FailoverCaptionSearchRepository struct {
+	primary  CaptionSearchRepository
+	fallback CaptionSearchRepository
+	breaker  *circuitBreaker
+}
+
+func NewFailoverSearchRepository(primary CaptionSearchRepository, fallback CaptionSearchRepository) *FailoverCaptionSearchRepository {
+	return &FailoverCaptionSearchRepository{
+		primary:  primary,
+		fallback: fallback,
+		breaker:  newCircuitBreaker("search", failoverThreshold, failoverOpenFor),
+	}
+}
+
+func (f *FailoverCaptionSearchRepository) CreateIndex(ctx context.Context, index string) error {
+	return f.primary.CreateIndex(ctx, index)
+}
+
+func (f *FailoverCaptionSearchRepository) IndexCaptions(ctx context.Context, meta *CaptionMetadata, captions []CaptionEntry) error {
+	return f.primary.IndexCaptions(ctx, meta, captions)
+}
+
+// SearchCaptions searches the primary unless its circuit is open. A search the primary fails is
+// answered by the fallback, except for the next page of a primary result, which only it can serve.
+func (f *FailoverCaptionSearchRepository) SearchCaptions(ctx context.Context, index string, params SearchParams) (*SearchResult, error) {
+
+	// Paging through a fallback result stays on the fallback, even once the primary is back
+	if owner, ok := f.fallback.(cursorOwner); ok && params.Cursor != "" && owner.ownsCursor(params.Cursor) {
+		return f.fallback.SearchCaptions(ctx, index, params)
+	}
+
+	if !f.breaker.allow() {
+		if params.Cursor != "" {
+			return nil, fmt.Errorf("%w: the search this cursor belongs to can't be continued, search again", ErrSearchUnavailable)
+		}
+		return f.fallback.SearchCaptions(ctx, index, params)
+	}
+
+	primaryCtx, cancel := context.WithTimeout(ctx, primarySearchTimeout)
+	res, err := f.primary.SearchCaptions(primaryCtx, index, params)
+	cancel()
+
+	switch {
+	case err == nil || errors.Is(err, ErrInvalidSearch):
+		// A rejected search still means the primary is answering
+		f.breaker.success()
+		return res, err
+	case ctx.Err() != nil:
+		f.breaker.release()
+		return nil, err
+	}
+
+	f.breaker.failure()
+	log.Printf("Primary search failed, failing over: %v", err)
+	if params.Cursor != "" {
+		return nil, fmt.Errorf("%w: %w", ErrSearchUnavailable, err)
+	}
+	return f.fallback.SearchCaptions(ctx, index, params)
+}
+
+func (f *FailoverCaptionSearchRepository) ListVideoIds(ctx context.Context, index string, afterId string, limit int) ([]string, error) {
+	return f.primary.ListVideoIds(ctx, index, afterId, limit)
+}
+
+func (f *FailoverCaptionSearchRepository) GetVideoCaptions(ctx context.Context, index string, videoId string) ([]CaptionEntry, error) {
+	return f.primary.GetVideoCaptions(ctx, index, videoId)
+}
+
+func (f *FailoverCaptionSearchRepository) DeleteVideo(ctx context.Context, index string, videoId string) (int64, error) {
+	return f.primary.DeleteVideo(ctx, index, videoId)
+}
+
+// Reindex rebuilds the primary's index, the fallback has none
+func (f *FailoverCaptionSearchRepository) Reindex(ctx context.Context, alias string, deleteOld bool, progress func(ReindexProgress)) error {
+	rb, ok := f.primary.(IndexRebuilder)
+	if !ok {
+		return fmt.Errorf("search backend %T can't reindex", f.primary)
+	}
+	return rb.Reindex(ctx, alias, deleteOld, progress)
+}
@@ -0,0 +1,236 @@
+package searcher
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v9/typedapi/types"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// stubSearchRepository answers every search as backend, or fails with err
+type stubSearchRepository struct {
+	backend  string
+	err      error
+	searches int
+}
+
+func (s *stubSearchRepository) CreateIndex(ctx context.Context, index string) error {
+	return nil
+}
+
+func (s *stubSearchRepository) IndexCaptions(ctx context.Context, meta *CaptionMetadata, captions []CaptionEntry) error {
+	return nil
+}
+
+func (s *stubSearchRepository) SearchCaptions(ctx context.Context, index string, params SearchParams) (*SearchResult, error) {
+	s.searches++
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &SearchResult{Backend: s.backend}, nil
+}
+
+func (s *stubSearchRepository) ListVideoIds(ctx context.Context, index string, afterId string, limit int) ([]string, error) {
+	return nil, nil
+}
+
+func (s *stubSearchRepository) GetVideoCaptions(ctx context.Context, index string, videoId string) ([]CaptionEntry, error) {
+	return nil, nil
+}
+
+func (s *stubSearchRepository) DeleteVideo(ctx context.Context, index string, videoId string) (int64, error) {
+	return 0, nil
+}
+
+func TestCircuitBreaker(t *testing.T) {
+
+	now := time.Unix(0, 0)
+	b := newCircuitBreaker("test", 2, time.Minute)
+	b.now = func() time.Time { return now }
+
+	b.failure()
+	if !b.allow() {
+		t.Fatalf("expected the circuit to stay closed below the threshold")
+	}
+	b.failure()
+	if b.allow() || b.state() != circuitOpen {
+		t.Fatalf("expected the circuit to open at the threshold, got %s", b.state())
+	}
+
+	now = now.Add(time.Minute)
+	if !b.allow() {
+		t.Fatalf("expected a probe once the circuit has been open long enough")
+	}
+	if b.allow() {
+		t.Fatalf("expected only one probe at a time")
+	}
+
+	// A failed probe opens it for another full period
+	b.failure()
+	now = now.Add(30 * time.Second)
+	if b.allow() {
+		t.Fatalf("expected the circuit to be open after a failed probe")
+	}
+
+	now = now.Add(30 * time.Second)
+	if !b.allow() {
+		t.Fatalf("expected a second probe")
+	}
+	b.success()
+	if b.state() != circuitClosed {
+		t.Fatalf("expected a successful probe to close the circuit, got %s", b.state())
+	}
+}
+
+func TestFailoverSearch(t *testing.T) {
+
+	ctx := context.Background()
+	primary := &stubSearchRepository{backend: BackendElasticsearch}
+	fallback := &stubSearchRepository{backend: BackendMySQL}
+	repo := NewFailoverSearchRepository(primary, fallback)
+
+	res, err := repo.SearchCaptions(ctx, "captions", SearchParams{Query: "hello"})
+	if err != nil || res.Backend != BackendElasticsearch {
+		t.Fatalf("expected the primary to answer, got %+v, %v", res, err)
+	}
+
+	// Each failed search is still answered by the fallback
+	primary.err = errors.New("connection refused")
+	for i := 0; i < failoverThreshold; i++ {
+		res, err = repo.SearchCaptions(ctx, "captions", SearchParams{Query: "hello"})
+		if err != nil || res.Backend != BackendMySQL {
+			t.Fatalf("expected the fallback to answer, got %+v, %v", res, err)
+		}
+	}
+
+	// With the circuit open the primary isn't tried at all
+	res, err = repo.SearchCaptions(ctx, "captions", SearchParams{Query: "hello"})
+	if err != nil || res.Backend != BackendMySQL || primary.searches != failoverThreshold+1 {
+		t.Fatalf("expected the open circuit to skip the primary, got %+v, %v after %d searches", res, err, primary.searches)
+	}
+
+	// A cursor of the primary can't be served by the fallback
+	_, err = repo.SearchCaptions(ctx, "captions", SearchParams{Cursor: "primary-cursor"})
+	if !errors.Is(err, ErrSearchUnavailable) {
+		t.Fatalf("expected ErrSearchUnavailable, got %v", err)
+	}
+}
+
+func TestFailoverSearchIgnoresInvalidSearches(t *testing.T) {
+
+	primary := &stubSearchRepository{backend: BackendElasticsearch, err: ErrInvalidSearch}
+	repo := NewFailoverSearchRepository(primary, &stubSearchRepository{backend: BackendMySQL})
+
+	for i := 0; i < failoverThreshold+1; i++ {
+		_, err := repo.SearchCaptions(context.Background(), "captions", SearchParams{Query: "hello"})
+		if !errors.Is(err, ErrInvalidSearch) {
+			t.Fatalf("expected ErrInvalidSearch, got %v", err)
+		}
+	}
+	if repo.breaker.state() != circuitClosed {
+		t.Fatalf("expected rejected searches to leave the circuit closed")
+	}
+}
+
+func TestSQLCondition(t *testing.T) {
+
+	query, err := ParseQuery(`"sourdough starter"~2 OR title:bread_ -e-mail video:abc`)
+	if err != nil {
+		t.Fatalf("ParseQuery failed: %v", err)
+	}
+
+	condition, args := sqlCondition(query.root)
+
+	want := `((MATCH(c.CaptionText) AGAINST (? IN BOOLEAN MODE)) OR (v.Title LIKE ?) OR (c.VideoId = ?)) AND NOT (MATCH(c.CaptionText) AGAINST (? IN BOOLEAN MODE))`
+	if condition != want {
+		t.Fatalf("expected condition\n%s\ngot\n%s", want, condition)
+	}
+	wantArgs := []any{`"sourdough starter" @4`, `%bread\_%`, "abc", "e mail"}
+	if !reflect.DeepEqual(args, wantArgs) {
+		t.Fatalf("expected args %q, got %q", wantArgs, args)
+	}
+}
+
+func TestSQLFilterCondition(t *testing.T) {
+
+	condition, args := sqlFilterCondition([]string{"en"}, SearchFilters{
+		VideoIds:      []string{"abc", "def"},
+		ChannelId:     "UC1",
+		UploadedAfter: "2024-01-01",
+		MaxStart:      120000,
+	})
+
+	want := ` AND c.Language IN (?) AND c.VideoId IN (?, ?) AND v.ChannelId = ? AND v.UploadDate >= ? AND c.StartTime <= ?`
+	if condition != want {
+		t.Fatalf("expected condition\n%s\ngot\n%s", want, condition)
+	}
+	wantArgs := []any{"en", "abc", "def", "UC1", "2024-01-01", uint32(120000)}
+	if !reflect.DeepEqual(args, wantArgs) {
+		t.Fatalf("expected args %v, got %v", wantArgs, args)
+	}
+}
+
+func TestSQLSearchCursor(t *testing.T) {
+
+	repo := NewSQLSearchRepository(nil)
+	cursor, err := sqlSearchCursor{Backend: BackendMySQL, Offset: 20, Query: "hello"}.encode()
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	if !repo.ownsCursor(cursor) {
+		t.Fatalf("expected the repository to own its cursor")
+	}
+
+	esCursor, err := searchCursor{PitId: "pit", After: []types.FieldValue{1.5}, Query: "hello"}.encode()
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	if repo.ownsCursor(esCursor) {
+		t.Fatalf("expected an Elasticsearch cursor not to belong to the database")
+	}
+}
+
+func TestSQLCaptionWords(t *testing.T) {
+
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "words.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+
+	_, err = db.ExecContext(ctx, `CREATE TABLE CaptionWords (VideoId TEXT, Language TEXT, CaptionStart INTEGER, WordIndex INTEGER, StartTime INTEGER, Word TEXT);`)
+	if err != nil {
+		t.Fatalf("failed to create table: %v", err)
+	}
+	_, err = db.ExecContext(ctx, `INSERT INTO CaptionWords VALUES
+		('a', 'en', 0, 1, 400, 'there'), ('a', 'en', 0, 0, 0, 'hello'),
+		('a', 'de', 0, 0, 0, 'hallo'), ('b', 'en', 1000, 0, 1000, 'bye'), ('b', 'en', 2000, 0, 2000, 'unused');`)
+	if err != nil {
+		t.Fatalf("failed to insert words: %v", err)
+	}
+
+	// Words of every caption on the page come back from one query, in order and keyed by caption
+	captions := []CaptionEntry{
+		{VideoId: "a", Language: "en", Start: 0},
+		{VideoId: "b", Language: "en", Start: 1000},
+		{VideoId: "c", Language: "en", Start: 0},
+	}
+	words, err := NewSQLSearchRepository(db).captionWords(ctx, captions)
+	if err != nil {
+		t.Fatalf("captionWords failed: %v", err)
+	}
+	want := map[captionWordsKey][]esWord{
+		{"a", "en", 0}:    {{Start: 0, Text: "hello"}, {Start: 400, Text: "there"}},
+		{"b", "en", 1000}: {{Start: 1000, Text: "bye"}},
+	}
+	if !reflect.DeepEqual(words, want) {
+		t.Fatalf("expected %+v, got %+v", want, words)
+	}
+}
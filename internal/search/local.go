@@ -0,0 +1,395 @@
+package searcher
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultLocalSearchDir is where the local backend keeps its indexes when SEARCH_DATA_DIR is not set
+const defaultLocalSearchDir = "search-data"
+
+// LocalCaptionSearchRepository is an embedded full-text index of captions, scored with BM25 and
+// persisted to local disk as one JSON file per video, so search runs without an Elasticsearch cluster.
+// Every index is held in memory and rebuilt from its files when it is first opened.
+type LocalCaptionSearchRepository struct {
+	dir     string
+	mu      sync.RWMutex
+	indexes map[string]*localIndex
+}
+
+func NewLocalSearchRepository(dir string) *LocalCaptionSearchRepository {
+	if dir == "" {
+		dir = defaultLocalSearchDir
+	}
+	return &LocalCaptionSearchRepository{
+		dir:     dir,
+		indexes: make(map[string]*localIndex),
+	}
+}
+
+// CreateIndex creates the index directory if it doesn't exist and loads any captions already in it
+func (s *LocalCaptionSearchRepository) CreateIndex(ctx context.Context, index string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.open(index)
+	return err
+}
+
+// open returns an index, loading it from disk the first time. The caller must hold the write lock.
+func (s *LocalCaptionSearchRepository) open(index string) (*localIndex, error) {
+	if ix, ok := s.indexes[index]; ok {
+		return ix, nil
+	}
+	if index == "" || strings.ContainsAny(index, `/\`) || index == "." || index == ".." {
+		return nil, fmt.Errorf("invalid index name %q", index)
+	}
+
+	dir := filepath.Join(s.dir, index)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create index directory %s: %w", dir, err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list index %s: %w", index, err)
+	}
+
+	ix := newLocalIndex()
+	for _, file := range files {
+		docs, err := readVideoFile(file)
+		if err != nil {
+			return nil, err
+		}
+		for _, doc := range docs {
+			ix.add(localDocumentId(doc), doc)
+		}
+	}
+	log.Printf("Loaded %d captions of %d videos into local index %s", len(ix.docs), len(files), index)
+
+	s.indexes[index] = ix
+	return ix, nil
+}
+
+// IndexCaptions adds or replaces a video's captions in the CAPTIONS_INDEX index, keeping its
+// captions in other languages, the same as indexing them into Elasticsearch
+func (s *LocalCaptionSearchRepository) IndexCaptions(ctx context.Context, meta *CaptionMetadata, captions []CaptionEntry) error {
+
+	index := os.Getenv("CAPTIONS_INDEX")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ix, err := s.open(index)
+	if err != nil {
+		return err
+	}
+
+	byId := make(map[string]esCaption)
+	for _, doc := range ix.videoDocs(meta.VideoId) {
+		byId[localDocumentId(doc)] = doc
+	}
+	for _, caption := range captions {
+		byId[captionDocumentId(meta.VideoId, caption)] = newCaptionDocument(meta, caption)
+	}
+
+	docs := make([]esCaption, 0, len(byId))
+	for _, doc := range byId {
+		docs = append(docs, doc)
+	}
+	sortVideoDocs(docs)
+
+	// Write the file first so the index in memory never has captions that are not on disk
+	if err := writeVideoFile(s.videoFile(index, meta.VideoId), docs); err != nil {
+		return err
+	}
+	for id, doc := range byId {
+		ix.add(id, doc)
+	}
+
+	log.Printf("Successfully indexed %d captions for video %s into local index %s", len(captions), meta.VideoId, index)
+	return nil
+}
+
+func (s *LocalCaptionSearchRepository) SearchCaptions(ctx context.Context, index string, params SearchParams) (*SearchResult, error) {
+
+	started := time.Now()
+
+	var cursor localCursor
+	if params.Cursor != "" {
+		var err error
+		cursor, err = decodeLocalCursor(params.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		params.Query, params.Languages, params.Fuzziness = cursor.Query, cursor.Languages, cursor.Fuzziness
+		params.Filters = cursor.Filters
+	}
+
+	query, err := ParseQuery(params.Query)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	ix, err := s.open(index)
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	hits, terms := ix.search(query, params)
+
+	// Unlike a point in time the local index isn't frozen between pages, so a cursor continues
+	// after the last hit it returned rather than at an offset
+	var page []localHit
+	if cursor.After != nil {
+		start := sort.Search(len(hits), func(i int) bool {
+			return compareLocalHits(hits[i].score, hits[i].doc.source, cursor.After.Score, cursor.After.caption()) > 0
+		})
+		page = hits[start:]
+	} else {
+		page = hits[min((params.Page-1)*params.Size, len(hits)):]
+	}
+	page = page[:min(params.Size, len(page))]
+
+	result := &SearchResult{
+		Total:   int64(len(hits)),
+		Hits:    make([]SearchHit, 0, len(page)),
+		Backend: BackendLocal,
+	}
+
+	for _, hit := range page {
+		doc := hit.doc.source
+
+		var wordStart *TimeMs
+		if start, ok := matchedWordStart(doc.Words, query.FreeText()); ok {
+			wordStart = &start
+		}
+
+		meta := doc.metadata()
+		searchHit := NewSearchHit(hit.score, meta, doc.captionEntry(), wordStart)
+		highlighted, matches := highlightTokens(doc.Text, terms, params.PreTag, params.PostTag)
+		if len(matches) > 0 {
+			searchHit.Highlights = []string{highlighted}
+			searchHit.Matches = matches
+		}
+		result.Hits = append(result.Hits, searchHit)
+	}
+
+	// A full page may have more after it
+	if n := len(page); n > 0 && n == params.Size {
+		last := page[n-1]
+		cursor = localCursor{
+			After:     &localSortKey{Score: last.score, VideoId: last.doc.source.VideoId, Language: last.doc.source.Language, Start: last.doc.source.Start},
+			Query:     params.Query,
+			Languages: params.Languages,
+			Fuzziness: params.Fuzziness,
+			Filters:   params.Filters,
+		}
+		result.Next, err = cursor.encode()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if params.Cursor == "" && result.Total < suggestBelow {
+		if corrected, ok := ix.suggest(query.FreeText()); ok {
+			if suggestion, ok := newSuggestion(query, corrected, params.PreTag, params.PostTag); ok {
+				result.Suggestions = []Suggestion{suggestion}
+			}
+		}
+	}
+
+	result.TookMs = time.Since(started).Milliseconds()
+	return result, nil
+}
+
+// ListVideoIds returns up to limit ids of videos with captions in the index, ordered by id and starting after afterId
+func (s *LocalCaptionSearchRepository) ListVideoIds(ctx context.Context, index string, afterId string, limit int) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ix, err := s.open(index)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var ids []string
+	for _, doc := range ix.docs {
+		id := doc.source.VideoId
+		if id > afterId && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids[:min(limit, len(ids))], nil
+}
+
+// GetVideoCaptions returns every caption of a video, ordered by language and start time
+func (s *LocalCaptionSearchRepository) GetVideoCaptions(ctx context.Context, index string, videoId string) ([]CaptionEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ix, err := s.open(index)
+	if err != nil {
+		return nil, err
+	}
+
+	docs := ix.videoDocs(videoId)
+	sortVideoDocs(docs)
+
+	var captions []CaptionEntry
+	for _, doc := range docs {
+		captions = append(captions, doc.captionEntry())
+	}
+	return captions, nil
+}
+
+// DeleteVideo removes every caption of a video, returning how many were deleted
+func (s *LocalCaptionSearchRepository) DeleteVideo(ctx context.Context, index string, videoId string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ix, err := s.open(index)
+	if err != nil {
+		return 0, err
+	}
+
+	err = os.Remove(s.videoFile(index, videoId))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return 0, fmt.Errorf("failed to delete captions of video %s: %w", videoId, err)
+	}
+
+	docs := ix.videoDocs(videoId)
+	for _, doc := range docs {
+		ix.remove(localDocumentId(doc))
+	}
+	return int64(len(docs)), nil
+}
+
+// videoFile is where a video's captions are stored, its id escaped so it is always one file name
+func (s *LocalCaptionSearchRepository) videoFile(index string, videoId string) string {
+	return filepath.Join(s.dir, index, url.PathEscape(videoId)+".json")
+}
+
+// videoDocs returns the documents of one video
+func (ix *localIndex) videoDocs(videoId string) []esCaption {
+	var docs []esCaption
+	for _, doc := range ix.docs {
+		if doc.source.VideoId == videoId {
+			docs = append(docs, doc.source)
+		}
+	}
+	return docs
+}
+
+func localDocumentId(doc esCaption) string {
+	return captionDocumentId(doc.VideoId, CaptionEntry{Language: doc.Language, Start: TimeMs(doc.Start)})
+}
+
+func sortVideoDocs(docs []esCaption) {
+	sort.Slice(docs, func(i, j int) bool {
+		if docs[i].Language != docs[j].Language {
+			return docs[i].Language < docs[j].Language
+		}
+		return docs[i].Start < docs[j].Start
+	})
+}
+
+func readVideoFile(file string) ([]esCaption, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", file, err)
+	}
+	var docs []esCaption
+	if err := json.Unmarshal(data, &docs); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal captions in %s: %w", file, err)
+	}
+	return docs, nil
+}
+
+// writeVideoFile replaces a video's file atomically, so a crash never leaves half a file behind
+func writeVideoFile(file string, docs []esCaption) error {
+	data, err := json.Marshal(docs)
+	if err != nil {
+		return fmt.Errorf("failed to marshal caption documents to JSON: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(file), ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", file, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", file, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", file, err)
+	}
+	if err := os.Rename(tmp.Name(), file); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", file, err)
+	}
+	return nil
+}
+
+// localSortKey is the position of a hit in the results, the local equivalent of search_after
+type localSortKey struct {
+	Score    float64 `json:"score"`
+	VideoId  string  `json:"video_id"`
+	Language string  `json:"language"`
+	Start    uint32  `json:"start"`
+}
+
+func (k localSortKey) caption() esCaption {
+	return esCaption{VideoId: k.VideoId, Language: k.Language, Start: k.Start}
+}
+
+// localCursor is the state needed to fetch the page after a local search result
+type localCursor struct {
+	After     *localSortKey `json:"after"`
+	Query     string        `json:"query"`
+	Languages []string      `json:"languages,omitempty"`
+	Fuzziness string        `json:"fuzziness,omitempty"`
+	Filters   SearchFilters `json:"filters"`
+}
+
+func (c localCursor) encode() (string, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode search cursor: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeLocalCursor(s string) (localCursor, error) {
+	var c localCursor
+
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, fmt.Errorf("%w: malformed cursor", ErrInvalidSearch)
+	}
+	if err := json.NewDecoder(bytes.NewReader(data)).Decode(&c); err != nil || c.After == nil {
+		return c, fmt.Errorf("%w: malformed cursor", ErrInvalidSearch)
+	}
+	return c, nil
+}
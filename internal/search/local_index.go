@@ -0,0 +1,401 @@
+package searcher
+
+import (
+	"html"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// BM25 parameters, the same defaults as Elasticsearch
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// localDoc is a caption document with its analyzed text
+type localDoc struct {
+	id     string
+	source esCaption
+	tokens []token
+	title  []token
+}
+
+// localIndex is an in-memory inverted index of caption documents scored with BM25
+type localIndex struct {
+	docs map[string]*localDoc
+	// postings maps each term to the documents containing it and how often
+	postings    map[string]map[string]int
+	totalLength int
+	// words counts the documents containing each word as it was spoken, for spelling suggestions
+	words map[string]int
+}
+
+func newLocalIndex() *localIndex {
+	return &localIndex{
+		docs:     make(map[string]*localDoc),
+		postings: make(map[string]map[string]int),
+		words:    make(map[string]int),
+	}
+}
+
+// add indexes a document, replacing any document with the same id
+func (ix *localIndex) add(id string, source esCaption) {
+	ix.remove(id)
+
+	doc := &localDoc{id: id, source: source, tokens: analyzeEnglish(source.Text), title: analyzeEnglish(source.VideoTitle)}
+	ix.docs[id] = doc
+	ix.totalLength += len(doc.tokens)
+
+	for _, t := range doc.tokens {
+		if ix.postings[t.Term] == nil {
+			ix.postings[t.Term] = make(map[string]int)
+		}
+		ix.postings[t.Term][id]++
+	}
+	for _, word := range distinctWords(source.Text) {
+		ix.words[word]++
+	}
+}
+
+func (ix *localIndex) remove(id string) {
+	doc, ok := ix.docs[id]
+	if !ok {
+		return
+	}
+	for _, t := range doc.tokens {
+		delete(ix.postings[t.Term], id)
+		if len(ix.postings[t.Term]) == 0 {
+			delete(ix.postings, t.Term)
+		}
+	}
+	for _, word := range distinctWords(doc.source.Text) {
+		if ix.words[word]--; ix.words[word] == 0 {
+			delete(ix.words, word)
+		}
+	}
+	ix.totalLength -= len(doc.tokens)
+	delete(ix.docs, id)
+}
+
+func distinctWords(text string) []string {
+	seen := make(map[string]bool)
+	var words []string
+	for _, word := range suggestionWords(text) {
+		if !seen[word.Text] {
+			seen[word.Text] = true
+			words = append(words, word.Text)
+		}
+	}
+	return words
+}
+
+// localHit is a scored document
+type localHit struct {
+	doc   *localDoc
+	score float64
+}
+
+// search returns every document matching the query in any of the languages and passing the
+// filters, best first and then in document id order, the same as the Elasticsearch search.
+// Documents are scored with BM25 on the words the query looks for in caption text, and with
+// fuzziness on the terms within reach of them as well. It also returns those words, analyzed.
+func (ix *localIndex) search(query *Query, params SearchParams) ([]localHit, []token) {
+
+	languages, fuzziness := params.Languages, params.Fuzziness
+
+	terms := analyzeEnglish(query.FreeText())
+	if len(ix.docs) == 0 {
+		return nil, terms
+	}
+
+	n := float64(len(ix.docs))
+	avgLength := float64(ix.totalLength) / n
+	idf := make(map[string]float64, len(terms))
+	scores := make(map[string]float64)
+
+	for _, t := range terms {
+		idf[t.Term] = ix.idf(t.Term)
+
+		for _, term := range ix.expand(t.Term, fuzziness) {
+			termIdf := ix.idf(term)
+			for id, tf := range ix.postings[term] {
+				doc := ix.docs[id]
+				norm := bm25K1 * (1 - bm25B + bm25B*float64(len(doc.tokens))/avgLength)
+				scores[id] += termIdf * float64(tf) * (bm25K1 + 1) / (float64(tf) + norm)
+			}
+		}
+	}
+
+	// A document can only match without containing one of the words when the query searches other fields
+	candidates := ix.docs
+	if onlySearchesText(query.root) {
+		candidates = make(map[string]*localDoc, len(scores))
+		for id := range scores {
+			candidates[id] = ix.docs[id]
+		}
+	}
+
+	var hits []localHit
+	for id, doc := range candidates {
+		if len(languages) > 0 && !slices.Contains(languages, doc.source.Language) {
+			continue
+		}
+		if !params.Filters.matches(doc.source) {
+			continue
+		}
+		if !doc.matches(query.root, fuzziness) {
+			continue
+		}
+		// Captions containing the query's words as a phrase rank above ones that merely contain them
+		score := scores[id] + phraseBonus(doc.tokens, terms, idf)
+		hits = append(hits, localHit{doc: doc, score: score})
+	}
+
+	sort.Slice(hits, func(i, j int) bool {
+		return compareLocalHits(hits[i].score, hits[i].doc.source, hits[j].score, hits[j].doc.source) < 0
+	})
+	return hits, terms
+}
+
+func (ix *localIndex) idf(term string) float64 {
+	n := float64(len(ix.docs))
+	df := float64(len(ix.postings[term]))
+	return math.Log(1 + (n-df+0.5)/(df+0.5))
+}
+
+// expand returns the term and, with fuzziness, every indexed term within its edit distance
+func (ix *localIndex) expand(term string, fuzziness string) []string {
+	terms := []string{term}
+	edits := maxEdits(term, fuzziness)
+	if edits == 0 {
+		return terms
+	}
+	for indexed := range ix.postings {
+		if indexed != term && editDistance(indexed, term, edits) <= edits {
+			terms = append(terms, indexed)
+		}
+	}
+	return terms
+}
+
+// suggest corrects each word of text that no document contains to the most common word within
+// AUTO fuzziness of it, returning false when there is nothing to correct
+func (ix *localIndex) suggest(text string) (string, bool) {
+
+	var corrected []string
+	changed := false
+	for _, word := range suggestionWords(text) {
+		best, bestEdits := word.Text, 0
+		if ix.words[word.Text] == 0 {
+			edits := maxEdits(word.Text, "AUTO")
+			for candidate, count := range ix.words {
+				d := editDistance(candidate, word.Text, edits)
+				if d > edits {
+					continue
+				}
+				// The most common word wins, then the closest, then the first alphabetically
+				if best == word.Text || count > ix.words[best] ||
+					(count == ix.words[best] && (d < bestEdits || (d == bestEdits && candidate < best))) {
+					best, bestEdits = candidate, d
+				}
+			}
+		}
+		changed = changed || best != word.Text
+		corrected = append(corrected, best)
+	}
+	return strings.Join(corrected, " "), changed
+}
+
+// onlySearchesText reports whether every word and phrase the query looks for is in caption text
+func onlySearchesText(node queryNode) bool {
+	switch n := node.(type) {
+	case *queryTerm:
+		return n.Field == fieldText
+	case *queryBool:
+		for _, clause := range positiveClauses(n) {
+			if !onlySearchesText(clause) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// matches evaluates a parsed query against the document
+func (doc *localDoc) matches(node queryNode, fuzziness string) bool {
+
+	switch n := node.(type) {
+	case *queryTerm:
+		return doc.matchesTerm(n, fuzziness)
+	case *queryNot:
+		return !doc.matches(n.Clause, fuzziness)
+	}
+
+	group := node.(*queryBool)
+	for _, clause := range negativeClauses(group) {
+		if doc.matches(clause, fuzziness) {
+			return false
+		}
+	}
+	for _, clause := range positiveClauses(group) {
+		if doc.matches(clause, fuzziness) == group.Or {
+			return group.Or
+		}
+	}
+	return !group.Or
+}
+
+// matchesTerm matches words within fuzziness, phrases and ids have to match exactly
+func (doc *localDoc) matchesTerm(t *queryTerm, fuzziness string) bool {
+
+	tokens := doc.tokens
+	switch t.Field {
+	case fieldVideo:
+		return doc.source.VideoId == t.Text
+	case fieldChannel:
+		return doc.source.ChannelId == t.Text
+	case fieldTitle:
+		tokens = doc.title
+	}
+
+	query := analyzeEnglish(t.Text)
+	if len(query) == 0 {
+		return false
+	}
+	at := termPositions(tokens)
+	if t.Phrase {
+		return phraseMatches(at, query, t.Slop)
+	}
+	for _, q := range query {
+		if len(at[q.Term]) > 0 {
+			return true
+		}
+		if edits := maxEdits(q.Term, fuzziness); edits > 0 {
+			for term := range at {
+				if editDistance(term, q.Term, edits) <= edits {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// phraseMatches reports whether the query terms appear in order, with their positions moved by
+// no more than slop in total from where the phrase puts them
+func phraseMatches(at map[string][]int, query []token, slop int) bool {
+
+	for _, start := range at[query[0].Term] {
+		prev, moved, found := start, 0, true
+		for i := 1; i < len(query) && found; i++ {
+			want := prev + query[i].Pos - query[i-1].Pos
+			best := -1
+			for _, p := range at[query[i].Term] {
+				if p > prev && (best < 0 || abs(p-want) < abs(best-want)) {
+					best = p
+				}
+			}
+			if best < 0 {
+				found = false
+				break
+			}
+			moved += abs(best - want)
+			prev = best
+		}
+		if found && moved <= slop {
+			return true
+		}
+	}
+	return false
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// termPositions maps each term to the positions it appears at
+func termPositions(tokens []token) map[string][]int {
+	at := make(map[string][]int, len(tokens))
+	for _, t := range tokens {
+		at[t.Term] = append(at[t.Term], t.Pos)
+	}
+	return at
+}
+
+// phraseBonus scores each pair of consecutive query terms found the same distance apart in the
+// document, standing in for the shingles subfield of the Elasticsearch mapping
+func phraseBonus(doc []token, query []token, idf map[string]float64) float64 {
+
+	at := termPositions(doc)
+
+	var bonus float64
+	for i := 1; i < len(query); i++ {
+		first, second := query[i-1], query[i]
+		gap := second.Pos - first.Pos
+		for _, p := range at[first.Term] {
+			if slices.Contains(at[second.Term], p+gap) {
+				bonus += idf[first.Term] + idf[second.Term]
+				break
+			}
+		}
+	}
+	return bonus
+}
+
+// compareLocalHits orders by score, best first, then by video, language and start time
+func compareLocalHits(scoreA float64, a esCaption, scoreB float64, b esCaption) int {
+	switch {
+	case scoreA > scoreB:
+		return -1
+	case scoreA < scoreB:
+		return 1
+	}
+	if c := strings.Compare(a.VideoId, b.VideoId); c != 0 {
+		return c
+	}
+	if c := strings.Compare(a.Language, b.Language); c != 0 {
+		return c
+	}
+	switch {
+	case a.Start < b.Start:
+		return -1
+	case a.Start > b.Start:
+		return 1
+	}
+	return 0
+}
+
+// highlightTokens wraps the words of text that analyze to one of the query terms in the tags,
+// returning the highlighted text and the character offsets of each match. The text is HTML
+// escaped so only the tags are markup.
+func highlightTokens(text string, query []token, preTag, postTag string) (string, []MatchOffset) {
+
+	terms := make(map[string]bool, len(query))
+	for _, t := range query {
+		terms[t.Term] = true
+	}
+
+	runes := []rune(text)
+	var out strings.Builder
+	var matches []MatchOffset
+	last := 0
+
+	for _, t := range analyzeEnglish(text) {
+		if !terms[t.Term] {
+			continue
+		}
+		out.WriteString(html.EscapeString(string(runes[last:t.Start])))
+		out.WriteString(preTag)
+		out.WriteString(html.EscapeString(string(runes[t.Start:t.End])))
+		out.WriteString(postTag)
+		matches = append(matches, MatchOffset{Start: t.Start, End: t.End})
+		last = t.End
+	}
+	out.WriteString(html.EscapeString(string(runes[last:])))
+	return out.String(), matches
+}
@@ -0,0 +1,261 @@
+package searcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func newLocalTestRepo(t *testing.T, dir string) *CaptionSearchService {
+	t.Helper()
+	t.Setenv("CAPTIONS_INDEX", "captions")
+
+	svc := NewSearcherService(NewLocalSearchRepository(dir))
+	if err := svc.CreateIndex(context.Background(), "captions"); err != nil {
+		t.Fatalf("CreateIndex failed: %v", err)
+	}
+	return svc
+}
+
+func indexLocalTestVideos(t *testing.T, svc *CaptionSearchService) {
+	t.Helper()
+	ctx := context.Background()
+
+	videos := map[string][]CaptionEntry{
+		"cooking": {
+			{Language: "en", Start: 0, End: 2000, Text: "Today we're baking bread"},
+			{Language: "en", Start: 2000, End: 4000, Text: "The bread needs flour, water and salt", Words: []Word{{Start: 2000, Text: "The"}, {Start: 2300, Text: "bread"}}},
+			{Language: "de", Start: 0, End: 2000, Text: "Heute backen wir Brot"},
+		},
+		"gardening": {
+			{Language: "en", Start: 0, End: 3000, Text: "Planting tomatoes in spring"},
+			{Language: "en", Start: 3000, End: 6000, Text: "Water the tomatoes every morning"},
+		},
+	}
+	uploaded := map[string]string{"cooking": "2023-05-01", "gardening": "2024-04-01"}
+	for id, captions := range videos {
+		for i := range captions {
+			captions[i].VideoId = id
+		}
+		meta := &CaptionMetadata{VideoId: id, VideoTitle: id + " video", ChannelId: "UC-" + id, UploadDate: uploaded[id]}
+		if err := svc.IndexCaptions(ctx, meta, captions); err != nil {
+			t.Fatalf("IndexCaptions failed: %v", err)
+		}
+	}
+}
+
+func TestAnalyzeEnglish(t *testing.T) {
+
+	tokens := analyzeEnglish("The Baker's breads, baking!")
+
+	var terms []string
+	for _, tok := range tokens {
+		terms = append(terms, tok.Term)
+	}
+	want := []string{"baker", "bread", "bake"}
+	if len(terms) != len(want) {
+		t.Fatalf("expected terms %v, got %v", want, terms)
+	}
+	for i := range want {
+		if terms[i] != want[i] {
+			t.Fatalf("expected terms %v, got %v", want, terms)
+		}
+	}
+	// Positions count the stop word, offsets are in characters and exclude the possessive
+	if tokens[0].Pos != 1 || tokens[0].Start != 4 || tokens[0].End != 11 {
+		t.Fatalf("unexpected first token %+v", tokens[0])
+	}
+}
+
+func TestHighlightTokensEscapesText(t *testing.T) {
+
+	text := "<b>bread</b> & butter"
+	got, matches := highlightTokens(text, analyzeEnglish("bread"), "<mark>", "</mark>")
+
+	if want := "&lt;b&gt;<mark>bread</mark>&lt;/b&gt; &amp; butter"; got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+	if len(matches) != 1 || matches[0] != (MatchOffset{Start: 3, End: 8}) {
+		t.Fatalf("unexpected matches %v", matches)
+	}
+}
+
+func TestLocalSearchCaptions(t *testing.T) {
+
+	svc := newLocalTestRepo(t, t.TempDir())
+	indexLocalTestVideos(t, svc)
+	ctx := context.Background()
+
+	res, err := svc.SearchCaptions(ctx, "captions", SearchParams{Query: "bread"})
+	if err != nil {
+		t.Fatalf("SearchCaptions failed: %v", err)
+	}
+	if res.Total != 2 {
+		t.Fatalf("expected 2 hits, got %+v", res)
+	}
+	// The shorter caption scores higher for the same term
+	first := res.Hits[0]
+	if first.Text != "Today we're baking bread" || first.VideoTitle != "cooking video" {
+		t.Fatalf("unexpected first hit %+v", first)
+	}
+	if len(first.Highlights) != 1 || first.Highlights[0] != "Today we&#39;re baking <mark>bread</mark>" {
+		t.Fatalf("unexpected highlights %v", first.Highlights)
+	}
+	if len(first.Matches) != 1 || first.Matches[0] != (MatchOffset{Start: 19, End: 24}) {
+		t.Fatalf("unexpected matches %v", first.Matches)
+	}
+	if second := res.Hits[1]; second.WordStartMs == nil || *second.WordStartMs != 2300 {
+		t.Fatalf("expected the second hit to start at the matched word, got %+v", second)
+	}
+
+	res, err = svc.SearchCaptions(ctx, "captions", SearchParams{Query: "water", Languages: []string{"de"}})
+	if err != nil {
+		t.Fatalf("SearchCaptions failed: %v", err)
+	}
+	if res.Total != 0 {
+		t.Fatalf("expected the language filter to exclude every hit, got %+v", res.Hits)
+	}
+}
+
+func TestLocalSearchPhraseRanksFirst(t *testing.T) {
+
+	svc := newLocalTestRepo(t, t.TempDir())
+	indexLocalTestVideos(t, svc)
+
+	res, err := svc.SearchCaptions(context.Background(), "captions", SearchParams{Query: "water tomatoes"})
+	if err != nil {
+		t.Fatalf("SearchCaptions failed: %v", err)
+	}
+	if res.Total != 3 || res.Hits[0].Text != "Water the tomatoes every morning" {
+		t.Fatalf("expected the phrase match first, got %+v", res.Hits)
+	}
+}
+
+func TestLocalSearchCursor(t *testing.T) {
+
+	svc := newLocalTestRepo(t, t.TempDir())
+	indexLocalTestVideos(t, svc)
+	ctx := context.Background()
+
+	all, err := svc.SearchCaptions(ctx, "captions", SearchParams{Query: "bread water tomatoes", Size: 10})
+	if err != nil {
+		t.Fatalf("SearchCaptions failed: %v", err)
+	}
+
+	var paged []SearchHit
+	res, err := svc.SearchCaptions(ctx, "captions", SearchParams{Query: "bread water tomatoes", Size: 2})
+	for err == nil {
+		paged = append(paged, res.Hits...)
+		if res.Next == "" {
+			break
+		}
+		res, err = svc.SearchCaptions(ctx, "captions", SearchParams{Cursor: res.Next, Size: 2})
+	}
+	if err != nil {
+		t.Fatalf("SearchCaptions failed: %v", err)
+	}
+
+	if len(paged) != len(all.Hits) {
+		t.Fatalf("expected %d hits across pages, got %d", len(all.Hits), len(paged))
+	}
+	for i := range paged {
+		if paged[i].VideoId != all.Hits[i].VideoId || paged[i].StartMs != all.Hits[i].StartMs || paged[i].Language != all.Hits[i].Language {
+			t.Fatalf("page hit %d is %+v, expected %+v", i, paged[i], all.Hits[i])
+		}
+	}
+
+	_, err = svc.SearchCaptions(ctx, "captions", SearchParams{Cursor: "not a cursor"})
+	if !errors.Is(err, ErrInvalidSearch) {
+		t.Fatalf("expected ErrInvalidSearch, got %v", err)
+	}
+}
+
+func TestLocalIndexPersists(t *testing.T) {
+
+	dir := t.TempDir()
+	svc := newLocalTestRepo(t, dir)
+	indexLocalTestVideos(t, svc)
+	ctx := context.Background()
+
+	// Re-indexing one language keeps the video's other captions
+	err := svc.IndexCaptions(ctx, &CaptionMetadata{VideoId: "cooking", VideoTitle: "cooking video"}, []CaptionEntry{
+		{VideoId: "cooking", Language: "de", Start: 0, End: 2000, Text: "Heute backen wir Kuchen"},
+	})
+	if err != nil {
+		t.Fatalf("IndexCaptions failed: %v", err)
+	}
+
+	deleted, err := svc.DeleteVideo(ctx, "captions", "gardening")
+	if err != nil || deleted != 2 {
+		t.Fatalf("expected 2 deleted captions, got %d, %v", deleted, err)
+	}
+
+	// A new repository over the same directory sees the same captions
+	reopened := newLocalTestRepo(t, dir)
+
+	ids, err := reopened.ListVideoIds(ctx, "captions", "", 10)
+	if err != nil || len(ids) != 1 || ids[0] != "cooking" {
+		t.Fatalf("expected only the cooking video, got %v, %v", ids, err)
+	}
+
+	captions, err := reopened.GetVideoCaptions(ctx, "captions", "cooking")
+	if err != nil {
+		t.Fatalf("GetVideoCaptions failed: %v", err)
+	}
+	if len(captions) != 3 || captions[0].Language != "de" || captions[0].Text != "Heute backen wir Kuchen" || len(captions[2].Words) != 2 {
+		t.Fatalf("unexpected captions %+v", captions)
+	}
+
+	res, err := reopened.SearchCaptions(ctx, "captions", SearchParams{Query: "tomatoes"})
+	if err != nil || res.Total != 0 {
+		t.Fatalf("expected the deleted video not to match, got %+v, %v", res, err)
+	}
+}
+
+func TestLocalSearchFilters(t *testing.T) {
+
+	svc := newLocalTestRepo(t, t.TempDir())
+	indexLocalTestVideos(t, svc)
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		query   string
+		filters SearchFilters
+		want    []string
+	}{
+		{name: "no filters", query: "water", want: []string{"gardening 3000", "cooking 2000"}},
+		{name: "video", query: "water", filters: SearchFilters{VideoIds: []string{"cooking", "other"}}, want: []string{"cooking 2000"}},
+		{name: "channel", query: "water", filters: SearchFilters{ChannelId: "UC-gardening"}, want: []string{"gardening 3000"}},
+		{name: "channel prefix", query: "water channel:UC-cooking", want: []string{"gardening 3000", "cooking 2000", "cooking 0", "cooking 0"}},
+		{name: "uploaded after", query: "water", filters: SearchFilters{UploadedAfter: "2024-04-01"}, want: []string{"gardening 3000"}},
+		{name: "uploaded before", query: "water", filters: SearchFilters{UploadedBefore: "2024-03-31"}, want: []string{"cooking 2000"}},
+		{name: "start window", query: "tomatoes", filters: SearchFilters{MinStart: 1000, MaxStart: 3000}, want: []string{"gardening 3000"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := svc.SearchCaptions(ctx, "captions", SearchParams{Query: tt.query, Filters: tt.filters})
+			if err != nil {
+				t.Fatalf("SearchCaptions failed: %v", err)
+			}
+			var got []string
+			for _, hit := range res.Hits {
+				got = append(got, fmt.Sprintf("%s %d", hit.VideoId, hit.StartMs))
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Fatalf("expected hits %v, got %v", tt.want, got)
+			}
+		})
+	}
+
+	_, err := svc.SearchCaptions(ctx, "captions", SearchParams{Query: "water", Filters: SearchFilters{UploadedAfter: "2024-05-01", UploadedBefore: "2024-04-01"}})
+	if !errors.Is(err, ErrInvalidSearch) {
+		t.Fatalf("expected ErrInvalidSearch for an empty date range, got %v", err)
+	}
+	_, err = svc.SearchCaptions(ctx, "captions", SearchParams{Query: "water", Filters: SearchFilters{UploadedAfter: "01/05/2024"}})
+	if !errors.Is(err, ErrInvalidSearch) {
+		t.Fatalf("expected ErrInvalidSearch for a malformed date, got %v", err)
+	}
+}
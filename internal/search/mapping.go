@@ -0,0 +1,153 @@
+package searcher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// CaptionMappingVersion is bumped whenever captionIndexBody changes, it is stored in the mapping's _meta
+const CaptionMappingVersion = 3
+
+// ErrMappingMismatch is returned when an existing index was created with a different mapping version
+var ErrMappingMismatch = errors.New("index mapping does not match the expected version")
+
+// captionIndexBody holds the settings and explicit mapping of a captions index.
+//
+// Text is analyzed as English, dropping possessives and stop words and stemming what is left,
+// with a shingles subfield of two and three word phrases so hits matching a phrase score higher.
+// The suggest subfield keeps words as they were spoken, alone and in phrases, for spelling suggestions.
+// ChannelId and UploadDate are copied onto every caption of a video so searches can filter on them.
+// Words only needs to come back with a hit, so it is stored but not indexed.
+const captionIndexBody = `{
+  "settings": {
+    "analysis": {
+      "filter": {
+        "caption_possessive": {"type": "stemmer", "language": "possessive_english"},
+        "caption_stop": {"type": "stop", "stopwords": "_english_"},
+        "caption_stemmer": {"type": "stemmer", "language": "english"},
+        "caption_shingle": {"type": "shingle", "min_shingle_size": 2, "max_shingle_size": 3, "output_unigrams": false},
+        "caption_suggest_shingle": {"type": "shingle", "min_shingle_size": 2, "max_shingle_size": 3, "output_unigrams": true}
+      },
+      "analyzer": {
+        "caption_english": {
+          "tokenizer": "standard",
+          "filter": ["caption_possessive", "lowercase", "caption_stop", "caption_stemmer"]
+        },
+        "caption_shingles": {
+          "tokenizer": "standard",
+          "filter": ["caption_possessive", "lowercase", "caption_stemmer", "caption_shingle"]
+        },
+        "caption_suggest": {
+          "tokenizer": "standard",
+          "filter": ["lowercase", "caption_suggest_shingle"]
+        }
+      }
+    }
+  },
+  "mappings": {
+    "dynamic": "strict",
+    "_meta": {"mapping_version": 3},
+    "properties": {
+      "VideoId": {"type": "keyword"},
+      "VideoTitle": {
+        "type": "text",
+        "analyzer": "caption_english",
+        "fields": {"keyword": {"type": "keyword", "ignore_above": 256}}
+      },
+      "Url": {"type": "keyword"},
+      "ChannelId": {"type": "keyword"},
+      "UploadDate": {"type": "date", "format": "yyyy-MM-dd"},
+      "Language": {"type": "keyword"},
+      "Start": {"type": "integer"},
+      "End": {"type": "integer"},
+      "Text": {
+        "type": "text",
+        "analyzer": "caption_english",
+        "fields": {
+          "shingles": {"type": "text", "analyzer": "caption_shingles"},
+          "suggest": {"type": "text", "analyzer": "caption_suggest"}
+        }
+      },
+      "Words": {"type": "object", "enabled": false}
+    }
+  }
+}`
+
+// captionMappingAdditions holds the properties a mapping version added to the one before it, for
+// versions that only added fields. They are put on an existing index rather than reindexing it.
+var captionMappingAdditions = map[int]string{
+	3: `{
+      "ChannelId": {"type": "keyword"},
+      "UploadDate": {"type": "date", "format": "yyyy-MM-dd"}
+    }`,
+}
+
+// upgradeMapping brings the mapping of an index at version from up to date by adding fields. It
+// returns false, changing nothing, when a version in between needs a reindex.
+func (s *ElasticCaptionSearchRepository) upgradeMapping(ctx context.Context, index string, from int) (bool, error) {
+	if from < 1 || from >= CaptionMappingVersion {
+		return false, nil
+	}
+	for v := from + 1; v <= CaptionMappingVersion; v++ {
+		if _, ok := captionMappingAdditions[v]; !ok {
+			return false, nil
+		}
+	}
+
+	// Each version's fields and its number go on in one request, so the version is never bumped
+	// without them
+	for v := from + 1; v <= CaptionMappingVersion; v++ {
+		body := fmt.Sprintf(`{"_meta": {"mapping_version": %d}, "properties": %s}`, v, captionMappingAdditions[v])
+		_, err := s.se.Indices.
+			PutMapping(index).
+			Raw(strings.NewReader(body)).
+			Do(ctx)
+
+		if err != nil {
+			return false, fmt.Errorf("failed to upgrade mapping of index %v to version %d: %w", index, v, err)
+		}
+	}
+	return true, nil
+}
+
+// createCaptionIndex creates an index with the caption mapping
+func (s *ElasticCaptionSearchRepository) createCaptionIndex(ctx context.Context, index string) error {
+	_, err := s.se.Indices.
+		Create(index).
+		Raw(strings.NewReader(captionIndexBody)).
+		Do(ctx)
+
+	if err != nil {
+		return fmt.Errorf("failed to create index %v: %w", index, err)
+	}
+	return nil
+}
+
+// mappingVersion reads the mapping version an existing index was created with, 0 if it has none
+func (s *ElasticCaptionSearchRepository) mappingVersion(ctx context.Context, index string) (int, error) {
+	res, err := s.se.Indices.
+		GetMapping().
+		Index(index).
+		Do(ctx)
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to get mapping of index %v: %w", index, err)
+	}
+
+	// The response is keyed by the concrete index name, which differs from index when it is an alias
+	for _, record := range res {
+		raw, ok := record.Mappings.Meta_["mapping_version"]
+		if !ok {
+			return 0, nil
+		}
+		var version int
+		if err := json.Unmarshal(raw, &version); err != nil {
+			return 0, fmt.Errorf("invalid mapping_version on index %v: %w", index, err)
+		}
+		return version, nil
+	}
+	return 0, fmt.Errorf("no mapping returned for index %v", index)
+}
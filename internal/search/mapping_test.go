@@ -0,0 +1,138 @@
+package searcher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	es "github.com/elastic/go-elasticsearch/v9"
+)
+
+func TestCaptionIndexBody(t *testing.T) {
+
+	var body struct {
+		Mappings struct {
+			Meta struct {
+				MappingVersion int `json:"mapping_version"`
+			} `json:"_meta"`
+			Properties map[string]json.RawMessage `json:"properties"`
+		} `json:"mappings"`
+	}
+
+	if err := json.Unmarshal([]byte(captionIndexBody), &body); err != nil {
+		t.Fatalf("caption index body is not valid JSON: %v", err)
+	}
+
+	if body.Mappings.Meta.MappingVersion != CaptionMappingVersion {
+		t.Fatalf("_meta.mapping_version is %d, expected CaptionMappingVersion %d", body.Mappings.Meta.MappingVersion, CaptionMappingVersion)
+	}
+
+	// Every field written by IndexCaptions must be mapped, the mapping is strict
+	for _, field := range []string{"VideoId", "VideoTitle", "Url", "ChannelId", "UploadDate", "Language", "Start", "End", "Text", "Words"} {
+		if _, ok := body.Mappings.Properties[field]; !ok {
+			t.Errorf("field %s is not mapped", field)
+		}
+	}
+}
+
+func TestCaptionMappingAdditions(t *testing.T) {
+
+	var body struct {
+		Mappings struct {
+			Properties map[string]json.RawMessage `json:"properties"`
+		} `json:"mappings"`
+	}
+	if err := json.Unmarshal([]byte(captionIndexBody), &body); err != nil {
+		t.Fatalf("caption index body is not valid JSON: %v", err)
+	}
+
+	// Fields added in place must be mapped exactly as a new index maps them
+	for version, raw := range captionMappingAdditions {
+		var added map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(raw), &added); err != nil {
+			t.Fatalf("additions of version %d are not valid JSON: %v", version, err)
+		}
+		for field, mapping := range added {
+			var got, want any
+			_ = json.Unmarshal(mapping, &got)
+			_ = json.Unmarshal(body.Mappings.Properties[field], &want)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("version %d maps %s as %s, the index body as %s", version, field, mapping, body.Mappings.Properties[field])
+			}
+		}
+	}
+}
+
+func TestCreateIndexUpgradesMapping(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		version     int
+		wantErr     error
+		wantUpgrade bool
+	}{
+		{name: "Current version", version: CaptionMappingVersion},
+		{name: "Fields added since", version: 2, wantUpgrade: true},
+		{name: "Needs a reindex", version: 1, wantErr: ErrMappingMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var puts []string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("X-Elastic-Product", "Elasticsearch")
+				w.Header().Set("Content-Type", "application/json")
+				switch {
+				case r.Method == http.MethodHead && r.URL.Path == "/captions":
+				case r.Method == http.MethodGet && r.URL.Path == "/captions/_mapping":
+					fmt.Fprintf(w, `{"captions_v1":{"mappings":{"_meta":{"mapping_version":%d},"properties":{}}}}`, tt.version)
+				case r.Method == http.MethodPut && r.URL.Path == "/captions/_mapping":
+					body, _ := io.ReadAll(r.Body)
+					puts = append(puts, string(body))
+					fmt.Fprint(w, `{"acknowledged":true}`)
+				default:
+					http.NotFound(w, r)
+				}
+			}))
+			defer srv.Close()
+
+			client, err := es.NewTypedClient(es.Config{Addresses: []string{srv.URL}})
+			if err != nil {
+				t.Fatalf("failed to create client: %v", err)
+			}
+
+			err = NewElasticSearchRepository(client).CreateIndex(context.Background(), "captions")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if !tt.wantUpgrade {
+				if len(puts) != 0 {
+					t.Fatalf("expected the mapping to be left alone, got %v", puts)
+				}
+				return
+			}
+
+			if len(puts) != 1 {
+				t.Fatalf("expected one mapping update, got %v", puts)
+			}
+			var put struct {
+				Meta struct {
+					MappingVersion int `json:"mapping_version"`
+				} `json:"_meta"`
+				Properties map[string]json.RawMessage `json:"properties"`
+			}
+			if err := json.Unmarshal([]byte(puts[0]), &put); err != nil {
+				t.Fatalf("mapping update is not valid JSON: %v", err)
+			}
+			if put.Meta.MappingVersion != CaptionMappingVersion || put.Properties["ChannelId"] == nil || put.Properties["UploadDate"] == nil {
+				t.Fatalf("unexpected mapping update %s", puts[0])
+			}
+		})
+	}
+}
@@ -0,0 +1,449 @@
+package searcher
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Fields a query term can be prefixed with, such as title:cooking. Terms without one search the caption text.
+const (
+	fieldText    = ""
+	fieldTitle   = "title"
+	fieldVideo   = "video"
+	fieldChannel = "channel"
+)
+
+// QuerySyntaxError reports malformed search syntax and where it is, Pos counts characters
+// (Unicode code points) from 0. It matches ErrInvalidSearch.
+type QuerySyntaxError struct {
+	Pos int
+	Msg string
+}
+
+func (e *QuerySyntaxError) Error() string {
+	return fmt.Sprintf("%v: %s at position %d", ErrInvalidSearch, e.Msg, e.Pos)
+}
+
+func (e *QuerySyntaxError) Unwrap() error {
+	return ErrInvalidSearch
+}
+
+// Query is a parsed search query.
+//
+// Words and "quoted phrases" next to each other match captions containing any of them, the same
+// as OR. AND binds tighter than OR, so a b AND c is a OR (b AND c), and parentheses group.
+// NOT and -term exclude captions from the group they are in. A phrase followed by ~N lets its
+// words be up to N positions out of place. title:, video: and channel: prefixes search the video
+// title, video id and channel id instead of the caption text.
+type Query struct {
+	root queryNode
+	text string
+}
+
+// queryNode is one of queryTerm, queryBool or queryNot
+type queryNode interface {
+	position() int
+}
+
+// queryTerm is a word, or a phrase when Phrase is set, in a field. It was written between Pos and End.
+type queryTerm struct {
+	Field  string
+	Text   string
+	Phrase bool
+	Slop   int
+	Pos    int
+	End    int
+}
+
+// queryBool combines clauses with AND, or with OR when Or is set
+type queryBool struct {
+	Or      bool
+	Clauses []queryNode
+	Pos     int
+}
+
+// queryNot excludes captions matching its clause
+type queryNot struct {
+	Clause queryNode
+	Pos    int
+}
+
+func (t *queryTerm) position() int { return t.Pos }
+func (b *queryBool) position() int { return b.Pos }
+func (n *queryNot) position() int  { return n.Pos }
+
+// ParseQuery parses the search syntax described on Query
+func ParseQuery(query string) (*Query, error) {
+
+	tokens, err := lexQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &queryParser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEnd {
+		return nil, &QuerySyntaxError{Pos: tok.pos, Msg: "unexpected " + tok.describe()}
+	}
+
+	// The top level is always a group so exclusions have something to exclude from
+	group, ok := root.(*queryBool)
+	if !ok {
+		group = &queryBool{Clauses: []queryNode{root}, Pos: root.position()}
+	}
+	if err := checkGroups(group); err != nil {
+		return nil, err
+	}
+	return &Query{root: group, text: query}, nil
+}
+
+// checkGroups makes sure every group matches something rather than only excluding
+func checkGroups(node queryNode) error {
+	switch n := node.(type) {
+	case *queryBool:
+		if len(positiveClauses(n)) == 0 {
+			return &QuerySyntaxError{Pos: n.Pos, Msg: "a search can't only exclude terms"}
+		}
+		for _, clause := range n.Clauses {
+			if err := checkGroups(clause); err != nil {
+				return err
+			}
+		}
+	case *queryNot:
+		return checkGroups(n.Clause)
+	}
+	return nil
+}
+
+// positiveClauses are the clauses of a group that aren't exclusions
+func positiveClauses(b *queryBool) []queryNode {
+	var clauses []queryNode
+	for _, clause := range b.Clauses {
+		if _, ok := clause.(*queryNot); !ok {
+			clauses = append(clauses, clause)
+		}
+	}
+	return clauses
+}
+
+// negativeClauses are what the exclusions of a group exclude
+func negativeClauses(b *queryBool) []queryNode {
+	var clauses []queryNode
+	for _, clause := range b.Clauses {
+		if not, ok := clause.(*queryNot); ok {
+			clauses = append(clauses, not.Clause)
+		}
+	}
+	return clauses
+}
+
+// TextTerms returns the words and phrases the query looks for in caption text, in order and
+// leaving out excluded ones, for ranking phrase matches and highlighting
+func (q *Query) TextTerms() []string {
+	var terms []string
+	var walk func(node queryNode)
+	walk = func(node queryNode) {
+		switch n := node.(type) {
+		case *queryTerm:
+			if n.Field == fieldText {
+				terms = append(terms, n.Text)
+			}
+		case *queryBool:
+			for _, clause := range positiveClauses(n) {
+				walk(clause)
+			}
+		}
+	}
+	walk(q.root)
+	return terms
+}
+
+// FreeText is TextTerms joined into one string
+func (q *Query) FreeText() string {
+	return strings.Join(q.TextTerms(), " ")
+}
+
+type queryParser struct {
+	tokens []queryToken
+	next   int
+}
+
+func (p *queryParser) peek() queryToken {
+	return p.tokens[p.next]
+}
+
+func (p *queryParser) take() queryToken {
+	tok := p.tokens[p.next]
+	if tok.kind != tokEnd {
+		p.next++
+	}
+	return tok
+}
+
+// parseOr parses clauses joined by OR or just written next to each other
+func (p *queryParser) parseOr() (queryNode, error) {
+
+	first, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	group := &queryBool{Or: true, Clauses: []queryNode{first}, Pos: first.position()}
+
+	for {
+		tok := p.peek()
+		switch tok.kind {
+		case tokEnd, tokRParen:
+			if len(group.Clauses) == 1 {
+				return first, nil
+			}
+			return group, nil
+		case tokOr:
+			p.take()
+			if next := p.peek(); !next.startsClause() {
+				return nil, &QuerySyntaxError{Pos: next.pos, Msg: "expected a term after OR, found " + next.describe()}
+			}
+		}
+
+		clause, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		group.Clauses = append(group.Clauses, clause)
+	}
+}
+
+// parseAnd parses clauses joined by AND
+func (p *queryParser) parseAnd() (queryNode, error) {
+
+	first, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	group := &queryBool{Clauses: []queryNode{first}, Pos: first.position()}
+
+	for p.peek().kind == tokAnd {
+		p.take()
+		if next := p.peek(); !next.startsClause() {
+			return nil, &QuerySyntaxError{Pos: next.pos, Msg: "expected a term after AND, found " + next.describe()}
+		}
+		clause, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		group.Clauses = append(group.Clauses, clause)
+	}
+
+	if len(group.Clauses) == 1 {
+		return first, nil
+	}
+	return group, nil
+}
+
+// parseUnary parses an optionally negated clause
+func (p *queryParser) parseUnary() (queryNode, error) {
+
+	tok := p.peek()
+	if tok.kind != tokNot {
+		return p.parsePrimary()
+	}
+
+	p.take()
+	if next := p.peek(); !next.startsClause() {
+		return nil, &QuerySyntaxError{Pos: next.pos, Msg: "expected a term to exclude, found " + next.describe()}
+	}
+	clause, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	// Excluding an exclusion includes it again
+	if not, ok := clause.(*queryNot); ok {
+		return not.Clause, nil
+	}
+	return &queryNot{Clause: clause, Pos: tok.pos}, nil
+}
+
+// parsePrimary parses a word, a phrase or a group in parentheses
+func (p *queryParser) parsePrimary() (queryNode, error) {
+
+	tok := p.take()
+	switch tok.kind {
+	case tokWord, tokPhrase:
+		return &queryTerm{Field: tok.field, Text: tok.text, Phrase: tok.kind == tokPhrase, Slop: tok.slop, Pos: tok.pos, End: tok.end}, nil
+	case tokLParen:
+		if p.peek().kind == tokRParen {
+			return nil, &QuerySyntaxError{Pos: tok.pos, Msg: "empty parentheses"}
+		}
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek().kind != tokRParen {
+			return nil, &QuerySyntaxError{Pos: tok.pos, Msg: "missing closing parenthesis"}
+		}
+		p.take()
+		return node, nil
+	}
+	return nil, &QuerySyntaxError{Pos: tok.pos, Msg: "expected a term, found " + tok.describe()}
+}
+
+type queryTokenKind int
+
+const (
+	tokEnd queryTokenKind = iota
+	tokWord
+	tokPhrase
+	tokAnd
+	tokOr
+	tokNot
+	tokLParen
+	tokRParen
+)
+
+type queryToken struct {
+	kind  queryTokenKind
+	text  string
+	field string
+	slop  int
+	pos   int
+	end   int
+}
+
+func (t queryToken) startsClause() bool {
+	switch t.kind {
+	case tokWord, tokPhrase, tokNot, tokLParen:
+		return true
+	}
+	return false
+}
+
+func (t queryToken) describe() string {
+	switch t.kind {
+	case tokEnd:
+		return "end of query"
+	case tokLParen:
+		return "("
+	case tokRParen:
+		return ")"
+	case tokPhrase:
+		return "phrase"
+	}
+	return strconv.Quote(t.text)
+}
+
+// lexQuery splits a query into tokens
+func lexQuery(query string) ([]queryToken, error) {
+
+	runes := []rune(query)
+	var tokens []queryToken
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, queryToken{kind: tokLParen, pos: i})
+			i++
+		case r == ')':
+			tokens = append(tokens, queryToken{kind: tokRParen, pos: i})
+			i++
+		case r == '-' && i+1 < len(runes) && !unicode.IsSpace(runes[i+1]) && runes[i+1] != ')':
+			tokens = append(tokens, queryToken{kind: tokNot, text: "-", pos: i})
+			i++
+		case r == '"':
+			tok, end, err := lexPhrase(runes, i, fieldText, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, tok)
+			i = end
+		default:
+			tok, end, err := lexWord(runes, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, tok)
+			i = end
+		}
+	}
+
+	return append(tokens, queryToken{kind: tokEnd, pos: len(runes)}), nil
+}
+
+// lexWord reads a word, operator or field prefixed term starting at i
+func lexWord(runes []rune, i int) (queryToken, int, error) {
+
+	start := i
+	for i < len(runes) && !unicode.IsSpace(runes[i]) && !isQueryPunct(runes[i]) {
+		if runes[i] == '~' {
+			return queryToken{}, 0, &QuerySyntaxError{Pos: i, Msg: "~ only follows a phrase"}
+		}
+		i++
+	}
+	word := string(runes[start:i])
+
+	switch word {
+	case "AND":
+		return queryToken{kind: tokAnd, text: word, pos: start}, i, nil
+	case "OR":
+		return queryToken{kind: tokOr, text: word, pos: start}, i, nil
+	case "NOT":
+		return queryToken{kind: tokNot, text: word, pos: start}, i, nil
+	}
+
+	prefix, value, ok := strings.Cut(word, ":")
+	field := strings.ToLower(prefix)
+	if !ok || (field != fieldTitle && field != fieldVideo && field != fieldChannel) {
+		return queryToken{kind: tokWord, text: word, pos: start, end: i}, i, nil
+	}
+
+	if value != "" {
+		return queryToken{kind: tokWord, field: field, text: value, pos: start, end: i}, i, nil
+	}
+	if i < len(runes) && runes[i] == '"' {
+		return lexPhrase(runes, i, field, start)
+	}
+	return queryToken{}, 0, &QuerySyntaxError{Pos: start, Msg: "expected a word or phrase after " + prefix + ":"}
+}
+
+// lexPhrase reads a quoted phrase starting at the quote at i, and the ~N slop after it
+func lexPhrase(runes []rune, i int, field string, pos int) (queryToken, int, error) {
+
+	end := i + 1
+	for end < len(runes) && runes[end] != '"' {
+		end++
+	}
+	if end == len(runes) {
+		return queryToken{}, 0, &QuerySyntaxError{Pos: i, Msg: "unterminated phrase"}
+	}
+
+	tok := queryToken{kind: tokPhrase, field: field, text: strings.TrimSpace(string(runes[i+1 : end])), pos: pos}
+	if tok.text == "" {
+		return queryToken{}, 0, &QuerySyntaxError{Pos: i, Msg: "empty phrase"}
+	}
+	end++
+	tok.end = end
+
+	if end < len(runes) && runes[end] == '~' {
+		digits := end + 1
+		for digits < len(runes) && runes[digits] >= '0' && runes[digits] <= '9' {
+			digits++
+		}
+		slop, err := strconv.Atoi(string(runes[end+1 : digits]))
+		if err != nil {
+			return queryToken{}, 0, &QuerySyntaxError{Pos: end, Msg: "expected a number after ~"}
+		}
+		tok.slop = slop
+		end = digits
+	}
+	return tok, end, nil
+}
+
+func isQueryPunct(r rune) bool {
+	return r == '(' || r == ')' || r == '"'
+}
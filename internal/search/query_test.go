@@ -0,0 +1,210 @@
+package searcher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// renderQuery writes a parsed query as nested AND, OR and NOT groups
+func renderQuery(node queryNode) string {
+	switch n := node.(type) {
+	case *queryTerm:
+		text := n.Text
+		if n.Phrase {
+			text = fmt.Sprintf("%q~%d", n.Text, n.Slop)
+		}
+		if n.Field != fieldText {
+			text = n.Field + ":" + text
+		}
+		return text
+	case *queryNot:
+		return "NOT(" + renderQuery(n.Clause) + ")"
+	case *queryBool:
+		var clauses []string
+		for _, clause := range n.Clauses {
+			clauses = append(clauses, renderQuery(clause))
+		}
+		op := "AND"
+		if n.Or {
+			op = "OR"
+		}
+		return op + "(" + strings.Join(clauses, " ") + ")"
+	}
+	return "?"
+}
+
+func TestParseQuery(t *testing.T) {
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{query: "mystery colony", want: "OR(mystery colony)"},
+		{query: "mystery", want: "AND(mystery)"},
+		{query: `"the mystery colony"`, want: `AND("the mystery colony"~0)`},
+		{query: `"mystery colony"~3 ships`, want: `OR("mystery colony"~3 ships)`},
+		{query: "a b AND c", want: "OR(a AND(b c))"},
+		{query: "a OR b OR c", want: "OR(a b c)"},
+		{query: "(a OR b) AND c", want: "AND(OR(a b) c)"},
+		{query: "bread -butter", want: "OR(bread NOT(butter))"},
+		{query: "bread NOT (butter OR jam)", want: "OR(bread NOT(OR(butter jam)))"},
+		{query: "bread NOT -butter", want: "OR(bread butter)"},
+		{query: `Title:"Bread Week" video:abc_123 channel:UC1`, want: `OR(title:"Bread Week"~0 video:abc_123 channel:UC1)`},
+		{query: "http://example.com 10:30 and or not", want: "OR(http://example.com 10:30 and or not)"},
+		{query: "well-known", want: "AND(well-known)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			query, err := ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("ParseQuery failed: %v", err)
+			}
+			if got := renderQuery(query.root); got != tt.want {
+				t.Fatalf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+
+	tests := []struct {
+		query string
+		pos   int
+		msg   string
+	}{
+		{query: `find "mystery colony`, pos: 5, msg: "unterminated phrase"},
+		{query: `""`, pos: 0, msg: "empty phrase"},
+		{query: `"mystery colony"~x`, pos: 16, msg: "expected a number after ~"},
+		{query: "colony~2", pos: 6, msg: "~ only follows a phrase"},
+		{query: "(mystery colony", pos: 0, msg: "missing closing parenthesis"},
+		{query: "mystery colony)", pos: 14, msg: `unexpected )`},
+		{query: "()", pos: 0, msg: "empty parentheses"},
+		{query: "AND colony", pos: 0, msg: `expected a term, found "AND"`},
+		{query: "mystery AND", pos: 11, msg: "expected a term after AND, found end of query"},
+		{query: "mystery OR )", pos: 11, msg: "expected a term after OR, found )"},
+		{query: "mystery NOT", pos: 11, msg: "expected a term to exclude, found end of query"},
+		{query: "title: bread", pos: 0, msg: "expected a word or phrase after title:"},
+		{query: "-bread -butter", pos: 0, msg: "a search can't only exclude terms"},
+		{query: "bread OR (-butter -jam)", pos: 10, msg: "a search can't only exclude terms"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			_, err := ParseQuery(tt.query)
+
+			var syntaxErr *QuerySyntaxError
+			if !errors.As(err, &syntaxErr) {
+				t.Fatalf("expected a QuerySyntaxError, got %v", err)
+			}
+			if syntaxErr.Pos != tt.pos || syntaxErr.Msg != tt.msg {
+				t.Fatalf("expected %q at %d, got %q at %d", tt.msg, tt.pos, syntaxErr.Msg, syntaxErr.Pos)
+			}
+			if !errors.Is(err, ErrInvalidSearch) {
+				t.Fatalf("expected the error to match ErrInvalidSearch")
+			}
+		})
+	}
+}
+
+func TestBuildCaptionQuery(t *testing.T) {
+
+	tests := []struct {
+		query  string
+		params SearchParams
+		want   string
+	}{
+		{
+			// Without operators it is the same match query as always
+			query: "mystery colony",
+			want:  `{"bool":{"must":[{"match":{"Text":{"query":"mystery colony"}}}],"should":[{"match":{"Text.shingles":{"query":"mystery colony"}}}]}}`,
+		},
+		{
+			query: `"mystery colony"~2 -ships title:space`,
+			want: `{"bool":{"must":[{"bool":{"minimum_should_match":1,"must_not":[{"match":{"Text":{"query":"ships"}}}],` +
+				`"should":[{"match_phrase":{"Text":{"query":"mystery colony","slop":2}}},{"match":{"VideoTitle":{"query":"space"}}}]}}],` +
+				`"should":[{"match":{"Text.shingles":{"query":"mystery colony"}}}]}}`,
+		},
+		{
+			query:  `mystery "colony ships" title:space`,
+			params: SearchParams{Fuzziness: "AUTO"},
+			want: `{"bool":{"must":[{"bool":{"minimum_should_match":1,` +
+				`"should":[{"match":{"Text":{"fuzziness":"AUTO","query":"mystery"}}},{"match_phrase":{"Text":{"query":"colony ships","slop":0}}},{"match":{"VideoTitle":{"fuzziness":"AUTO","query":"space"}}}]}}],` +
+				`"should":[{"match":{"Text.shingles":{"query":"mystery colony ships"}}}]}}`,
+		},
+		{
+			query: "video:abc AND channel:UC1",
+			want:  `{"bool":{"must":[{"bool":{"must":[{"term":{"VideoId":{"value":"abc"}}},{"term":{"ChannelId":{"value":"UC1"}}}]}}]}}`,
+		},
+		{
+			// Languages and filters narrow the hits down without being scored
+			query: "colony",
+			params: SearchParams{Languages: []string{"en"}, Filters: SearchFilters{
+				VideoIds:       []string{"abc", "def"},
+				ChannelId:      "UC1",
+				UploadedAfter:  "2024-01-01",
+				UploadedBefore: "2024-12-31",
+				MinStart:       60000,
+				MaxStart:       120000,
+			}},
+			want: `{"bool":{"filter":[{"terms":{"Language":["en"]}},{"terms":{"VideoId":["abc","def"]}},{"term":{"ChannelId":{"value":"UC1"}}},` +
+				`{"range":{"UploadDate":{"gte":"2024-01-01","lte":"2024-12-31"}}},{"range":{"Start":{"gte":60000,"lte":120000}}}],` +
+				`"must":[{"match":{"Text":{"query":"colony"}}}],"should":[{"match":{"Text.shingles":{"query":"colony"}}}]}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			query, err := ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("ParseQuery failed: %v", err)
+			}
+			got, err := json.Marshal(buildCaptionQuery(query, tt.params))
+			if err != nil {
+				t.Fatalf("failed to marshal query: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Fatalf("expected\n%s\ngot\n%s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestLocalSearchQuerySyntax(t *testing.T) {
+
+	svc := newLocalTestRepo(t, t.TempDir())
+	indexLocalTestVideos(t, svc)
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{query: `"bread needs water"~2`, want: []string{"The bread needs flour, water and salt"}},
+		{query: `"bread needs water"`, want: nil},
+		{query: "bread -salt", want: []string{"Today we're baking bread"}},
+		{query: "title:gardening", want: []string{"Planting tomatoes in spring", "Water the tomatoes every morning"}},
+		{query: "water AND video:gardening", want: []string{"Water the tomatoes every morning"}},
+		{query: "(tomatoes OR bread) AND NOT (spring OR salt)", want: []string{"Today we're baking bread", "Water the tomatoes every morning"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			res, err := svc.SearchCaptions(context.Background(), "captions", SearchParams{Query: tt.query})
+			if err != nil {
+				t.Fatalf("SearchCaptions failed: %v", err)
+			}
+			var got []string
+			for _, hit := range res.Hits {
+				got = append(got, hit.Text)
+			}
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Fatalf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,211 @@
+package searcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Reindex states
+const (
+	ReindexRunning   = "running"
+	ReindexSucceeded = "succeeded"
+	ReindexFailed    = "failed"
+)
+
+// reindexTimeout bounds a whole reindex, backfilling a large index takes a while
+const reindexTimeout = 6 * time.Hour
+
+var ErrReindexRunning = errors.New("a reindex is already running")
+
+// ReindexProgress reports how far a reindex has got
+type ReindexProgress struct {
+	// Step is what the reindex is doing, such as "backfilling" or "swapping"
+	Step   string `json:"step"`
+	Source string `json:"source,omitempty"`
+	Target string `json:"target,omitempty"`
+	// Total, Created and Updated count the documents of the current copy step. While catching up,
+	// Total counts the videos to replay and Updated those replayed.
+	Total   int64 `json:"total"`
+	Created int64 `json:"created"`
+	Updated int64 `json:"updated"`
+}
+
+// ReindexStatus is the state of the latest reindex
+type ReindexStatus struct {
+	ReindexProgress
+	Alias      string     `json:"alias"`
+	DeleteOld  bool       `json:"delete_old"`
+	State      string     `json:"state"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// IndexRebuilder is implemented by search backends that can rebuild their index behind an alias
+type IndexRebuilder interface {
+	// Reindex builds a new index, backfills it from the one behind alias and swaps alias over to it,
+	// calling progress as it goes. The old index is dropped afterwards when deleteOld is set.
+	Reindex(ctx context.Context, alias string, deleteOld bool, progress func(ReindexProgress)) error
+}
+
+// WriteLog records which videos are written to the search index while a reindex runs. Writes
+// made during the backfill land in the old index, so those videos are replayed onto the new one
+// once it has been swapped in.
+type WriteLog struct {
+	mu sync.Mutex
+	// videos is nil while nothing is recording
+	videos map[string]struct{}
+}
+
+// begin starts recording writes
+func (l *WriteLog) begin() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.videos = make(map[string]struct{})
+}
+
+// record notes a write to a video's documents, it must be called before the write is sent
+func (l *WriteLog) record(videoId string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.videos != nil {
+		l.videos[videoId] = struct{}{}
+	}
+}
+
+// end stops recording and returns the videos written since begin, in order
+func (l *WriteLog) end() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	ids := make([]string, 0, len(l.videos))
+	for id := range l.videos {
+		ids = append(ids, id)
+	}
+	l.videos = nil
+	slices.Sort(ids)
+	return ids
+}
+
+// Reindexer runs one reindex at a time in the background and remembers how the latest one went
+type Reindexer struct {
+	rb     IndexRebuilder
+	writes *WriteLog
+	replay func(ctx context.Context, videoId string) error
+
+	mu     sync.Mutex
+	status *ReindexStatus
+}
+
+// NewReindexer returns a Reindexer that catches up on the writes recorded in writes by calling
+// replay, which writes a video's captions from the database to the search index again
+func NewReindexer(rb IndexRebuilder, writes *WriteLog, replay func(ctx context.Context, videoId string) error) *Reindexer {
+	return &Reindexer{
+		rb:     rb,
+		writes: writes,
+		replay: replay,
+	}
+}
+
+// Start begins reindexing alias in the background, returning ErrReindexRunning if one is in progress
+func (r *Reindexer) Start(alias string, deleteOld bool) (ReindexStatus, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.status != nil && r.status.State == ReindexRunning {
+		return *r.status, ErrReindexRunning
+	}
+
+	r.status = &ReindexStatus{
+		Alias:     alias,
+		DeleteOld: deleteOld,
+		State:     ReindexRunning,
+		StartedAt: time.Now().UTC(),
+	}
+	status := *r.status
+
+	r.writes.begin()
+	go r.run(alias, deleteOld)
+
+	return status, nil
+}
+
+// Status returns the latest reindex, false if none has been started
+func (r *Reindexer) Status() (ReindexStatus, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.status == nil {
+		return ReindexStatus{}, false
+	}
+	return *r.status, true
+}
+
+func (r *Reindexer) run(alias string, deleteOld bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), reindexTimeout)
+	defer cancel()
+
+	var last ReindexProgress
+	progress := func(p ReindexProgress) {
+		last = p
+		r.mu.Lock()
+		r.status.ReindexProgress = p
+		r.mu.Unlock()
+	}
+
+	err := r.rb.Reindex(ctx, alias, deleteOld, progress)
+	// Writes sent from here on go through alias to the new index, those before may not have
+	written := r.writes.end()
+	if err == nil {
+		err = r.catchUp(ctx, written, last, progress)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now().UTC()
+	r.status.FinishedAt = &now
+	if err != nil {
+		log.Printf("Reindex of %s failed: %v", alias, err)
+		r.status.State = ReindexFailed
+		r.status.Error = err.Error()
+		return
+	}
+	log.Printf("Reindexed %s from %s into %s", alias, r.status.Source, r.status.Target)
+	r.status.State = ReindexSucceeded
+}
+
+// catchUp replays the videos written while the new index was being built onto it
+func (r *Reindexer) catchUp(ctx context.Context, videoIds []string, p ReindexProgress, progress func(ReindexProgress)) error {
+
+	p.Step = "catching_up"
+	p.Total, p.Created, p.Updated = int64(len(videoIds)), 0, 0
+	progress(p)
+
+	var failed int
+	var firstErr error
+	for _, id := range videoIds {
+		if err := r.replay(ctx, id); err != nil {
+			log.Printf("Failed to replay video %s onto the new index: %v", id, err)
+			failed++
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		p.Updated++
+		progress(p)
+	}
+	if firstErr != nil {
+		return fmt.Errorf("failed to replay %d of %d videos written during the reindex, reconcile the index: %w", failed, len(videoIds), firstErr)
+	}
+
+	p.Step = "done"
+	progress(p)
+	return nil
+}
@@ -0,0 +1,162 @@
+package searcher
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fakeRebuilder struct {
+	release chan struct{}
+	err     error
+}
+
+func (f *fakeRebuilder) Reindex(ctx context.Context, alias string, deleteOld bool, progress func(ReindexProgress)) error {
+	progress(ReindexProgress{Step: "backfilling", Source: alias + "_v1", Target: alias + "_v2", Total: 10, Created: 4})
+	<-f.release
+	return f.err
+}
+
+func waitForReindex(t *testing.T, r *Reindexer) ReindexStatus {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if status, _ := r.Status(); status.State != ReindexRunning {
+			return status
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("reindex did not finish")
+	return ReindexStatus{}
+}
+
+func TestReindexerRunsOneAtATime(t *testing.T) {
+
+	rb := &fakeRebuilder{release: make(chan struct{})}
+	r := NewReindexer(rb, &WriteLog{}, nil)
+
+	if _, ok := r.Status(); ok {
+		t.Fatalf("expected no status before a reindex is started")
+	}
+
+	status, err := r.Start("captions", true)
+	if err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	if status.State != ReindexRunning || !status.DeleteOld {
+		t.Fatalf("unexpected status %+v", status)
+	}
+
+	if _, err := r.Start("captions", false); !errors.Is(err, ErrReindexRunning) {
+		t.Fatalf("expected ErrReindexRunning, got %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for status, _ = r.Status(); status.Created != 4 && time.Now().Before(deadline); status, _ = r.Status() {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if status.Step != "backfilling" || status.Target != "captions_v2" || status.Created != 4 {
+		t.Fatalf("expected progress to be recorded, got %+v", status)
+	}
+
+	close(rb.release)
+	status = waitForReindex(t, r)
+
+	if status.State != ReindexSucceeded || status.FinishedAt == nil || status.Step != "done" {
+		t.Fatalf("expected a finished successful reindex, got %+v", status)
+	}
+}
+
+func TestReindexerRecordsFailure(t *testing.T) {
+
+	rb := &fakeRebuilder{release: make(chan struct{}), err: errors.New("boom")}
+	close(rb.release)
+	r := NewReindexer(rb, &WriteLog{}, nil)
+
+	if _, err := r.Start("captions", false); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	status := waitForReindex(t, r)
+
+	if status.State != ReindexFailed || status.Error != "boom" {
+		t.Fatalf("expected a failed reindex, got %+v", status)
+	}
+}
+
+func TestReindexerReplaysWrites(t *testing.T) {
+
+	rb := &fakeRebuilder{release: make(chan struct{})}
+	writes := &WriteLog{}
+	var replayed []string
+	r := NewReindexer(rb, writes, func(ctx context.Context, videoId string) error {
+		replayed = append(replayed, videoId)
+		if videoId == "broken" {
+			return errors.New("boom")
+		}
+		return nil
+	})
+
+	// Only writes made while the reindex runs are replayed, once per video
+	writes.record("before")
+	if _, err := r.Start("captions", false); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	writes.record("b")
+	writes.record("a")
+	writes.record("b")
+	close(rb.release)
+	status := waitForReindex(t, r)
+	writes.record("after")
+
+	if status.State != ReindexSucceeded || status.Step != "done" || status.Total != 2 || status.Updated != 2 {
+		t.Fatalf("expected a caught up reindex, got %+v", status)
+	}
+	if want := []string{"a", "b"}; !reflect.DeepEqual(replayed, want) {
+		t.Fatalf("expected %v to be replayed, got %v", want, replayed)
+	}
+
+	// A video that can't be replayed fails the reindex after the rest are replayed
+	rb.release = make(chan struct{})
+	replayed = nil
+	if _, err := r.Start("captions", false); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	writes.record("broken")
+	writes.record("c")
+	close(rb.release)
+	status = waitForReindex(t, r)
+
+	if status.State != ReindexFailed || !strings.Contains(status.Error, "1 of 2") || status.Updated != 1 {
+		t.Fatalf("expected a failed catch up, got %+v", status)
+	}
+	if want := []string{"broken", "c"}; !reflect.DeepEqual(replayed, want) {
+		t.Fatalf("expected %v to be replayed, got %v", want, replayed)
+	}
+}
+
+func TestIndexGeneration(t *testing.T) {
+
+	tests := []struct {
+		index string
+		want  int
+	}{
+		{index: "captions_v3", want: 3},
+		{index: "captions", want: 0},
+		{index: "captions_vx", want: 0},
+		{index: "other_v2", want: 0},
+	}
+
+	for _, tt := range tests {
+		if got := indexGeneration("captions", tt.index); got != tt.want {
+			t.Errorf("indexGeneration(%q) = %d, expected %d", tt.index, got, tt.want)
+		}
+	}
+
+	if got := versionedIndexName("captions", 4); got != "captions_v4" {
+		t.Errorf("unexpected versioned index name %q", got)
+	}
+}
@@ -4,20 +4,247 @@ import (
 	"banditsecret/internal/parser"
 	"banditsecret/internal/pkg/ytdlp"
 	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
 	// Typed Client
 )
 
 type CaptionEntry = parser.CaptionEntry
+type TimeMs = parser.TimeMs
+type Word = parser.Word
 type CaptionMetadata = ytdlp.CaptionMetadata
 
+const (
+	defaultPageSize = 10
+	maxPageSize     = 100
+	defaultPreTag   = "<mark>"
+	defaultPostTag  = "</mark>"
+	// maxResultWindow matches Elasticsearch's index.max_result_window, deeper pages need a cursor
+	maxResultWindow = 10000
+	// suggestBelow is how few hits a search has to have for spelling suggestions
+	suggestBelow   = 5
+	maxSuggestions = 3
+)
+
+// fuzzinessLevels are the accepted values of SearchParams.Fuzziness
+var fuzzinessLevels = []string{"", "AUTO", "0", "1", "2"}
+
+// Search backends, as named by SEARCH_BACKEND and in SearchResult.Backend
+const (
+	BackendElasticsearch = "elasticsearch"
+	BackendLocal         = "local"
+	BackendMySQL         = "mysql"
+)
+
+// ErrInvalidSearch is returned for search parameters that can't be served
+var ErrInvalidSearch = errors.New("invalid search")
+
+// ErrSearchUnavailable is returned when no search backend can answer
+var ErrSearchUnavailable = errors.New("search is unavailable")
+
+// SearchParams describes a caption search
+type SearchParams struct {
+	Query string
+	// Languages restricts results to captions in any of these languages, empty means all
+	Languages []string
+	// Page is 1-based, Size is the number of hits per page
+	Page int
+	Size int
+	// Cursor continues from the Next cursor of an earlier result, which carries its own Query and Languages
+	Cursor string
+	// PreTag and PostTag wrap matched terms in highlighted text
+	PreTag  string
+	PostTag string
+	// Fuzziness lets words match despite typos, AUTO or at most 0, 1 or 2 edits. Empty means exact matches.
+	Fuzziness string
+	Filters   SearchFilters
+}
+
+// SearchFilters narrow a search down without changing how hits are scored. Empty fields don't filter.
+type SearchFilters struct {
+	// VideoIds restricts results to captions of any of these videos
+	VideoIds  []string `json:"video_ids,omitempty"`
+	ChannelId string   `json:"channel_id,omitempty"`
+	// UploadedAfter and UploadedBefore are YYYY-MM-DD dates, both inclusive
+	UploadedAfter  string `json:"uploaded_after,omitempty"`
+	UploadedBefore string `json:"uploaded_before,omitempty"`
+	// MinStart and MaxStart bound when captions start in their video in milliseconds, inclusive.
+	// Zero MaxStart means no bound.
+	MinStart uint32 `json:"min_start,omitempty"`
+	MaxStart uint32 `json:"max_start,omitempty"`
+}
+
+// validate checks the dates parse and the ranges aren't empty
+func (f SearchFilters) validate() error {
+	for _, date := range []string{f.UploadedAfter, f.UploadedBefore} {
+		if _, err := time.Parse(time.DateOnly, date); date != "" && err != nil {
+			return fmt.Errorf("%w: upload dates must be YYYY-MM-DD", ErrInvalidSearch)
+		}
+	}
+	if f.UploadedAfter != "" && f.UploadedBefore != "" && f.UploadedAfter > f.UploadedBefore {
+		return fmt.Errorf("%w: uploaded_after must not be after uploaded_before", ErrInvalidSearch)
+	}
+	if f.MaxStart != 0 && f.MinStart > f.MaxStart {
+		return fmt.Errorf("%w: min_start must not be after max_start", ErrInvalidSearch)
+	}
+	return nil
+}
+
+// matches reports whether a caption document passes the filters
+func (f SearchFilters) matches(doc esCaption) bool {
+	switch {
+	case len(f.VideoIds) > 0 && !slices.Contains(f.VideoIds, doc.VideoId):
+		return false
+	case f.ChannelId != "" && doc.ChannelId != f.ChannelId:
+		return false
+	case f.UploadedAfter != "" && (doc.UploadDate == "" || doc.UploadDate < f.UploadedAfter):
+		return false
+	case f.UploadedBefore != "" && (doc.UploadDate == "" || doc.UploadDate > f.UploadedBefore):
+		return false
+	case doc.Start < f.MinStart:
+		return false
+	case f.MaxStart != 0 && doc.Start > f.MaxStart:
+		return false
+	}
+	return true
+}
+
+// withDefaults fills in the page and size and checks they are in range
+func (p SearchParams) withDefaults() (SearchParams, error) {
+	if p.Page == 0 {
+		p.Page = 1
+	}
+	if p.Size == 0 {
+		p.Size = defaultPageSize
+	}
+	if p.PreTag == "" && p.PostTag == "" {
+		p.PreTag, p.PostTag = defaultPreTag, defaultPostTag
+	}
+	p.Fuzziness = strings.ToUpper(p.Fuzziness)
+
+	if p.Page < 1 {
+		return p, fmt.Errorf("%w: page must be at least 1", ErrInvalidSearch)
+	}
+	if p.Size < 1 || p.Size > maxPageSize {
+		return p, fmt.Errorf("%w: size must be between 1 and %d", ErrInvalidSearch, maxPageSize)
+	}
+	if p.Cursor == "" && p.Page*p.Size > maxResultWindow {
+		return p, fmt.Errorf("%w: page %d is too deep, use the next cursor instead", ErrInvalidSearch, p.Page)
+	}
+	if !slices.Contains(fuzzinessLevels, p.Fuzziness) {
+		return p, fmt.Errorf("%w: fuzziness must be AUTO, 0, 1 or 2", ErrInvalidSearch)
+	}
+	if err := p.Filters.validate(); err != nil {
+		return p, err
+	}
+	if p.Cursor == "" && p.Query == "" {
+		return p, fmt.Errorf("%w: query is required", ErrInvalidSearch)
+	}
+	return p, nil
+}
+
+// SearchResult is one page of caption search hits
+type SearchResult struct {
+	// Total is how many captions matched, which can be more than the hits returned
+	Total  int64       `json:"total"`
+	TookMs int64       `json:"took_ms"`
+	Hits   []SearchHit `json:"hits"`
+	// Next is an opaque cursor for the following page, empty on the last page
+	Next string `json:"next,omitempty"`
+	// Backend names the search backend that answered
+	Backend string `json:"backend"`
+	// Suggestions are spelling corrections, offered on the first page when it has few hits
+	Suggestions []Suggestion `json:"suggestions,omitempty"`
+}
+
+// Suggestion is a "did you mean" correction of the words a search looked for
+type Suggestion struct {
+	Text string `json:"text"`
+	// Highlighted is Text with the corrected words wrapped in the requested tags
+	Highlighted string `json:"highlighted"`
+	// Query is the search query with the correction applied, ready to search again
+	Query string `json:"query"`
+}
+
+// SearchHit is a single caption matching a search
+type SearchHit struct {
+	Score      float64 `json:"score"`
+	VideoId    string  `json:"video_id"`
+	VideoTitle string  `json:"video_title"`
+	ChannelId  string  `json:"channel_id,omitempty"`
+	UploadDate string  `json:"upload_date,omitempty"`
+	Language   string  `json:"language,omitempty"`
+	Text       string  `json:"text"`
+	StartMs    TimeMs  `json:"start_ms"`
+	EndMs      TimeMs  `json:"end_ms"`
+	Start      string  `json:"start"`
+	End        string  `json:"end"`
+	// WordStartMs is when the first matched word is spoken, if the caption has word timings
+	WordStartMs *TimeMs `json:"word_start_ms,omitempty"`
+	Link        string  `json:"link"`
+	// Highlights is the caption text with matched terms wrapped in the requested tags
+	Highlights []string `json:"highlights,omitempty"`
+	// Matches are the character offsets of the matched terms in Text
+	Matches []MatchOffset `json:"matches,omitempty"`
+}
+
+// MatchOffset is the half-open range [Start, End) of a matched term, counted in characters (Unicode code points)
+type MatchOffset struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// NewSearchHit fills in the formatted times and deep link of a hit from its caption.
+// The link points at the matched word when wordStart is set, otherwise at the start of the caption.
+func NewSearchHit(score float64, meta CaptionMetadata, caption CaptionEntry, wordStart *TimeMs) SearchHit {
+	at := caption.Start
+	if wordStart != nil {
+		at = *wordStart
+	}
+
+	return SearchHit{
+		Score:       score,
+		VideoId:     meta.VideoId,
+		VideoTitle:  meta.VideoTitle,
+		ChannelId:   meta.ChannelId,
+		UploadDate:  meta.UploadDate,
+		Language:    caption.Language,
+		Text:        caption.Text,
+		StartMs:     caption.Start,
+		EndMs:       caption.End,
+		Start:       clockTime(caption.Start),
+		End:         clockTime(caption.End),
+		WordStartMs: wordStart,
+		Link:        videoLink(meta.VideoId, at),
+	}
+}
+
+// clockTime formats a time as HH:MM:SS
+func clockTime(t TimeMs) string {
+	ms := uint32(t)
+	return fmt.Sprintf("%02d:%02d:%02d", ms/3600000, ms/60000%60, ms/1000%60)
+}
+
+// videoLink builds a YouTube short link that starts playback at the given time
+func videoLink(videoId string, at TimeMs) string {
+	return fmt.Sprintf("https://youtu.be/%s?t=%d", videoId, uint32(at)/1000)
+}
+
 type Searcher interface {
 	CreateIndex(ctx context.Context, index string) error
 	IndexCaptions(ctx context.Context, meta *CaptionMetadata, captions []CaptionEntry) error
-	SearchCaptions(ctx context.Context, index string, query string) ([]map[string]any, error)
+	SearchCaptions(ctx context.Context, index string, params SearchParams) (*SearchResult, error)
+	ListVideoIds(ctx context.Context, index string, afterId string, limit int) ([]string, error)
+	GetVideoCaptions(ctx context.Context, index string, videoId string) ([]CaptionEntry, error)
+	DeleteVideo(ctx context.Context, index string, videoId string) (int64, error)
 }
 
 type CaptionSearchService struct {
-	se CaptionSearchRepository
+	se     CaptionSearchRepository
+	writes WriteLog
 }
 
 func NewSearcherService(se CaptionSearchRepository) *CaptionSearchService {
@@ -30,10 +257,33 @@ func (s *CaptionSearchService) CreateIndex(ctx context.Context, index string) er
 	return s.se.CreateIndex(ctx, index)
 }
 
+// Writes is the log of videos written through the service, for a Reindexer to catch up on
+func (s *CaptionSearchService) Writes() *WriteLog {
+	return &s.writes
+}
+
 func (s *CaptionSearchService) IndexCaptions(ctx context.Context, meta *CaptionMetadata, captions []CaptionEntry) error {
+	s.writes.record(meta.VideoId)
 	return s.se.IndexCaptions(ctx, meta, captions)
 }
 
-func (s *CaptionSearchService) SearchCaptions(ctx context.Context, index string, query string) ([]map[string]any, error) {
-	return s.se.SearchCaptions(ctx, index, query)
+func (s *CaptionSearchService) SearchCaptions(ctx context.Context, index string, params SearchParams) (*SearchResult, error) {
+	params, err := params.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+	return s.se.SearchCaptions(ctx, index, params)
+}
+
+func (s *CaptionSearchService) ListVideoIds(ctx context.Context, index string, afterId string, limit int) ([]string, error) {
+	return s.se.ListVideoIds(ctx, index, afterId, limit)
+}
+
+func (s *CaptionSearchService) GetVideoCaptions(ctx context.Context, index string, videoId string) ([]CaptionEntry, error) {
+	return s.se.GetVideoCaptions(ctx, index, videoId)
+}
+
+func (s *CaptionSearchService) DeleteVideo(ctx context.Context, index string, videoId string) (int64, error) {
+	s.writes.record(videoId)
+	return s.se.DeleteVideo(ctx, index, videoId)
 }
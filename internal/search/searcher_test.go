@@ -0,0 +1,58 @@
+package searcher
+
+import "testing"
+
+func TestNewSearchHit(t *testing.T) {
+
+	meta := CaptionMetadata{VideoId: "SampleVideoId", VideoTitle: "Sample Title"}
+	caption := CaptionEntry{VideoId: "SampleVideoId", Language: "en", Start: 3723004, End: 3725500, Text: "hello world"}
+
+	hit := NewSearchHit(1.5, meta, caption, nil)
+
+	if hit.Start != "01:02:03" || hit.End != "01:02:05" {
+		t.Fatalf("unexpected formatted times %q - %q", hit.Start, hit.End)
+	}
+	if hit.Link != "https://youtu.be/SampleVideoId?t=3723" {
+		t.Fatalf("unexpected link %q", hit.Link)
+	}
+	if hit.StartMs != 3723004 || hit.EndMs != 3725500 || hit.Score != 1.5 || hit.VideoTitle != "Sample Title" {
+		t.Fatalf("unexpected hit %+v", hit)
+	}
+
+	wordStart := TimeMs(3724900)
+	hit = NewSearchHit(1.5, meta, caption, &wordStart)
+	if hit.Link != "https://youtu.be/SampleVideoId?t=3724" {
+		t.Fatalf("expected link to the matched word, got %q", hit.Link)
+	}
+}
+
+func TestSearchParamsWithDefaults(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		params   SearchParams
+		wantPage int
+		wantSize int
+		wantErr  bool
+	}{
+		{name: "Defaults", params: SearchParams{Query: "q"}, wantPage: 1, wantSize: defaultPageSize},
+		{name: "Explicit", params: SearchParams{Query: "q", Page: 3, Size: 25}, wantPage: 3, wantSize: 25},
+		{name: "Size too large", params: SearchParams{Query: "q", Size: maxPageSize + 1}, wantErr: true},
+		{name: "Negative page", params: SearchParams{Query: "q", Page: -1}, wantErr: true},
+		{name: "Past the result window", params: SearchParams{Query: "q", Page: 101, Size: 100}, wantErr: true},
+		{name: "Missing query", params: SearchParams{}, wantErr: true},
+		{name: "Cursor without query", params: SearchParams{Cursor: "abc"}, wantPage: 1, wantSize: defaultPageSize},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.params.withDefaults()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error = %v, got %v", tt.wantErr, err)
+			}
+			if !tt.wantErr && (got.Page != tt.wantPage || got.Size != tt.wantSize) {
+				t.Errorf("expected page %d size %d, got page %d size %d", tt.wantPage, tt.wantSize, got.Page, got.Size)
+			}
+		})
+	}
+}
@@ -0,0 +1,387 @@
+package searcher
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// SQLCaptionSearchRepository searches captions straight from MySQL through the FULLTEXT index on
+// Captions.CaptionText. Captions are written to the database by the caption repository, so
+// indexing is a no-op here; it is meant as a fallback for when Elasticsearch is unavailable.
+type SQLCaptionSearchRepository struct {
+	db *sql.DB
+}
+
+func NewSQLSearchRepository(db *sql.DB) *SQLCaptionSearchRepository {
+	return &SQLCaptionSearchRepository{
+		db: db,
+	}
+}
+
+// CreateIndex does nothing, the FULLTEXT index is created by the schema migrations
+func (s *SQLCaptionSearchRepository) CreateIndex(ctx context.Context, index string) error {
+	return nil
+}
+
+// IndexCaptions does nothing, captions are searchable as soon as they are saved to the database
+func (s *SQLCaptionSearchRepository) IndexCaptions(ctx context.Context, meta *CaptionMetadata, captions []CaptionEntry) error {
+	return nil
+}
+
+// SearchCaptions matches each word and phrase of the query in boolean mode and ranks captions by
+// how well they match all of the query's words in natural language mode
+func (s *SQLCaptionSearchRepository) SearchCaptions(ctx context.Context, index string, params SearchParams) (*SearchResult, error) {
+
+	started := time.Now()
+
+	var cursor sqlSearchCursor
+	if params.Cursor != "" {
+		var err error
+		cursor, err = decodeSQLSearchCursor(params.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		params.Query, params.Languages, params.Filters = cursor.Query, cursor.Languages, cursor.Filters
+	} else {
+		cursor = sqlSearchCursor{
+			Backend:   BackendMySQL,
+			Offset:    (params.Page - 1) * params.Size,
+			Query:     params.Query,
+			Languages: params.Languages,
+			Filters:   params.Filters,
+		}
+	}
+
+	query, err := ParseQuery(params.Query)
+	if err != nil {
+		return nil, err
+	}
+
+	where, args := sqlCondition(query.root)
+	filters, filterArgs := sqlFilterCondition(params.Languages, params.Filters)
+	where += filters
+	args = append(args, filterArgs...)
+
+	result := &SearchResult{Backend: BackendMySQL, Hits: []SearchHit{}}
+
+	err = s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM Captions c JOIN Videos v ON v.Id = c.VideoId WHERE `+where+`;`, args...).Scan(&result.Total)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count caption matches: %w", err)
+	}
+
+	score, scoreArgs := `0`, []any(nil)
+	if text := query.FreeText(); text != "" {
+		score, scoreArgs = `MATCH(c.CaptionText) AGAINST (? IN NATURAL LANGUAGE MODE)`, []any{text}
+	}
+
+	searchSql := `SELECT c.VideoId, v.Title, v.VideoUrl, v.ChannelId, v.UploadDate, c.Language, c.StartTime, c.EndTime, c.CaptionText, ` + score + ` AS Score
+		FROM Captions c
+		JOIN Videos v ON v.Id = c.VideoId
+		WHERE ` + where + `
+		ORDER BY Score DESC, c.VideoId, c.Language, c.StartTime
+		LIMIT ? OFFSET ?;`
+
+	rows, err := s.db.QueryContext(ctx, searchSql, append(append(scoreArgs, args...), params.Size, cursor.Offset)...)
+	if err != nil {
+		return nil, fmt.Errorf("search failed: %w", err)
+	}
+	defer rows.Close()
+
+	type captionMatch struct {
+		meta    CaptionMetadata
+		caption CaptionEntry
+		score   float64
+	}
+	var matches []captionMatch
+	for rows.Next() {
+		var m captionMatch
+		var channelId sql.NullString
+		var uploaded sql.NullTime
+		if err := rows.Scan(&m.meta.VideoId, &m.meta.VideoTitle, &m.meta.Url, &channelId, &uploaded, &m.caption.Language, &m.caption.Start, &m.caption.End, &m.caption.Text, &m.score); err != nil {
+			return nil, fmt.Errorf("failed to scan caption match: %w", err)
+		}
+		m.meta.ChannelId = channelId.String
+		if uploaded.Valid {
+			m.meta.UploadDate = uploaded.Time.Format(time.DateOnly)
+		}
+		m.caption.VideoId = m.meta.VideoId
+		matches = append(matches, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read caption matches: %w", err)
+	}
+	rows.Close()
+
+	captions := make([]CaptionEntry, len(matches))
+	for i, m := range matches {
+		captions[i] = m.caption
+	}
+	words, err := s.captionWords(ctx, captions)
+	if err != nil {
+		return nil, err
+	}
+
+	terms := analyzeEnglish(query.FreeText())
+	for _, m := range matches {
+		var wordStart *TimeMs
+		key := captionWordsKey{m.caption.VideoId, m.caption.Language, m.caption.Start}
+		if start, ok := matchedWordStart(words[key], query.FreeText()); ok {
+			wordStart = &start
+		}
+
+		searchHit := NewSearchHit(m.score, m.meta, m.caption, wordStart)
+		highlighted, offsets := highlightTokens(m.caption.Text, terms, params.PreTag, params.PostTag)
+		if len(offsets) > 0 {
+			searchHit.Highlights = []string{highlighted}
+			searchHit.Matches = offsets
+		}
+		result.Hits = append(result.Hits, searchHit)
+	}
+
+	// A full page may have more after it
+	if len(matches) > 0 && len(matches) == params.Size {
+		cursor.Offset += len(matches)
+		result.Next, err = cursor.encode()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	result.TookMs = time.Since(started).Milliseconds()
+	return result, nil
+}
+
+// captionWordsKey identifies a caption among those of several videos
+type captionWordsKey struct {
+	videoId  string
+	language string
+	start    TimeMs
+}
+
+// captionWords loads the word timings of a page of captions in one query
+func (s *SQLCaptionSearchRepository) captionWords(ctx context.Context, captions []CaptionEntry) (map[captionWordsKey][]esWord, error) {
+
+	words := make(map[captionWordsKey][]esWord)
+	if len(captions) == 0 {
+		return words, nil
+	}
+
+	tuples := make([]string, len(captions))
+	args := make([]any, 0, 3*len(captions))
+	for i, caption := range captions {
+		tuples[i] = `(?, ?, ?)`
+		args = append(args, caption.VideoId, caption.Language, caption.Start)
+	}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT VideoId, Language, CaptionStart, StartTime, Word FROM CaptionWords
+		WHERE (VideoId, Language, CaptionStart) IN (`+strings.Join(tuples, `, `)+`)
+		ORDER BY VideoId, Language, CaptionStart, WordIndex;`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get words of %d captions: %w", len(captions), err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key captionWordsKey
+		var w esWord
+		if err := rows.Scan(&key.videoId, &key.language, &key.start, &w.Start, &w.Text); err != nil {
+			return nil, fmt.Errorf("failed to scan caption word: %w", err)
+		}
+		words[key] = append(words[key], w)
+	}
+	return words, rows.Err()
+}
+
+// ListVideoIds returns up to limit ids of videos with captions, ordered by id and starting after afterId
+func (s *SQLCaptionSearchRepository) ListVideoIds(ctx context.Context, index string, afterId string, limit int) ([]string, error) {
+
+	rows, err := s.db.QueryContext(ctx, `SELECT DISTINCT VideoId FROM Captions WHERE VideoId > ? ORDER BY VideoId LIMIT ?;`, afterId, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list videos with captions: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan video id: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// GetVideoCaptions returns every caption of a video without word timings, ordered by language and start time
+func (s *SQLCaptionSearchRepository) GetVideoCaptions(ctx context.Context, index string, videoId string) ([]CaptionEntry, error) {
+
+	rows, err := s.db.QueryContext(ctx, `SELECT Language, StartTime, EndTime, CaptionText FROM Captions
+		WHERE VideoId = ?
+		ORDER BY Language, StartTime;`, videoId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get captions of video %s: %w", videoId, err)
+	}
+	defer rows.Close()
+
+	var captions []CaptionEntry
+	for rows.Next() {
+		caption := CaptionEntry{VideoId: videoId}
+		if err := rows.Scan(&caption.Language, &caption.Start, &caption.End, &caption.Text); err != nil {
+			return nil, fmt.Errorf("failed to scan caption: %w", err)
+		}
+		captions = append(captions, caption)
+	}
+	return captions, rows.Err()
+}
+
+// DeleteVideo does nothing, a video's captions leave the FULLTEXT index when they are deleted from the database
+func (s *SQLCaptionSearchRepository) DeleteVideo(ctx context.Context, index string, videoId string) (int64, error) {
+	return 0, nil
+}
+
+// sqlFilterCondition compiles the languages and filters of a search into conditions ANDed onto
+// the query's, each starting with AND
+func sqlFilterCondition(languages []string, filters SearchFilters) (string, []any) {
+
+	var where strings.Builder
+	var args []any
+	in := func(column string, values []string) {
+		where.WriteString(` AND ` + column + ` IN (` + strings.TrimSuffix(strings.Repeat("?, ", len(values)), ", ") + `)`)
+		for _, v := range values {
+			args = append(args, v)
+		}
+	}
+	compare := func(condition string, arg any) {
+		where.WriteString(` AND ` + condition)
+		args = append(args, arg)
+	}
+
+	if len(languages) > 0 {
+		in(`c.Language`, languages)
+	}
+	if len(filters.VideoIds) > 0 {
+		in(`c.VideoId`, filters.VideoIds)
+	}
+	if filters.ChannelId != "" {
+		compare(`v.ChannelId = ?`, filters.ChannelId)
+	}
+	if filters.UploadedAfter != "" {
+		compare(`v.UploadDate >= ?`, filters.UploadedAfter)
+	}
+	if filters.UploadedBefore != "" {
+		compare(`v.UploadDate <= ?`, filters.UploadedBefore)
+	}
+	if filters.MinStart != 0 {
+		compare(`c.StartTime >= ?`, filters.MinStart)
+	}
+	if filters.MaxStart != 0 {
+		compare(`c.StartTime <= ?`, filters.MaxStart)
+	}
+	return where.String(), args
+}
+
+// sqlCondition compiles a parsed query into a WHERE condition on Captions c joined with Videos v.
+// Words and phrases in caption text are matched in boolean mode, titles with LIKE.
+func sqlCondition(node queryNode) (string, []any) {
+
+	switch n := node.(type) {
+	case *queryTerm:
+		return sqlTermCondition(n)
+	case *queryNot:
+		condition, args := sqlCondition(n.Clause)
+		return `NOT (` + condition + `)`, args
+	}
+
+	group := node.(*queryBool)
+	join := ` AND `
+	if group.Or {
+		join = ` OR `
+	}
+
+	var parts []string
+	var args []any
+	for _, clause := range positiveClauses(group) {
+		condition, clauseArgs := sqlCondition(clause)
+		parts = append(parts, `(`+condition+`)`)
+		args = append(args, clauseArgs...)
+	}
+	condition := strings.Join(parts, join)
+
+	for _, clause := range negativeClauses(group) {
+		excluded, clauseArgs := sqlCondition(clause)
+		condition = `(` + condition + `) AND NOT (` + excluded + `)`
+		args = append(args, clauseArgs...)
+	}
+	return condition, args
+}
+
+func sqlTermCondition(t *queryTerm) (string, []any) {
+
+	switch t.Field {
+	case fieldVideo:
+		return `c.VideoId = ?`, []any{t.Text}
+	case fieldChannel:
+		return `v.ChannelId = ?`, []any{t.Text}
+	case fieldTitle:
+		return `v.Title LIKE ?`, []any{`%` + likeEscaper.Replace(t.Text) + `%`}
+	}
+
+	// Operators of MySQL's boolean mode are spaces here, so a word can't turn into one
+	text := strings.Join(strings.FieldsFunc(t.Text, func(r rune) bool {
+		return unicode.IsSpace(r) || strings.ContainsRune(`+-<>()~*"@`, r)
+	}), " ")
+	if t.Phrase {
+		text = `"` + text + `"`
+		if t.Slop > 0 {
+			// Proximity counts the words of the phrase as well as the ones allowed between them
+			text += fmt.Sprintf(" @%d", len(strings.Fields(text))+t.Slop)
+		}
+	}
+	return `MATCH(c.CaptionText) AGAINST (? IN BOOLEAN MODE)`, []any{text}
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// sqlSearchCursor continues a database search at an offset, Backend tells it apart from the
+// cursors of other backends
+type sqlSearchCursor struct {
+	Backend   string        `json:"backend"`
+	Offset    int           `json:"offset"`
+	Query     string        `json:"query"`
+	Languages []string      `json:"languages,omitempty"`
+	Filters   SearchFilters `json:"filters"`
+}
+
+func (c sqlSearchCursor) encode() (string, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode search cursor: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeSQLSearchCursor(s string) (sqlSearchCursor, error) {
+	var c sqlSearchCursor
+
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, fmt.Errorf("%w: malformed cursor", ErrInvalidSearch)
+	}
+	if err := json.NewDecoder(bytes.NewReader(data)).Decode(&c); err != nil || c.Backend != BackendMySQL || c.Offset < 0 {
+		return c, fmt.Errorf("%w: malformed cursor", ErrInvalidSearch)
+	}
+	return c, nil
+}
+
+// ownsCursor reports whether a cursor came from this backend
+func (s *SQLCaptionSearchRepository) ownsCursor(cursor string) bool {
+	_, err := decodeSQLSearchCursor(cursor)
+	return err == nil
+}
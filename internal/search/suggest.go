@@ -0,0 +1,161 @@
+package searcher
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxEdits is how many edits fuzziness allows for a term. AUTO allows none for terms of one or
+// two characters, one for three to five and two for longer ones, the same as Elasticsearch.
+func maxEdits(term string, fuzziness string) int {
+	if fuzziness != "AUTO" {
+		edits, _ := strconv.Atoi(fuzziness)
+		return edits
+	}
+	switch n := utf8.RuneCountInString(term); {
+	case n <= 2:
+		return 0
+	case n <= 5:
+		return 1
+	}
+	return 2
+}
+
+// editDistance counts the insertions, deletions, substitutions and transpositions of adjacent
+// characters turning a into b. It gives up once the distance is over limit, returning limit+1.
+func editDistance(a, b string, limit int) int {
+
+	ra, rb := []rune(a), []rune(b)
+	if abs(len(ra)-len(rb)) > limit {
+		return limit + 1
+	}
+
+	// Rows of the optimal string alignment matrix, two back for transpositions
+	prev2 := make([]int, len(rb)+1)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		best := cur[0]
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				cur[j] = min(cur[j], prev2[j-2]+1)
+			}
+			best = min(best, cur[j])
+		}
+		if best > limit {
+			return limit + 1
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+	return prev[len(rb)]
+}
+
+// suggestionWord is a lower-cased word of a query and where it is, in characters
+type suggestionWord struct {
+	Text  string
+	Start int
+	End   int
+}
+
+// suggestionWords splits text into lower-cased words the way the standard tokenizer does,
+// keeping apostrophes inside words
+func suggestionWords(text string) []suggestionWord {
+
+	var words []suggestionWord
+	runes := []rune(text)
+	for i := 0; i < len(runes); {
+		if !isWordRune(runes[i]) {
+			i++
+			continue
+		}
+		start := i
+		for i < len(runes) && (isWordRune(runes[i]) || (runes[i] == '\'' && i+1 < len(runes) && isWordRune(runes[i+1]))) {
+			i++
+		}
+		words = append(words, suggestionWord{Text: strings.ToLower(string(runes[start:i])), Start: start, End: i})
+	}
+	return words
+}
+
+// newSuggestion turns a correction of the query's free text into a suggestion, rewriting the
+// corrected words wherever the query looks for them in caption text. It returns false when the
+// correction changes nothing or doesn't line up word for word.
+func newSuggestion(query *Query, corrected string, preTag, postTag string) (Suggestion, bool) {
+
+	original := suggestionWords(query.FreeText())
+	fixed := suggestionWords(corrected)
+	if len(original) != len(fixed) {
+		return Suggestion{}, false
+	}
+
+	corrections := make(map[string]string)
+	var texts, highlighted []string
+	for i := range original {
+		texts = append(texts, fixed[i].Text)
+		if original[i].Text == fixed[i].Text {
+			highlighted = append(highlighted, fixed[i].Text)
+			continue
+		}
+		corrections[original[i].Text] = fixed[i].Text
+		highlighted = append(highlighted, preTag+fixed[i].Text+postTag)
+	}
+	if len(corrections) == 0 {
+		return Suggestion{}, false
+	}
+
+	return Suggestion{
+		Text:        strings.Join(texts, " "),
+		Highlighted: strings.Join(highlighted, " "),
+		Query:       query.corrected(corrections),
+	}, true
+}
+
+// corrected rewrites the query, replacing words it looks for in caption text
+func (q *Query) corrected(corrections map[string]string) string {
+
+	var terms []*queryTerm
+	var walk func(node queryNode)
+	walk = func(node queryNode) {
+		switch n := node.(type) {
+		case *queryTerm:
+			if n.Field == fieldText {
+				terms = append(terms, n)
+			}
+		case *queryBool:
+			for _, clause := range positiveClauses(n) {
+				walk(clause)
+			}
+		}
+	}
+	walk(q.root)
+	sort.Slice(terms, func(i, j int) bool { return terms[i].Pos < terms[j].Pos })
+
+	runes := []rune(q.text)
+	var out strings.Builder
+	last := 0
+	for _, term := range terms {
+		for _, word := range suggestionWords(string(runes[term.Pos:term.End])) {
+			replacement, ok := corrections[word.Text]
+			if !ok {
+				continue
+			}
+			out.WriteString(string(runes[last : term.Pos+word.Start]))
+			out.WriteString(replacement)
+			last = term.Pos + word.End
+		}
+	}
+	out.WriteString(string(runes[last:]))
+	return out.String()
+}
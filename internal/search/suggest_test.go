@@ -0,0 +1,106 @@
+package searcher
+
+import (
+	"context"
+	"testing"
+)
+
+func TestEditDistance(t *testing.T) {
+
+	cases := []struct {
+		a, b  string
+		limit int
+		want  int
+	}{
+		{"bread", "bread", 2, 0},
+		{"bread", "braed", 2, 1},
+		{"bread", "brad", 2, 1},
+		{"bread", "breads", 2, 1},
+		{"tomatoes", "tomatos", 2, 1},
+		{"flour", "floor", 2, 1},
+		{"bread", "water", 2, 3},
+		{"a", "abcdef", 1, 2},
+	}
+	for _, c := range cases {
+		if got := editDistance(c.a, c.b, c.limit); got != c.want {
+			t.Fatalf("editDistance(%q, %q, %d): expected %d, got %d", c.a, c.b, c.limit, c.want, got)
+		}
+	}
+}
+
+func TestMaxEdits(t *testing.T) {
+
+	cases := []struct {
+		term, fuzziness string
+		want            int
+	}{
+		{"ab", "AUTO", 0},
+		{"abc", "AUTO", 1},
+		{"abcde", "AUTO", 1},
+		{"abcdef", "AUTO", 2},
+		{"ab", "2", 2},
+		{"abcdef", "", 0},
+	}
+	for _, c := range cases {
+		if got := maxEdits(c.term, c.fuzziness); got != c.want {
+			t.Fatalf("maxEdits(%q, %q): expected %d, got %d", c.term, c.fuzziness, c.want, got)
+		}
+	}
+}
+
+func TestNewSuggestion(t *testing.T) {
+
+	query, err := ParseQuery(`"braed and buter" -salt title:tomatos`)
+	if err != nil {
+		t.Fatalf("ParseQuery failed: %v", err)
+	}
+
+	suggestion, ok := newSuggestion(query, "bread and butter", "<b>", "</b>")
+	if !ok {
+		t.Fatal("expected a suggestion")
+	}
+	if suggestion.Text != "bread and butter" || suggestion.Highlighted != "<b>bread</b> and <b>butter</b>" {
+		t.Fatalf("unexpected suggestion %+v", suggestion)
+	}
+	// Only the words searched for in caption text are corrected
+	if suggestion.Query != `"bread and butter" -salt title:tomatos` {
+		t.Fatalf("unexpected corrected query %q", suggestion.Query)
+	}
+
+	if _, ok := newSuggestion(query, "braed and buter", "<b>", "</b>"); ok {
+		t.Fatal("expected no suggestion when nothing changes")
+	}
+	if _, ok := newSuggestion(query, "bread", "<b>", "</b>"); ok {
+		t.Fatal("expected no suggestion when words don't line up")
+	}
+}
+
+func TestLocalSearchFuzziness(t *testing.T) {
+
+	svc := newLocalTestRepo(t, t.TempDir())
+	indexLocalTestVideos(t, svc)
+	ctx := context.Background()
+
+	res, err := svc.SearchCaptions(ctx, "captions", SearchParams{Query: "tomatoez"})
+	if err != nil {
+		t.Fatalf("SearchCaptions failed: %v", err)
+	}
+	if res.Total != 0 {
+		t.Fatalf("expected no exact hits, got %+v", res)
+	}
+	if len(res.Suggestions) != 1 || res.Suggestions[0].Query != "tomatoes" {
+		t.Fatalf("expected a suggestion of tomatoes, got %+v", res.Suggestions)
+	}
+
+	res, err = svc.SearchCaptions(ctx, "captions", SearchParams{Query: "tomatoez", Fuzziness: "auto"})
+	if err != nil {
+		t.Fatalf("SearchCaptions failed: %v", err)
+	}
+	if res.Total != 2 {
+		t.Fatalf("expected 2 fuzzy hits, got %+v", res)
+	}
+
+	if _, err := svc.SearchCaptions(ctx, "captions", SearchParams{Query: "bread", Fuzziness: "3"}); err == nil {
+		t.Fatal("expected an error for fuzziness 3")
+	}
+}
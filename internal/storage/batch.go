@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// defaultInsertBatchSize is how many rows go into one multi-row INSERT
+	defaultInsertBatchSize = 500
+	// defaultMaxPacket is MySQL 5.7's max_allowed_packet, assumed when the server can't be asked
+	defaultMaxPacket = 4 << 20
+	// maxPlaceholders is the most parameters SQLite accepts in one statement, MySQL allows 65535
+	maxPlaceholders = 32766
+	// argOverhead roughly covers the per-parameter bytes in a statement packet besides the value
+	argOverhead = 16
+)
+
+// insertBatchSize reads DB_INSERT_BATCH_SIZE, falling back to defaultInsertBatchSize
+func insertBatchSize() int {
+	val := os.Getenv("DB_INSERT_BATCH_SIZE")
+	if val == "" {
+		return defaultInsertBatchSize
+	}
+	n, err := strconv.Atoi(val)
+	if err != nil || n <= 0 {
+		log.Printf("Invalid value %q for DB_INSERT_BATCH_SIZE, using default %d", val, defaultInsertBatchSize)
+		return defaultInsertBatchSize
+	}
+	return n
+}
+
+// packetLimit caches the server's max_allowed_packet
+type packetLimit struct {
+	once  sync.Once
+	bytes int
+}
+
+// get returns the largest statement a batch may grow to, half of max_allowed_packet to leave
+// room for the protocol around the values
+func (p *packetLimit) get(ctx context.Context, db *sql.DB, d *dialect) int {
+	p.once.Do(func() {
+		p.bytes = defaultMaxPacket
+		if d.maxPacketSql == "" {
+			return
+		}
+		var maxPacket int
+		if err := db.QueryRowContext(ctx, d.maxPacketSql).Scan(&maxPacket); err != nil {
+			log.Printf("Failed to read max_allowed_packet, assuming %d bytes: %v", defaultMaxPacket, err)
+			return
+		}
+		p.bytes = maxPacket
+	})
+	return p.bytes / 2
+}
+
+// insertBatched inserts rows with multi-row INSERT statements of up to batchSize rows each. A
+// batch is sent early when the next row would take it past maxBytes. insertSql is the statement
+// up to and including VALUES, and row returns the values of row i, one per column.
+func insertBatched(ctx context.Context, tx *sql.Tx, insertSql string, columns, rows, batchSize, maxBytes int, row func(i int) []any) error {
+
+	batchSize = max(1, min(batchSize, maxPlaceholders/columns))
+	tuple := "(" + strings.TrimSuffix(strings.Repeat("?, ", columns), ", ") + ")"
+
+	args := make([]any, 0, batchSize*columns)
+	size, count := len(insertSql), 0
+
+	flush := func() error {
+		if count == 0 {
+			return nil
+		}
+		query := insertSql + " " + strings.TrimSuffix(strings.Repeat(tuple+", ", count), ", ") + ";"
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return err
+		}
+		args, size, count = args[:0], len(insertSql), 0
+		return nil
+	}
+
+	for i := 0; i < rows; i++ {
+		values := row(i)
+		rowSize := len(tuple) + 2
+		for _, v := range values {
+			rowSize += argSize(v)
+		}
+
+		if count == batchSize || (count > 0 && size+rowSize > maxBytes) {
+			if err := flush(); err != nil {
+				return fmt.Errorf("failed to insert rows %d to %d: %w", i-count, i-1, err)
+			}
+		}
+		args = append(args, values...)
+		size += rowSize
+		count++
+	}
+
+	if err := flush(); err != nil {
+		return fmt.Errorf("failed to insert rows %d to %d: %w", rows-count, rows-1, err)
+	}
+	return nil
+}
+
+// argSize estimates the bytes a parameter takes in a statement packet
+func argSize(v any) int {
+	if s, ok := v.(string); ok {
+		return len(s) + argOverhead
+	}
+	return argOverhead
+}
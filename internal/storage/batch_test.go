@@ -0,0 +1,169 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// roundTripDriver is a database driver that records the statements it executes and waits
+// latency on each one, standing in for the network round trip to MySQL
+type roundTripDriver struct {
+	mu       sync.Mutex
+	latency  time.Duration
+	executed []string
+	args     int
+}
+
+func (d *roundTripDriver) Open(name string) (driver.Conn, error) { return roundTripConn{d}, nil }
+
+type roundTripConn struct{ d *roundTripDriver }
+
+func (c roundTripConn) Prepare(query string) (driver.Stmt, error) {
+	return roundTripStmt{c.d, query}, nil
+}
+func (c roundTripConn) Close() error              { return nil }
+func (c roundTripConn) Begin() (driver.Tx, error) { return roundTripTx{}, nil }
+
+type roundTripTx struct{}
+
+func (roundTripTx) Commit() error   { return nil }
+func (roundTripTx) Rollback() error { return nil }
+
+type roundTripStmt struct {
+	d     *roundTripDriver
+	query string
+}
+
+func (s roundTripStmt) Close() error  { return nil }
+func (s roundTripStmt) NumInput() int { return -1 }
+func (s roundTripStmt) Exec(args []driver.Value) (driver.Result, error) {
+	time.Sleep(s.d.latency)
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+	s.d.executed = append(s.d.executed, s.query)
+	s.d.args += len(args)
+	return driver.RowsAffected(1), nil
+}
+func (s roundTripStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return nil, fmt.Errorf("not supported")
+}
+
+// openRoundTrip opens a transaction on a fresh roundTripDriver
+func openRoundTrip(t testing.TB, latency time.Duration) (*roundTripDriver, *sql.Tx) {
+	d := &roundTripDriver{latency: latency}
+	name := fmt.Sprintf("roundtrip-%s-%d", t.Name(), time.Now().UnixNano())
+	sql.Register(name, d)
+
+	db, err := sql.Open(name, "")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("failed to begin: %v", err)
+	}
+	t.Cleanup(func() { tx.Rollback() })
+	return d, tx
+}
+
+func sampleCaptions(n int) []CaptionEntry {
+	captions := make([]CaptionEntry, n)
+	for i := range captions {
+		captions[i] = CaptionEntry{
+			VideoId:  "SampleVideoId",
+			Language: "en",
+			Start:    TimeMs(i * 2000),
+			End:      TimeMs(i*2000 + 1900),
+			Text:     fmt.Sprintf("caption number %d of a long podcast", i),
+		}
+	}
+	return captions
+}
+
+func captionRow(captions []CaptionEntry) func(i int) []any {
+	return func(i int) []any {
+		c := captions[i]
+		return []any{c.VideoId, c.Language, c.Start, c.End, c.Text}
+	}
+}
+
+const testInsertSql = `INSERT INTO Captions (VideoId, Language, StartTime, EndTime, CaptionText) VALUES`
+
+func TestInsertBatched(t *testing.T) {
+
+	d, tx := openRoundTrip(t, 0)
+	captions := sampleCaptions(7)
+
+	if err := insertBatched(context.Background(), tx, testInsertSql, 5, len(captions), 3, 1<<20, captionRow(captions)); err != nil {
+		t.Fatalf("insertBatched failed: %v", err)
+	}
+	if len(d.executed) != 3 || d.args != 35 {
+		t.Fatalf("expected 3 statements with 35 values, got %d with %d", len(d.executed), d.args)
+	}
+	if n := strings.Count(d.executed[0], "(?, ?, ?, ?, ?)"); n != 3 {
+		t.Fatalf("expected 3 rows in the first statement, got %d: %s", n, d.executed[0])
+	}
+
+	// A small packet limit splits batches before they are full
+	d, tx = openRoundTrip(t, 0)
+	if err := insertBatched(context.Background(), tx, testInsertSql, 5, len(captions), 100, 400, captionRow(captions)); err != nil {
+		t.Fatalf("insertBatched failed: %v", err)
+	}
+	if len(d.executed) < 3 || d.args != 35 {
+		t.Fatalf("expected the packet limit to split the insert, got %d statements with %d values", len(d.executed), d.args)
+	}
+}
+
+// insertCaptionsLoop is the one prepared INSERT per caption that batching replaced, kept to compare against
+func insertCaptionsLoop(ctx context.Context, tx *sql.Tx, captions []CaptionEntry) error {
+	st, err := tx.PrepareContext(ctx, `INSERT INTO Captions (VideoId, Language, StartTime, EndTime, CaptionText) VALUES (?, ?, ?, ?, ?);`)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	for _, c := range captions {
+		if _, err := st.ExecContext(ctx, c.VideoId, c.Language, c.Start, c.End, c.Text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// benchLatency is a round trip to a database on the same network
+const benchLatency = 200 * time.Microsecond
+
+// BenchmarkInsertCaptions inserts the 4,000 cues of a three hour podcast
+func BenchmarkInsertCaptions(b *testing.B) {
+
+	captions := sampleCaptions(4000)
+
+	b.Run("loop", func(b *testing.B) {
+		_, tx := openRoundTrip(b, benchLatency)
+		for b.Loop() {
+			if err := insertCaptionsLoop(context.Background(), tx, captions); err != nil {
+				b.Fatal(err)
+			}
+		}
+		b.ReportMetric(float64(len(captions)*b.N)/b.Elapsed().Seconds(), "rows/s")
+	})
+
+	b.Run("batched", func(b *testing.B) {
+		_, tx := openRoundTrip(b, benchLatency)
+		for b.Loop() {
+			err := insertBatched(context.Background(), tx, testInsertSql, 5, len(captions), defaultInsertBatchSize, defaultMaxPacket/2, captionRow(captions))
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+		b.ReportMetric(float64(len(captions)*b.N)/b.Elapsed().Seconds(), "rows/s")
+	})
+}
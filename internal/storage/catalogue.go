@@ -0,0 +1,231 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Video catalogue sort orders
+const (
+	SortIngested = "ingested_at"
+	SortTitle    = "title"
+)
+
+const (
+	defaultVideoPageSize = 20
+	maxVideoPageSize     = 100
+)
+
+// ErrInvalidVideoQuery is returned for catalogue and transcript reads with bad parameters
+var ErrInvalidVideoQuery = errors.New("invalid video query")
+
+// Video is a video in the catalogue
+type Video struct {
+	VideoId    string    `json:"video_id"`
+	Title      string    `json:"title"`
+	Url        string    `json:"url"`
+	IngestedAt time.Time `json:"ingested_at"`
+	// Languages is only filled in for a single video
+	Languages []VideoLanguage `json:"languages,omitempty"`
+}
+
+// VideoLanguage summarises a video's captions in one language
+type VideoLanguage struct {
+	Language string `json:"language"`
+	Captions int    `json:"captions"`
+	// End is when the last caption ends, roughly the length of the video
+	End TimeMs `json:"end"`
+}
+
+// VideoQuery selects a page of the catalogue. Sort is SortIngested (the default) or SortTitle and
+// Order is "asc" or "desc", by default newest first or titles from A to Z.
+type VideoQuery struct {
+	Sort  string
+	Order string
+	Page  int
+	Size  int
+}
+
+// VideoPage is one page of the catalogue
+type VideoPage struct {
+	Total  int     `json:"total"`
+	Page   int     `json:"page"`
+	Size   int     `json:"size"`
+	Videos []Video `json:"videos"`
+}
+
+// CaptionWindow selects the captions of a video overlapping [From, To). A zero To reads to the
+// end, an empty Language reads every language.
+type CaptionWindow struct {
+	From     TimeMs
+	To       TimeMs
+	Language string
+}
+
+func (q VideoQuery) withDefaults() (VideoQuery, error) {
+	if q.Sort == "" {
+		q.Sort = SortIngested
+	}
+	if q.Sort != SortIngested && q.Sort != SortTitle {
+		return q, fmt.Errorf("%w: unknown sort %q", ErrInvalidVideoQuery, q.Sort)
+	}
+	if q.Order == "" {
+		q.Order = "asc"
+		if q.Sort == SortIngested {
+			q.Order = "desc"
+		}
+	}
+	if q.Order != "asc" && q.Order != "desc" {
+		return q, fmt.Errorf("%w: order must be asc or desc", ErrInvalidVideoQuery)
+	}
+	if q.Page < 0 || q.Size < 0 {
+		return q, fmt.Errorf("%w: page and size must not be negative", ErrInvalidVideoQuery)
+	}
+	if q.Page == 0 {
+		q.Page = 1
+	}
+	if q.Size == 0 {
+		q.Size = defaultVideoPageSize
+	}
+	if q.Size > maxVideoPageSize {
+		q.Size = maxVideoPageSize
+	}
+	return q, nil
+}
+
+// orderBy returns the ORDER BY clause of the query, with the id breaking ties so pages are stable
+func (q VideoQuery) orderBy() string {
+	column := "IngestedAt"
+	if q.Sort == SortTitle {
+		column = "Title"
+	}
+	if q.Order == "desc" {
+		return column + " DESC, Id DESC"
+	}
+	return column + ", Id"
+}
+
+// QueryVideos returns a page of the catalogue
+func (s *SQLCaptionRepository) QueryVideos(ctx context.Context, q VideoQuery) (*VideoPage, error) {
+
+	q, err := q.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+
+	page := &VideoPage{Page: q.Page, Size: q.Size, Videos: []Video{}}
+	err = s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM Videos;`).Scan(&page.Total)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count videos: %w", err)
+	}
+
+	queryVideosSql := `SELECT Id, Title, VideoUrl, IngestedAt FROM Videos ORDER BY ` + q.orderBy() + ` LIMIT ? OFFSET ?;`
+
+	rows, err := s.db.QueryContext(ctx, queryVideosSql, q.Size, (q.Page-1)*q.Size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list videos: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var video Video
+		if err := rows.Scan(&video.VideoId, &video.Title, &video.Url, &video.IngestedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan video: %w", err)
+		}
+		page.Videos = append(page.Videos, video)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list videos: %w", err)
+	}
+	return page, nil
+}
+
+// GetVideoDetails returns a video with a summary of its captions per language, or ErrVideoNotFound
+func (s *SQLCaptionRepository) GetVideoDetails(ctx context.Context, videoId string) (*Video, error) {
+
+	video := &Video{Languages: []VideoLanguage{}}
+	err := s.db.QueryRowContext(ctx, `SELECT Id, Title, VideoUrl, IngestedAt FROM Videos WHERE Id = ?;`, videoId).
+		Scan(&video.VideoId, &video.Title, &video.Url, &video.IngestedAt)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", ErrVideoNotFound, videoId)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get video %s: %w", videoId, err)
+	}
+
+	languagesSql := `SELECT Language, COUNT(*), MAX(EndTime) FROM Captions
+						WHERE VideoId = ? GROUP BY Language ORDER BY Language;`
+
+	rows, err := s.db.QueryContext(ctx, languagesSql, videoId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get caption languages for video %s: %w", videoId, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var lang VideoLanguage
+		if err := rows.Scan(&lang.Language, &lang.Captions, &lang.End); err != nil {
+			return nil, fmt.Errorf("failed to scan caption language for video %s: %w", videoId, err)
+		}
+		video.Languages = append(video.Languages, lang)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get caption languages for video %s: %w", videoId, err)
+	}
+	return video, nil
+}
+
+// GetCaptionWindow returns the captions of a video that overlap the window with their word
+// timings, ordered by language and start time. Returns ErrVideoNotFound for unknown videos.
+func (s *SQLCaptionRepository) GetCaptionWindow(ctx context.Context, videoId string, window CaptionWindow) ([]CaptionEntry, error) {
+
+	if window.To != 0 && window.To <= window.From {
+		return nil, fmt.Errorf("%w: to must be after from", ErrInvalidVideoQuery)
+	}
+	if _, err := s.GetVideo(ctx, videoId); err != nil {
+		return nil, err
+	}
+
+	// The StartTime bound is a range scan on idx_vid_start
+	getWindowSql := `SELECT Language, StartTime, EndTime, CaptionText FROM Captions
+						WHERE VideoId = ? AND StartTime < ? AND EndTime > ?`
+	to := window.To
+	if to == 0 {
+		to = TimeMs(^uint32(0))
+	}
+	args := []any{videoId, to, window.From}
+	if window.Language != "" {
+		getWindowSql += ` AND Language = ?`
+		args = append(args, window.Language)
+	}
+	getWindowSql += ` ORDER BY Language, StartTime;`
+
+	rows, err := s.db.QueryContext(ctx, getWindowSql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get captions for video %s: %w", videoId, err)
+	}
+	defer rows.Close()
+
+	captions := []CaptionEntry{}
+	for rows.Next() {
+		caption := CaptionEntry{VideoId: videoId}
+		if err := rows.Scan(&caption.Language, &caption.Start, &caption.End, &caption.Text); err != nil {
+			return nil, fmt.Errorf("failed to scan caption for video %s: %w", videoId, err)
+		}
+		captions = append(captions, caption)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get captions for video %s: %w", videoId, err)
+	}
+
+	if len(captions) == 0 {
+		return captions, nil
+	}
+
+	err = s.attachWords(ctx, videoId, captions)
+	return captions, err
+}
@@ -0,0 +1,162 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestVideoQueryOrderBy(t *testing.T) {
+
+	tests := []struct {
+		query VideoQuery
+		want  string
+	}{
+		{query: VideoQuery{}, want: "IngestedAt DESC, Id DESC"},
+		{query: VideoQuery{Order: "asc"}, want: "IngestedAt, Id"},
+		{query: VideoQuery{Sort: SortTitle}, want: "Title, Id"},
+		{query: VideoQuery{Sort: SortTitle, Order: "desc"}, want: "Title DESC, Id DESC"},
+	}
+
+	for _, tt := range tests {
+		q, err := tt.query.withDefaults()
+		if err != nil {
+			t.Fatalf("%+v: withDefaults failed: %v", tt.query, err)
+		}
+		if got := q.orderBy(); got != tt.want {
+			t.Fatalf("%+v: expected ORDER BY %q, got %q", tt.query, tt.want, got)
+		}
+	}
+
+	for _, q := range []VideoQuery{{Sort: "views"}, {Order: "up"}, {Page: -1}, {Size: -1}} {
+		if _, err := q.withDefaults(); !errors.Is(err, ErrInvalidVideoQuery) {
+			t.Fatalf("%+v: expected ErrInvalidVideoQuery, got %v", q, err)
+		}
+	}
+}
+
+// newCatalogueRepo stores videos ingested in the given order, a and b at the same time
+func newCatalogueRepo(t *testing.T) *SQLCaptionRepository {
+	t.Helper()
+	repo := newSqliteRepo(t)
+	ctx := context.Background()
+
+	videos := []struct {
+		meta       CaptionMetadata
+		ingestedAt string
+	}{
+		{CaptionMetadata{VideoId: "d", VideoTitle: "delta"}, "2024-01-01 00:00:00"},
+		{CaptionMetadata{VideoId: "b", VideoTitle: "Bravo"}, "2024-01-02 00:00:00"},
+		{CaptionMetadata{VideoId: "a", VideoTitle: "alpha"}, "2024-01-02 00:00:00"},
+		{CaptionMetadata{VideoId: "c", VideoTitle: "charlie"}, "2024-01-03 00:00:00"},
+		{CaptionMetadata{VideoId: "e", VideoTitle: "alpha"}, "2024-01-04 00:00:00"},
+	}
+	for _, v := range videos {
+		if err := repo.SaveCaptions(ctx, &v.meta, nil); err != nil {
+			t.Fatalf("SaveCaptions failed: %v", err)
+		}
+		if _, err := repo.db.ExecContext(ctx, `UPDATE Videos SET IngestedAt = ? WHERE Id = ?;`, v.ingestedAt, v.meta.VideoId); err != nil {
+			t.Fatalf("failed to set IngestedAt: %v", err)
+		}
+	}
+	return repo
+}
+
+func TestQueryVideosSortAndPages(t *testing.T) {
+
+	repo := newCatalogueRepo(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		name  string
+		query VideoQuery
+		want  []string
+	}{
+		{name: "Newest first by default, ties by id", query: VideoQuery{}, want: []string{"e", "c", "b", "a", "d"}},
+		{name: "Oldest first", query: VideoQuery{Order: "asc"}, want: []string{"d", "a", "b", "c", "e"}},
+		{name: "Titles ignore case, ties by id", query: VideoQuery{Sort: SortTitle}, want: []string{"a", "e", "b", "c", "d"}},
+		{name: "Titles from Z to A", query: VideoQuery{Sort: SortTitle, Order: "desc"}, want: []string{"d", "c", "b", "e", "a"}},
+		{name: "Second page", query: VideoQuery{Page: 2, Size: 2}, want: []string{"b", "a"}},
+		{name: "Last page is short", query: VideoQuery{Page: 3, Size: 2}, want: []string{"d"}},
+		{name: "Past the last page", query: VideoQuery{Page: 4, Size: 2}, want: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := repo.QueryVideos(ctx, tt.query)
+			if err != nil {
+				t.Fatalf("QueryVideos failed: %v", err)
+			}
+			if page.Total != 5 {
+				t.Fatalf("expected 5 videos in total, got %d", page.Total)
+			}
+			got := []string{}
+			for _, v := range page.Videos {
+				got = append(got, v.VideoId)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+
+	page, err := repo.QueryVideos(ctx, VideoQuery{Size: 1000})
+	if err != nil || page.Size != maxVideoPageSize || page.Page != 1 {
+		t.Fatalf("expected the page size to be capped, got %+v, %v", page, err)
+	}
+}
+
+func TestGetCaptionWindow(t *testing.T) {
+
+	repo := newSqliteRepo(t)
+	ctx := context.Background()
+
+	meta := &CaptionMetadata{VideoId: "vid1", VideoTitle: "First"}
+	en := []CaptionEntry{
+		{VideoId: "vid1", Language: "en", Start: 0, End: 1000, Text: "one"},
+		{VideoId: "vid1", Language: "en", Start: 1000, End: 2000, Text: "two"},
+		{VideoId: "vid1", Language: "en", Start: 2000, End: 3000, Text: "three"},
+	}
+	de := []CaptionEntry{{VideoId: "vid1", Language: "de", Start: 500, End: 2500, Text: "eins zwei"}}
+	for _, captions := range [][]CaptionEntry{en, de} {
+		if err := repo.SaveCaptions(ctx, meta, captions); err != nil {
+			t.Fatalf("SaveCaptions failed: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		window CaptionWindow
+		want   []string
+	}{
+		{name: "Whole video by language then start", window: CaptionWindow{}, want: []string{"eins zwei", "one", "two", "three"}},
+		{name: "Captions touching the edges are left out", window: CaptionWindow{From: 1000, To: 2000}, want: []string{"eins zwei", "two"}},
+		{name: "Overlapping captions are kept", window: CaptionWindow{From: 999, To: 1001, Language: "en"}, want: []string{"one", "two"}},
+		{name: "To end of video", window: CaptionWindow{From: 2500, Language: "en"}, want: []string{"three"}},
+		{name: "Unknown language", window: CaptionWindow{Language: "fr"}, want: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			captions, err := repo.GetCaptionWindow(ctx, "vid1", tt.window)
+			if err != nil {
+				t.Fatalf("GetCaptionWindow failed: %v", err)
+			}
+			got := []string{}
+			for _, c := range captions {
+				got = append(got, c.Text)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+
+	if _, err := repo.GetCaptionWindow(ctx, "vid1", CaptionWindow{From: 2000, To: 1000}); !errors.Is(err, ErrInvalidVideoQuery) {
+		t.Fatalf("expected ErrInvalidVideoQuery, got %v", err)
+	}
+	if _, err := repo.GetCaptionWindow(ctx, "missing", CaptionWindow{}); !errors.Is(err, ErrVideoNotFound) {
+		t.Fatalf("expected ErrVideoNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+)
+
+// DeletedVideo counts the rows a video deletion removed, or would remove in a dry run
+type DeletedVideo struct {
+	Captions int64 `json:"captions"`
+	Words    int64 `json:"words"`
+}
+
+// DeleteVideo removes a video with its captions and word timings, and queues the video in the
+// search outbox so its documents are removed from the index too. With dryRun set nothing is
+// changed and the rows that would be removed are counted instead. Returns ErrVideoNotFound if
+// the video isn't in the database.
+func (s *SQLCaptionRepository) DeleteVideo(ctx context.Context, videoId string, dryRun bool) (deleted *DeletedVideo, err error) {
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction %w", err)
+	}
+
+	defer func() {
+		if err != nil || dryRun {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+		if err != nil {
+			err = fmt.Errorf("failed to commit deletion of video %s: %w", videoId, err)
+		}
+	}()
+
+	// Lock the video row so an ingestion can't add captions while it is being deleted
+	var id string
+	err = tx.QueryRowContext(ctx, s.dialect.lockVideo, videoId).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", ErrVideoNotFound, videoId)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get video %s: %w", videoId, err)
+	}
+
+	deleted = &DeletedVideo{}
+
+	if dryRun {
+		err = tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM Captions WHERE VideoId = ?;`, videoId).Scan(&deleted.Captions)
+		if err != nil {
+			return nil, fmt.Errorf("failed to count captions of video %s: %w", videoId, err)
+		}
+		err = tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM CaptionWords WHERE VideoId = ?;`, videoId).Scan(&deleted.Words)
+		if err != nil {
+			return nil, fmt.Errorf("failed to count caption words of video %s: %w", videoId, err)
+		}
+		return deleted, nil
+	}
+
+	// Children first, both tables reference Videos
+	deleted.Words, err = execCount(ctx, tx, `DELETE FROM CaptionWords WHERE VideoId = ?;`, videoId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete caption words of video %s: %w", videoId, err)
+	}
+	deleted.Captions, err = execCount(ctx, tx, `DELETE FROM Captions WHERE VideoId = ?;`, videoId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete captions of video %s: %w", videoId, err)
+	}
+	_, err = tx.ExecContext(ctx, `DELETE FROM Videos WHERE Id = ?;`, videoId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete video %s: %w", videoId, err)
+	}
+
+	err = s.enqueueOutbox(ctx, tx, videoId)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Deleted video %s with %d captions and %d caption words", videoId, deleted.Captions, deleted.Words)
+	return deleted, nil
+}
+
+// execCount runs a statement and returns how many rows it affected
+func execCount(ctx context.Context, tx *sql.Tx, query string, args ...any) (int64, error) {
+	res, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
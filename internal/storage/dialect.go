@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// dialect holds the SQL that differs between the databases the repository runs on
+type dialect struct {
+	// name is also the directory of the dialect's migrations
+	name string
+	// now and nowPlus are the current time and the current time plus a parameter in microseconds,
+	// with millisecond precision
+	now     string
+	nowPlus string
+	// upsertVideo and saveCheckpoint insert a row or update the existing one
+	upsertVideo    string
+	saveCheckpoint string
+	// lockVideo selects a video, locking its row until the transaction ends
+	lockVideo string
+	// maxPacketSql reads the largest statement the server accepts, empty if there is no limit to ask for
+	maxPacketSql string
+	// lockMigrations takes a lock shared by every process migrating the database, returning its release
+	lockMigrations func(ctx context.Context, conn *sql.Conn) (func(), error)
+}
+
+var mysqlDialect = &dialect{
+	name:    "mysql",
+	now:     `NOW(3)`,
+	nowPlus: `NOW(3) + INTERVAL ? MICROSECOND`,
+	upsertVideo: `INSERT INTO Videos (Id, Title, VideoUrl, ChannelId, UploadDate, IngestedAt)
+							VALUES (?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+							ON DUPLICATE KEY UPDATE
+							Title = VALUES(Title),
+							VideoUrl = VALUES(VideoUrl),
+							ChannelId = VALUES(ChannelId),
+							UploadDate = VALUES(UploadDate),
+							IngestedAt = CURRENT_TIMESTAMP;`,
+	saveCheckpoint: `INSERT INTO Checkpoints (Name, VideoId) VALUES (?, ?)
+								ON DUPLICATE KEY UPDATE VideoId = VALUES(VideoId);`,
+	lockVideo:      `SELECT Id FROM Videos WHERE Id = ? FOR UPDATE;`,
+	maxPacketSql:   `SELECT @@max_allowed_packet;`,
+	lockMigrations: mysqlLock,
+}
+
+// SQLite locks the whole database for writing, so its transactions are already serialised
+var sqliteDialect = &dialect{
+	name:    "sqlite",
+	now:     `strftime('%Y-%m-%d %H:%M:%f', 'now')`,
+	nowPlus: `strftime('%Y-%m-%d %H:%M:%f', 'now', printf('%+.3f seconds', ? / 1000000.0))`,
+	upsertVideo: `INSERT INTO Videos (Id, Title, VideoUrl, ChannelId, UploadDate, IngestedAt)
+							VALUES (?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+							ON CONFLICT (Id) DO UPDATE SET
+							Title = excluded.Title,
+							VideoUrl = excluded.VideoUrl,
+							ChannelId = excluded.ChannelId,
+							UploadDate = excluded.UploadDate,
+							IngestedAt = CURRENT_TIMESTAMP;`,
+	saveCheckpoint: `INSERT INTO Checkpoints (Name, VideoId) VALUES (?, ?)
+								ON CONFLICT (Name) DO UPDATE SET VideoId = excluded.VideoId, UpdatedAt = CURRENT_TIMESTAMP;`,
+	lockVideo: `SELECT Id FROM Videos WHERE Id = ?;`,
+	lockMigrations: func(ctx context.Context, conn *sql.Conn) (func(), error) {
+		return func() {}, nil
+	},
+}
+
+// dialectOf returns the dialect of the driver behind db, MySQL unless it is SQLite
+func dialectOf(db *sql.DB) *dialect {
+	if _, ok := db.Driver().(*sqlite3.SQLiteDriver); ok {
+		return sqliteDialect
+	}
+	return mysqlDialect
+}
+
+// mysqlLock takes a MySQL advisory lock. It belongs to the connection, so everything that needs
+// it has to run on conn.
+func mysqlLock(ctx context.Context, conn *sql.Conn) (func(), error) {
+
+	var locked sql.NullInt64
+	err := conn.QueryRowContext(ctx, `SELECT GET_LOCK(?, ?);`, migrationLock, int(migrationLockTimeout.Seconds())).Scan(&locked)
+	if err != nil {
+		return nil, fmt.Errorf("failed to take migration lock: %w", err)
+	}
+	if locked.Int64 != 1 {
+		return nil, ErrMigrationLocked
+	}
+
+	return func() {
+		// Use a fresh context so the lock is released even if ctx was cancelled
+		if _, err := conn.ExecContext(context.Background(), `SELECT RELEASE_LOCK(?);`, migrationLock); err != nil {
+			log.Printf("Failed to release migration lock: %v", err)
+		}
+	}, nil
+}
@@ -11,6 +11,7 @@ import (
 
 type CaptionMetadata = fetcher.CaptionMetadata
 type CaptionEntry = parser.CaptionEntry
+type TimeMs = parser.TimeMs
 
 type Loader interface {
 	LoadCaptions(ctx context.Context, meta *CaptionMetadata, captions []CaptionEntry) error
@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestEmbeddedMigrations(t *testing.T) {
+
+	var names [][]string
+	for _, d := range []*dialect{mysqlDialect, sqliteDialect} {
+		migrations, err := loadMigrations(migrationFiles, "migrations/"+d.name)
+		if err != nil {
+			t.Fatalf("failed to load embedded %s migrations: %v", d.name, err)
+		}
+		for i, migration := range migrations {
+			if migration.Version != i+1 {
+				t.Fatalf("expected %s migration versions to run 1, 2, 3..., got %d at %d", d.name, migration.Version, i)
+			}
+		}
+		var dialectNames []string
+		for _, migration := range migrations {
+			dialectNames = append(dialectNames, migration.Name)
+		}
+		names = append(names, dialectNames)
+	}
+	// Both databases have to end up on the same schema version through the same migrations
+	if !reflect.DeepEqual(names[0], names[1]) {
+		t.Fatalf("expected the same migrations for sqlite as for mysql, got %v and %v", names[1], names[0])
+	}
+}
+
+func TestLoadMigrations(t *testing.T) {
+
+	fsys := fstest.MapFS{
+		"m/0002_add_channel.up.sql":   {Data: []byte("ALTER TABLE Videos ADD COLUMN Channel VARCHAR(64);")},
+		"m/0002_add_channel.down.sql": {Data: []byte("ALTER TABLE Videos DROP COLUMN Channel;")},
+		"m/0001_initial.up.sql":       {Data: []byte("CREATE TABLE A (Id INT);")},
+		"m/0001_initial.down.sql":     {Data: []byte("DROP TABLE A;")},
+	}
+	migrations, err := loadMigrations(fsys, "m")
+	if err != nil {
+		t.Fatalf("loadMigrations failed: %v", err)
+	}
+	if len(migrations) != 2 || migrations[0].Name != "initial" || migrations[1].Name != "add_channel" {
+		t.Fatalf("expected migrations ordered by version, got %+v", migrations)
+	}
+
+	delete(fsys, "m/0002_add_channel.down.sql")
+	if _, err := loadMigrations(fsys, "m"); err == nil || !strings.Contains(err.Error(), "0002_add_channel") {
+		t.Fatalf("expected an error for a migration without a down file, got %v", err)
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+
+	script := `-- a comment
+CREATE TABLE A (
+    Id INT
+);
+
+DROP TABLE B;
+INSERT INTO C VALUES (1)`
+
+	want := []string{"CREATE TABLE A (\n    Id INT\n);", "DROP TABLE B;", "INSERT INTO C VALUES (1)"}
+	if got := splitStatements(script); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
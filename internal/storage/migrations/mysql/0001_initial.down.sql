@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS Captions;
+DROP TABLE IF EXISTS Videos;
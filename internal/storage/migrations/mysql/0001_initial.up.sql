@@ -0,0 +1,19 @@
+-- The schema from before versioned migrations, as schema/init.sql used to create it. Tables
+-- that already exist are left alone, so a database created by that script takes the later
+-- migrations from here.
+
+CREATE TABLE IF NOT EXISTS Videos (
+    Id VARCHAR(20) PRIMARY KEY,
+    Title VARCHAR(255) NOT NULL,
+    VideoUrl VARCHAR(255) NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS Captions (
+    Id INT AUTO_INCREMENT PRIMARY KEY,
+    VideoId VARCHAR(20) NOT NULL,
+    StartTime INT UNSIGNED NOT NULL,
+    EndTime INT UNSIGNED NOT NULL,
+    CaptionText Text NOT NULL,
+    FOREIGN KEY (VideoId) REFERENCES Videos(Id),
+    INDEX idx_vid_start (VideoId, StartTime)
+);
@@ -0,0 +1,3 @@
+ALTER TABLE Captions
+    DROP INDEX idx_vid_lang,
+    DROP COLUMN Language;
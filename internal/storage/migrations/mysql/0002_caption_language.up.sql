@@ -0,0 +1,4 @@
+-- Captions in more than one language per video. Existing captions were all English.
+ALTER TABLE Captions
+    ADD COLUMN Language VARCHAR(16) NOT NULL DEFAULT 'en' AFTER VideoId,
+    ADD INDEX idx_vid_lang (VideoId, Language);
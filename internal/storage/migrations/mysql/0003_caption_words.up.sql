@@ -0,0 +1,12 @@
+-- Word-level timings of captions that have them
+CREATE TABLE IF NOT EXISTS CaptionWords (
+    Id INT AUTO_INCREMENT PRIMARY KEY,
+    VideoId VARCHAR(20) NOT NULL,
+    Language VARCHAR(16) NOT NULL DEFAULT 'en',
+    CaptionStart INT UNSIGNED NOT NULL,
+    WordIndex SMALLINT UNSIGNED NOT NULL,
+    StartTime INT UNSIGNED NOT NULL,
+    Word VARCHAR(255) NOT NULL,
+    FOREIGN KEY (VideoId) REFERENCES Videos(Id),
+    INDEX idx_words_caption (VideoId, Language, CaptionStart)
+);
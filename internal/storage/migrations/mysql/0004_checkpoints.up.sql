@@ -0,0 +1,6 @@
+-- Where a long running job such as a search index rebuild got to
+CREATE TABLE IF NOT EXISTS Checkpoints (
+    Name VARCHAR(64) PRIMARY KEY,
+    VideoId VARCHAR(20) NOT NULL,
+    UpdatedAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+);
@@ -0,0 +1,11 @@
+-- Videos whose captions are waiting to be written to the search index
+CREATE TABLE IF NOT EXISTS SearchOutbox (
+    Id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    VideoId VARCHAR(20) NOT NULL,
+    Attempts INT UNSIGNED NOT NULL DEFAULT 0,
+    NextAttemptAt TIMESTAMP(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+    LastError TEXT NULL,
+    DeadAt TIMESTAMP(3) NULL,
+    CreatedAt TIMESTAMP(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+    INDEX idx_outbox_due (DeadAt, NextAttemptAt)
+);
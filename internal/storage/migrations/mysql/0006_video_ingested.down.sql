@@ -0,0 +1,4 @@
+ALTER TABLE Videos
+    DROP INDEX idx_videos_ingested,
+    DROP INDEX idx_videos_title,
+    DROP COLUMN IngestedAt;
@@ -0,0 +1,6 @@
+-- When each video was last ingested, and indexes for paging the catalogue. Existing videos are
+-- stamped with the time of the migration.
+ALTER TABLE Videos
+    ADD COLUMN IngestedAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    ADD INDEX idx_videos_title (Title, Id),
+    ADD INDEX idx_videos_ingested (IngestedAt, Id);
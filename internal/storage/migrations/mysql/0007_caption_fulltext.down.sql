@@ -0,0 +1 @@
+ALTER TABLE Captions DROP INDEX ft_captions_text;
@@ -0,0 +1,2 @@
+-- Lets the database answer caption searches while Elasticsearch is unavailable
+ALTER TABLE Captions ADD FULLTEXT INDEX ft_captions_text (CaptionText);
@@ -0,0 +1,5 @@
+ALTER TABLE Videos
+    DROP INDEX idx_videos_uploaded,
+    DROP INDEX idx_videos_channel,
+    DROP COLUMN UploadDate,
+    DROP COLUMN ChannelId;
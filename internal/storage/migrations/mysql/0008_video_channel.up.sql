@@ -0,0 +1,7 @@
+-- Channel and upload date of each video, so searches can be narrowed to them. Both are NULL
+-- for videos ingested before this migration until they are ingested again.
+ALTER TABLE Videos
+    ADD COLUMN ChannelId VARCHAR(64) NULL,
+    ADD COLUMN UploadDate DATE NULL,
+    ADD INDEX idx_videos_channel (ChannelId),
+    ADD INDEX idx_videos_uploaded (UploadDate);
@@ -0,0 +1,18 @@
+-- The schema from before versioned migrations, the same as the MySQL migration in SQLite's
+-- types. Times are UTC text, with milliseconds where MySQL has TIMESTAMP(3).
+
+CREATE TABLE IF NOT EXISTS Videos (
+    Id TEXT PRIMARY KEY,
+    Title TEXT NOT NULL COLLATE NOCASE,
+    VideoUrl TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS Captions (
+    Id INTEGER PRIMARY KEY AUTOINCREMENT,
+    VideoId TEXT NOT NULL REFERENCES Videos(Id),
+    StartTime INTEGER NOT NULL,
+    EndTime INTEGER NOT NULL,
+    CaptionText TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_vid_start ON Captions(VideoId, StartTime);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_vid_lang;
+
+ALTER TABLE Captions DROP COLUMN Language;
@@ -0,0 +1,4 @@
+-- Captions in more than one language per video. Existing captions were all English.
+ALTER TABLE Captions ADD COLUMN Language TEXT NOT NULL DEFAULT 'en';
+
+CREATE INDEX IF NOT EXISTS idx_vid_lang ON Captions(VideoId, Language);
@@ -0,0 +1,12 @@
+-- Word-level timings of captions that have them
+CREATE TABLE IF NOT EXISTS CaptionWords (
+    Id INTEGER PRIMARY KEY AUTOINCREMENT,
+    VideoId TEXT NOT NULL REFERENCES Videos(Id),
+    Language TEXT NOT NULL DEFAULT 'en',
+    CaptionStart INTEGER NOT NULL,
+    WordIndex INTEGER NOT NULL,
+    StartTime INTEGER NOT NULL,
+    Word TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_words_caption ON CaptionWords(VideoId, Language, CaptionStart);
@@ -0,0 +1,6 @@
+-- Where a long running job such as a search index rebuild got to
+CREATE TABLE IF NOT EXISTS Checkpoints (
+    Name TEXT PRIMARY KEY,
+    VideoId TEXT NOT NULL,
+    UpdatedAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,12 @@
+-- Videos whose captions are waiting to be written to the search index
+CREATE TABLE IF NOT EXISTS SearchOutbox (
+    Id INTEGER PRIMARY KEY AUTOINCREMENT,
+    VideoId TEXT NOT NULL,
+    Attempts INTEGER NOT NULL DEFAULT 0,
+    NextAttemptAt TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+    LastError TEXT NULL,
+    DeadAt TIMESTAMP NULL,
+    CreatedAt TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_outbox_due ON SearchOutbox(DeadAt, NextAttemptAt);
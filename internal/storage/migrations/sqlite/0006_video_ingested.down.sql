@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_videos_ingested;
+DROP INDEX IF EXISTS idx_videos_title;
+
+ALTER TABLE Videos DROP COLUMN IngestedAt;
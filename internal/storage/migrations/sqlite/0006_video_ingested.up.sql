@@ -0,0 +1,9 @@
+-- When each video was last ingested, and indexes for paging the catalogue. SQLite can't add a
+-- column defaulting to the current time, so existing videos are stamped here and new ones when
+-- they are saved.
+ALTER TABLE Videos ADD COLUMN IngestedAt TIMESTAMP NOT NULL DEFAULT '1970-01-01 00:00:00';
+
+UPDATE Videos SET IngestedAt = CURRENT_TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_videos_title ON Videos(Title, Id);
+CREATE INDEX IF NOT EXISTS idx_videos_ingested ON Videos(IngestedAt, Id);
@@ -0,0 +1 @@
+-- Nothing to undo, see 0007_caption_fulltext.up.sql
@@ -0,0 +1,2 @@
+-- SQLite has no FULLTEXT index, the MySQL search fallback is not available on it.
+-- This migration only keeps both databases on the same schema version.
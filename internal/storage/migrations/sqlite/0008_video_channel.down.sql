@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_videos_uploaded;
+DROP INDEX IF EXISTS idx_videos_channel;
+
+ALTER TABLE Videos DROP COLUMN UploadDate;
+ALTER TABLE Videos DROP COLUMN ChannelId;
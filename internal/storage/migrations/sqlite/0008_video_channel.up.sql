@@ -0,0 +1,6 @@
+-- Channel and upload date of each video, see the MySQL migration. UploadDate is YYYY-MM-DD text.
+ALTER TABLE Videos ADD COLUMN ChannelId TEXT NULL;
+ALTER TABLE Videos ADD COLUMN UploadDate DATE NULL;
+
+CREATE INDEX IF NOT EXISTS idx_videos_channel ON Videos(ChannelId);
+CREATE INDEX IF NOT EXISTS idx_videos_uploaded ON Videos(UploadDate);
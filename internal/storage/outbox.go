@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// OutboxEntry is a video whose captions changed and still have to be written to the search index
+type OutboxEntry struct {
+	Id        int64
+	VideoId   string
+	Attempts  int
+	CreatedAt time.Time
+}
+
+// enqueueOutbox queues a video for search indexing as part of the transaction that changed it
+func (s *SQLCaptionRepository) enqueueOutbox(ctx context.Context, tx *sql.Tx, videoId string) error {
+
+	_, err := tx.ExecContext(ctx, `INSERT INTO SearchOutbox (VideoId) VALUES (?);`, videoId)
+	if err != nil {
+		return fmt.Errorf("failed to queue video %s for indexing: %w", videoId, err)
+	}
+	return nil
+}
+
+// ClaimOutbox claims up to limit due outbox entries, oldest first, optionally only those of one video.
+// A claimed entry isn't due again until lease has passed, so other dispatchers skip it meanwhile.
+func (s *SQLCaptionRepository) ClaimOutbox(ctx context.Context, videoId string, limit int, lease time.Duration) ([]OutboxEntry, error) {
+
+	selectDueSql := `SELECT Id, VideoId, Attempts, CreatedAt FROM SearchOutbox
+						WHERE DeadAt IS NULL AND NextAttemptAt <= ` + s.dialect.now + ` AND (? = '' OR VideoId = ?)
+						ORDER BY Id LIMIT ?;`
+
+	rows, err := s.db.QueryContext(ctx, selectDueSql, videoId, videoId, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read search outbox: %w", err)
+	}
+	defer rows.Close()
+
+	var due []OutboxEntry
+	for rows.Next() {
+		var entry OutboxEntry
+		if err := rows.Scan(&entry.Id, &entry.VideoId, &entry.Attempts, &entry.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan search outbox entry: %w", err)
+		}
+		due = append(due, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read search outbox: %w", err)
+	}
+
+	claimSql := `UPDATE SearchOutbox SET NextAttemptAt = ` + s.dialect.nowPlus + `
+					WHERE Id = ? AND DeadAt IS NULL AND NextAttemptAt <= ` + s.dialect.now + `;`
+
+	var claimed []OutboxEntry
+	for _, entry := range due {
+		res, err := s.db.ExecContext(ctx, claimSql, lease.Microseconds(), entry.Id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to claim search outbox entry %d: %w", entry.Id, err)
+		}
+		// Someone else got there first
+		if n, err := res.RowsAffected(); err != nil || n == 0 {
+			continue
+		}
+		claimed = append(claimed, entry)
+	}
+	return claimed, nil
+}
+
+// AckOutbox removes an entry once its video has been indexed
+func (s *SQLCaptionRepository) AckOutbox(ctx context.Context, id int64) error {
+
+	_, err := s.db.ExecContext(ctx, `DELETE FROM SearchOutbox WHERE Id = ?;`, id)
+	if err != nil {
+		return fmt.Errorf("failed to remove search outbox entry %d: %w", id, err)
+	}
+	return nil
+}
+
+// FailOutbox records a failed attempt, making the entry due again after retryIn.
+// A dead entry is kept for inspection but never retried.
+func (s *SQLCaptionRepository) FailOutbox(ctx context.Context, id int64, reason string, retryIn time.Duration, dead bool) error {
+
+	failSql := `UPDATE SearchOutbox SET Attempts = Attempts + 1, LastError = ?,
+					NextAttemptAt = ` + s.dialect.nowPlus + `,
+					DeadAt = CASE WHEN ? THEN ` + s.dialect.now + ` ELSE NULL END
+					WHERE Id = ?;`
+
+	_, err := s.db.ExecContext(ctx, failSql, reason, retryIn.Microseconds(), dead, id)
+	if err != nil {
+		return fmt.Errorf("failed to record failure of search outbox entry %d: %w", id, err)
+	}
+	return nil
+}
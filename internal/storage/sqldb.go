@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/cenkalti/backoff/v5"
@@ -14,19 +15,38 @@ import (
 
 type CaptionRepository interface {
 	SaveCaptions(ctx context.Context, meta *CaptionMetadata, captions []CaptionEntry) error
+	ListVideos(ctx context.Context, afterId string, limit int) ([]CaptionMetadata, error)
+	GetCaptions(ctx context.Context, videoId string) ([]CaptionEntry, error)
+	LoadCheckpoint(ctx context.Context, name string) (string, error)
+	SaveCheckpoint(ctx context.Context, name string, videoId string) error
+	GetVideo(ctx context.Context, videoId string) (*CaptionMetadata, error)
+	ClaimOutbox(ctx context.Context, videoId string, limit int, lease time.Duration) ([]OutboxEntry, error)
+	AckOutbox(ctx context.Context, id int64) error
+	FailOutbox(ctx context.Context, id int64, reason string, retryIn time.Duration, dead bool) error
+	DeleteVideo(ctx context.Context, videoId string, dryRun bool) (*DeletedVideo, error)
+	QueryVideos(ctx context.Context, q VideoQuery) (*VideoPage, error)
+	GetVideoDetails(ctx context.Context, videoId string) (*Video, error)
+	GetCaptionWindow(ctx context.Context, videoId string, window CaptionWindow) ([]CaptionEntry, error)
 }
 
 type SQLCaptionRepository struct {
-	db *sql.DB
+	db      *sql.DB
+	dialect *dialect
+	// batchSize is how many rows are written per INSERT, up to the server's packet limit
+	batchSize int
+	maxPacket packetLimit
 }
 
 func NewSQLCaptionRepository(db *sql.DB) *SQLCaptionRepository {
 	return &SQLCaptionRepository{
-		db: db,
+		db:        db,
+		dialect:   dialectOf(db),
+		batchSize: insertBatchSize(),
 	}
 }
 
-func (s *SQLCaptionRepository) SaveCaptions(ctx context.Context, meta *CaptionMetadata, captions []CaptionEntry) error {
+// SaveCaptions replaces a video's captions and queues the video for search indexing, all in one transaction
+func (s *SQLCaptionRepository) SaveCaptions(ctx context.Context, meta *CaptionMetadata, captions []CaptionEntry) (err error) {
 
 	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
@@ -47,6 +67,7 @@ func (s *SQLCaptionRepository) SaveCaptions(ctx context.Context, meta *CaptionMe
 			err = tx.Commit()
 			if err != nil {
 				log.Printf("Failed to commit transaction for video %s: %v", meta.VideoId, err)
+				err = fmt.Errorf("failed to commit captions for video %s: %w", meta.VideoId, err)
 			}
 		}
 	}()
@@ -57,26 +78,63 @@ func (s *SQLCaptionRepository) SaveCaptions(ctx context.Context, meta *CaptionMe
 		return err
 	}
 
-	// 2. Clear (DELETE) existing captions for this video
-	err = s.deleteExistingCaptions(ctx, tx, meta.VideoId)
+	// 2. Clear (DELETE) existing captions for this video in the languages being replaced
+	err = s.deleteExistingCaptions(ctx, tx, meta.VideoId, captionLanguages(captions))
 	if err != nil {
 		return err
 	}
 
 	// 3. Insert new captions (BATCH INSERT)
+	started := time.Now()
 	err = s.insertNewCaptions(ctx, tx, captions)
+	if err != nil {
+		return err
+	}
 
-	return nil
+	// 4. Insert the per-word timings of the new captions
+	words, err := s.insertNewWords(ctx, tx, captions)
+	if err != nil {
+		return err
+	}
+	logInsertRate(meta.VideoId, len(captions)+words, time.Since(started))
+
+	// 5. Queue the video for indexing, committed or rolled back together with the captions
+	err = s.enqueueOutbox(ctx, tx, meta.VideoId)
+
+	return err
 }
 
-func (s *SQLCaptionRepository) upsertVideoMetadata(ctx context.Context, tx *sql.Tx, meta *CaptionMetadata) error {
-	upsertVideoSql := `INSERT INTO Videos (Id, Title, VideoUrl) 
-							VALUES (?, ?, ?)
-							ON DUPLICATE KEY UPDATE
-							Title = VALUES(Title),
-							VideoUrl = VALUES(VideoUrl);`
+// logInsertRate logs how fast a video's caption and word rows were inserted
+func logInsertRate(videoId string, rows int, elapsed time.Duration) {
+	if rows == 0 {
+		return
+	}
+	log.Printf("Inserted %d rows for video %s in %s (%.0f rows/s)", rows, videoId, elapsed.Round(time.Millisecond), float64(rows)/max(elapsed.Seconds(), 1e-9))
+}
 
-	_, err := tx.ExecContext(ctx, upsertVideoSql, meta.VideoId, meta.VideoTitle, meta.Url)
+// nullString stores an empty string as NULL
+func nullString(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// captionLanguages returns the distinct languages of the given captions
+func captionLanguages(captions []CaptionEntry) []string {
+	var languages []string
+	seen := make(map[string]bool)
+	for _, caption := range captions {
+		if !seen[caption.Language] {
+			seen[caption.Language] = true
+			languages = append(languages, caption.Language)
+		}
+	}
+	return languages
+}
+
+func (s *SQLCaptionRepository) upsertVideoMetadata(ctx context.Context, tx *sql.Tx, meta *CaptionMetadata) error {
+	_, err := tx.ExecContext(ctx, s.dialect.upsertVideo, meta.VideoId, meta.VideoTitle, meta.Url, nullString(meta.ChannelId), nullString(meta.UploadDate))
 
 	if err != nil {
 		return fmt.Errorf("failed to upsert video metadata for %s: %w", meta.VideoId, err)
@@ -85,44 +143,99 @@ func (s *SQLCaptionRepository) upsertVideoMetadata(ctx context.Context, tx *sql.
 	return nil
 }
 
-func (s *SQLCaptionRepository) deleteExistingCaptions(ctx context.Context, tx *sql.Tx, videoId string) error {
+func (s *SQLCaptionRepository) deleteExistingCaptions(ctx context.Context, tx *sql.Tx, videoId string, languages []string) error {
+
+	if len(languages) == 0 {
+		return nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(languages)), ", ")
+	deleteCaptionsSql := `DELETE FROM Captions WHERE VideoId = ? AND Language IN (` + placeholders + `);`
 
-	deleteCaptionsSql := `DELETE FROM Captions WHERE VideoId = ?;`
+	args := []any{videoId}
+	for _, lang := range languages {
+		args = append(args, lang)
+	}
 
-	_, err := tx.ExecContext(ctx, deleteCaptionsSql, videoId)
+	_, err := tx.ExecContext(ctx, deleteCaptionsSql, args...)
 
 	if err != nil {
 		return fmt.Errorf("failed to delete existing captions for video %s: %w", videoId, err)
 	}
-	log.Printf("Deleted existing captions for %s", videoId)
+
+	deleteWordsSql := `DELETE FROM CaptionWords WHERE VideoId = ? AND Language IN (` + placeholders + `);`
+
+	_, err = tx.ExecContext(ctx, deleteWordsSql, args...)
+
+	if err != nil {
+		return fmt.Errorf("failed to delete existing caption words for video %s: %w", videoId, err)
+	}
+	log.Printf("Deleted existing %v captions for %s", languages, videoId)
 	return nil
 }
 
 func (s *SQLCaptionRepository) insertNewCaptions(ctx context.Context, tx *sql.Tx, captions []CaptionEntry) error {
 
-	insertCaptionsSQL := `INSERT INTO Captions (VideoId, StartTime, EndTime, CaptionText)
-				   		VALUES (?, ?, ?, ?);`
+	if len(captions) == 0 {
+		return nil
+	}
 
-	st, err := tx.PrepareContext(ctx, insertCaptionsSQL)
+	insertCaptionsSQL := `INSERT INTO Captions (VideoId, Language, StartTime, EndTime, CaptionText) VALUES`
 
+	err := insertBatched(ctx, tx, insertCaptionsSQL, 5, len(captions), s.batchSize, s.maxPacket.get(ctx, s.db, s.dialect), func(i int) []any {
+		c := captions[i]
+		return []any{c.VideoId, c.Language, c.Start, c.End, c.Text}
+	})
 	if err != nil {
-		return fmt.Errorf("failed to prepare statement for captions: %w", err)
+		return fmt.Errorf("failed to insert captions for video %s: %w", captions[0].VideoId, err)
 	}
+	log.Printf("Inserted %d new captions for video %s", len(captions), captions[0].VideoId)
+	return nil
+}
 
-	defer st.Close()
+// captionWord is a word timing with the caption it belongs to
+type captionWord struct {
+	caption *CaptionEntry
+	index   int
+}
+
+// insertNewWords stores word timings keyed by the caption they belong to (video, language and caption start)
+func (s *SQLCaptionRepository) insertNewWords(ctx context.Context, tx *sql.Tx, captions []CaptionEntry) (int, error) {
 
-	for i, caption := range captions {
-		_, err := st.ExecContext(ctx, caption.VideoId, caption.Start, caption.End, caption.Text)
-		if err != nil {
-			return fmt.Errorf("failed to insert caption %d for video %s: %w", i, caption.VideoId, err)
+	var words []captionWord
+	for i := range captions {
+		for j := range captions[i].Words {
+			words = append(words, captionWord{caption: &captions[i], index: j})
 		}
 	}
-	log.Printf("Inserted %d new captions for video %s", len(captions), captions[0].VideoId)
-	return nil
+	if len(words) == 0 {
+		return 0, nil
+	}
+
+	insertWordsSQL := `INSERT INTO CaptionWords (VideoId, Language, CaptionStart, WordIndex, StartTime, Word) VALUES`
+
+	err := insertBatched(ctx, tx, insertWordsSQL, 6, len(words), s.batchSize, s.maxPacket.get(ctx, s.db, s.dialect), func(i int) []any {
+		c, j := words[i].caption, words[i].index
+		return []any{c.VideoId, c.Language, c.Start, j, c.Words[j].Start, c.Words[j].Text}
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert caption words for video %s: %w", captions[0].VideoId, err)
+	}
+	log.Printf("Inserted %d caption words for video %s", len(words), captions[0].VideoId)
+	return len(words), nil
 }
 
+// InitDb connects to the database selected by DB_DRIVER, MySQL by default or SQLite
 func InitDb() (*sql.DB, error) {
 
+	switch driver := os.Getenv("DB_DRIVER"); driver {
+	case "", "mysql":
+	case "sqlite":
+		return OpenSqlite(os.Getenv("DB_PATH"))
+	default:
+		return nil, fmt.Errorf("unknown DB_DRIVER %q, expected mysql or sqlite", driver)
+	}
+
 	timeout := 40 * time.Second
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	parser "banditsecret/internal/parser"
+)
+
+func TestSaveCaptionsReplacesLanguages(t *testing.T) {
+
+	caption := func(lang string, start TimeMs, text string) CaptionEntry {
+		return CaptionEntry{VideoId: "vid1", Language: lang, Start: start, End: start + 1000, Text: text,
+			Words: []parser.Word{{Start: start, Text: text}}}
+	}
+
+	tests := []struct {
+		name  string
+		saves [][]CaptionEntry
+		// want lists the stored captions as "lang start text", ordered by language and start
+		want []string
+	}{
+		{
+			name:  "first save",
+			saves: [][]CaptionEntry{{caption("en", 0, "hello"), caption("fr", 0, "bonjour")}},
+			want:  []string{"en 0 hello", "fr 0 bonjour"},
+		},
+		{
+			name: "saving a language replaces only that language",
+			saves: [][]CaptionEntry{
+				{caption("en", 0, "hello"), caption("en", 1000, "there"), caption("fr", 0, "bonjour")},
+				{caption("en", 500, "hi")},
+			},
+			want: []string{"en 500 hi", "fr 0 bonjour"},
+		},
+		{
+			name: "a new language is added alongside",
+			saves: [][]CaptionEntry{
+				{caption("en", 0, "hello")},
+				{caption("de", 0, "hallo")},
+			},
+			want: []string{"de 0 hallo", "en 0 hello"},
+		},
+		{
+			name: "saving no captions keeps every language",
+			saves: [][]CaptionEntry{
+				{caption("en", 0, "hello"), caption("fr", 0, "bonjour")},
+				nil,
+			},
+			want: []string{"en 0 hello", "fr 0 bonjour"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newSqliteRepo(t)
+			ctx := context.Background()
+			meta := &CaptionMetadata{VideoId: "vid1", VideoTitle: "First", Url: "https://youtu.be/vid1"}
+
+			for _, captions := range tt.saves {
+				if err := repo.SaveCaptions(ctx, meta, captions); err != nil {
+					t.Fatalf("SaveCaptions failed: %v", err)
+				}
+			}
+
+			stored, err := repo.GetCaptions(ctx, "vid1")
+			if err != nil {
+				t.Fatalf("GetCaptions failed: %v", err)
+			}
+			var got []string
+			for _, c := range stored {
+				got = append(got, fmt.Sprintf("%s %d %s", c.Language, c.Start, c.Text))
+				// The words of replaced captions go with them
+				if len(c.Words) != 1 || c.Words[0].Text != c.Text {
+					t.Fatalf("unexpected words %+v for caption %q", c.Words, c.Text)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("expected captions %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
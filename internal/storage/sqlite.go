@@ -0,0 +1,40 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/url"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// defaultSqlitePath is where the SQLite database is kept when DB_PATH isn't set
+const defaultSqlitePath = "banditsecret.db"
+
+// OpenSqlite opens the SQLite database at path, creating it if it doesn't exist. Transactions
+// take the write lock when they begin, so concurrent SaveCaptions calls wait rather than fail.
+func OpenSqlite(path string) (*sql.DB, error) {
+
+	if path == "" {
+		path = defaultSqlitePath
+	}
+
+	params := url.Values{}
+	params.Set("_foreign_keys", "on")
+	params.Set("_busy_timeout", "10000")
+	params.Set("_journal_mode", "WAL")
+	params.Set("_txlock", "immediate")
+
+	db, err := sql.Open("sqlite3", "file:"+path+"?"+params.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sqlite database %s: %w", path, err)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to open sqlite database %s: %w", path, err)
+	}
+
+	log.Printf("Opened sqlite database %s", path)
+	return db, nil
+}
@@ -0,0 +1,272 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	parser "banditsecret/internal/parser"
+)
+
+// newSqliteRepo returns a repository on a fresh, migrated SQLite database
+func newSqliteRepo(t *testing.T) *SQLCaptionRepository {
+	db, err := OpenSqlite(filepath.Join(t.TempDir(), "captions.db"))
+	if err != nil {
+		t.Fatalf("OpenSqlite failed: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrator, err := NewMigrator(db)
+	if err != nil {
+		t.Fatalf("NewMigrator failed: %v", err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatalf("migrating up failed: %v", err)
+	}
+	return NewSQLCaptionRepository(db)
+}
+
+func TestSqliteMigrations(t *testing.T) {
+
+	repo := newSqliteRepo(t)
+	migrator, _ := NewMigrator(repo.db)
+	ctx := context.Background()
+
+	if applied, err := migrator.Up(ctx); err != nil || applied != 0 {
+		t.Fatalf("expected nothing left to apply, got %d, %v", applied, err)
+	}
+	statuses, err := migrator.Status(ctx)
+	if err != nil || len(statuses) == 0 || !statuses[0].Applied {
+		t.Fatalf("expected the first migration to be applied, got %+v, %v", statuses, err)
+	}
+
+	reverted, err := migrator.Down(ctx, len(statuses))
+	if err != nil || reverted != len(statuses) {
+		t.Fatalf("expected every migration to be reverted, got %d, %v", reverted, err)
+	}
+	if _, err := repo.ListVideos(ctx, "", 10); err == nil {
+		t.Fatalf("expected the tables to be dropped")
+	}
+}
+
+// baselineSqliteSchema is schema/init.sql from before versioned migrations, in SQLite's types
+const baselineSqliteSchema = `
+CREATE TABLE IF NOT EXISTS Videos (
+    Id TEXT PRIMARY KEY,
+    Title TEXT NOT NULL COLLATE NOCASE,
+    VideoUrl TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS Captions (
+    Id INTEGER PRIMARY KEY AUTOINCREMENT,
+    VideoId TEXT NOT NULL REFERENCES Videos(Id),
+    StartTime INTEGER NOT NULL,
+    EndTime INTEGER NOT NULL,
+    CaptionText TEXT NOT NULL
+);
+
+CREATE INDEX idx_vid_start ON Captions(VideoId, StartTime);
+`
+
+func TestSqliteMigratesBaselineDatabase(t *testing.T) {
+
+	db, err := OpenSqlite(filepath.Join(t.TempDir(), "captions.db"))
+	if err != nil {
+		t.Fatalf("OpenSqlite failed: %v", err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+
+	for _, stmt := range splitStatements(baselineSqliteSchema) {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			t.Fatalf("failed to create baseline schema: %v", err)
+		}
+	}
+	if _, err := db.ExecContext(ctx, `INSERT INTO Videos (Id, Title, VideoUrl) VALUES ('old', 'Old video', 'https://youtu.be/old');`); err != nil {
+		t.Fatalf("failed to insert video: %v", err)
+	}
+	if _, err := db.ExecContext(ctx, `INSERT INTO Captions (VideoId, StartTime, EndTime, CaptionText) VALUES ('old', 0, 1000, 'hello');`); err != nil {
+		t.Fatalf("failed to insert caption: %v", err)
+	}
+
+	migrator, err := NewMigrator(db)
+	if err != nil {
+		t.Fatalf("NewMigrator failed: %v", err)
+	}
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+	if applied, err := migrator.Up(ctx); err != nil || applied != len(statuses) {
+		t.Fatalf("expected every migration to apply, got %d, %v", applied, err)
+	}
+
+	// Existing captions become English and existing videos are stamped as ingested
+	repo := NewSQLCaptionRepository(db)
+	captions, err := repo.GetCaptions(ctx, "old")
+	if err != nil || len(captions) != 1 || captions[0].Language != "en" || captions[0].Text != "hello" {
+		t.Fatalf("unexpected captions %+v, %v", captions, err)
+	}
+	video, err := repo.GetVideoDetails(ctx, "old")
+	if err != nil || video.IngestedAt.IsZero() || video.IngestedAt.Year() == 1970 {
+		t.Fatalf("unexpected video %+v, %v", video, err)
+	}
+
+	// The migrated schema takes everything the current code writes
+	meta := &CaptionMetadata{VideoId: "new", VideoTitle: "New video", ChannelId: "UC1", UploadDate: "2024-01-31"}
+	fr := []CaptionEntry{{VideoId: "new", Language: "fr", Start: 0, End: 1000, Text: "bonjour", Words: []parser.Word{{Start: 0, Text: "bonjour"}}}}
+	if err := repo.SaveCaptions(ctx, meta, fr); err != nil {
+		t.Fatalf("SaveCaptions failed: %v", err)
+	}
+	page, err := repo.QueryVideos(ctx, VideoQuery{Sort: SortTitle})
+	if err != nil || page.Total != 2 || page.Videos[0].VideoId != "new" {
+		t.Fatalf("unexpected page %+v, %v", page, err)
+	}
+	window, err := repo.GetCaptionWindow(ctx, "new", CaptionWindow{Language: "fr"})
+	if err != nil || len(window) != 1 || len(window[0].Words) != 1 {
+		t.Fatalf("unexpected caption window %+v, %v", window, err)
+	}
+}
+
+func TestSqliteSaveCaptions(t *testing.T) {
+
+	repo := newSqliteRepo(t)
+	ctx := context.Background()
+
+	meta := &CaptionMetadata{VideoId: "vid1", VideoTitle: "First", Url: "https://youtu.be/vid1", ChannelId: "UC1", UploadDate: "2024-01-31"}
+	en := []CaptionEntry{
+		{VideoId: "vid1", Language: "en", Start: 0, End: 1000, Text: "hello there", Words: []parser.Word{{Start: 0, Text: "hello"}, {Start: 500, Text: "there"}}},
+		{VideoId: "vid1", Language: "en", Start: 1000, End: 2000, Text: "general kenobi"},
+	}
+	fr := []CaptionEntry{{VideoId: "vid1", Language: "fr", Start: 0, End: 1000, Text: "bonjour"}}
+
+	for _, captions := range [][]CaptionEntry{en, fr, en} {
+		if err := repo.SaveCaptions(ctx, meta, captions); err != nil {
+			t.Fatalf("SaveCaptions failed: %v", err)
+		}
+	}
+
+	// Saving English again replaces it and leaves French alone
+	got, err := repo.GetCaptions(ctx, "vid1")
+	if err != nil {
+		t.Fatalf("GetCaptions failed: %v", err)
+	}
+	if len(got) != 3 || got[0].Text != "hello there" || len(got[0].Words) != 2 || got[2].Language != "fr" {
+		t.Fatalf("unexpected captions %+v", got)
+	}
+
+	stored, err := repo.GetVideo(ctx, "vid1")
+	if err != nil || *stored != *meta {
+		t.Fatalf("expected metadata %+v, got %+v, %v", meta, stored, err)
+	}
+
+	meta.VideoTitle = "Renamed"
+	if err := repo.SaveCaptions(ctx, meta, fr); err != nil {
+		t.Fatalf("SaveCaptions failed: %v", err)
+	}
+	video, err := repo.GetVideoDetails(ctx, "vid1")
+	if err != nil || video.Title != "Renamed" || len(video.Languages) != 2 || video.Languages[0].Captions != 2 {
+		t.Fatalf("unexpected video %+v, %v", video, err)
+	}
+
+	window, err := repo.GetCaptionWindow(ctx, "vid1", CaptionWindow{From: 1500, Language: "en"})
+	if err != nil || len(window) != 1 || window[0].Text != "general kenobi" {
+		t.Fatalf("unexpected caption window %+v, %v", window, err)
+	}
+}
+
+func TestSqliteQueryVideos(t *testing.T) {
+
+	repo := newSqliteRepo(t)
+	ctx := context.Background()
+
+	for _, meta := range []CaptionMetadata{{VideoId: "b", VideoTitle: "banana"}, {VideoId: "a", VideoTitle: "Cherry"}, {VideoId: "c", VideoTitle: "apple"}} {
+		if err := repo.SaveCaptions(ctx, &meta, nil); err != nil {
+			t.Fatalf("SaveCaptions failed: %v", err)
+		}
+	}
+
+	page, err := repo.QueryVideos(ctx, VideoQuery{Sort: SortTitle, Size: 2})
+	if err != nil {
+		t.Fatalf("QueryVideos failed: %v", err)
+	}
+	if page.Total != 3 || len(page.Videos) != 2 || page.Videos[0].Title != "apple" || page.Videos[1].Title != "banana" {
+		t.Fatalf("unexpected page %+v", page)
+	}
+
+	ids, err := repo.ListVideos(ctx, "a", 10)
+	if err != nil || len(ids) != 2 || ids[0].VideoId != "b" {
+		t.Fatalf("unexpected videos after a: %+v, %v", ids, err)
+	}
+}
+
+func TestSqliteOutbox(t *testing.T) {
+
+	repo := newSqliteRepo(t)
+	ctx := context.Background()
+
+	if err := repo.SaveCaptions(ctx, &CaptionMetadata{VideoId: "vid1"}, nil); err != nil {
+		t.Fatalf("SaveCaptions failed: %v", err)
+	}
+
+	entries, err := repo.ClaimOutbox(ctx, "vid1", 10, time.Minute)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("expected to claim the queued video, got %+v, %v", entries, err)
+	}
+	// A claimed entry isn't due again until its lease runs out
+	if again, _ := repo.ClaimOutbox(ctx, "", 10, time.Minute); len(again) != 0 {
+		t.Fatalf("expected the claimed entry to be leased, got %+v", again)
+	}
+
+	if err := repo.FailOutbox(ctx, entries[0].Id, "index down", 0, false); err != nil {
+		t.Fatalf("FailOutbox failed: %v", err)
+	}
+	retried, err := repo.ClaimOutbox(ctx, "", 10, time.Minute)
+	if err != nil || len(retried) != 1 || retried[0].Attempts != 1 {
+		t.Fatalf("expected the failed entry to be due again, got %+v, %v", retried, err)
+	}
+
+	if err := repo.AckOutbox(ctx, retried[0].Id); err != nil {
+		t.Fatalf("AckOutbox failed: %v", err)
+	}
+	if err := repo.SaveCheckpoint(ctx, "rebuild", "vid1"); err != nil {
+		t.Fatalf("SaveCheckpoint failed: %v", err)
+	}
+	if err := repo.SaveCheckpoint(ctx, "rebuild", "vid2"); err != nil {
+		t.Fatalf("SaveCheckpoint failed: %v", err)
+	}
+	if id, err := repo.LoadCheckpoint(ctx, "rebuild"); err != nil || id != "vid2" {
+		t.Fatalf("expected checkpoint vid2, got %q, %v", id, err)
+	}
+}
+
+func TestSqliteDeleteVideo(t *testing.T) {
+
+	repo := newSqliteRepo(t)
+	ctx := context.Background()
+
+	captions := []CaptionEntry{{VideoId: "vid1", Language: "en", Start: 0, End: 1000, Text: "hello", Words: []parser.Word{{Start: 0, Text: "hello"}}}}
+	if err := repo.SaveCaptions(ctx, &CaptionMetadata{VideoId: "vid1"}, captions); err != nil {
+		t.Fatalf("SaveCaptions failed: %v", err)
+	}
+
+	plan, err := repo.DeleteVideo(ctx, "vid1", true)
+	if err != nil || plan.Captions != 1 || plan.Words != 1 {
+		t.Fatalf("unexpected dry run %+v, %v", plan, err)
+	}
+	if _, err := repo.GetVideo(ctx, "vid1"); err != nil {
+		t.Fatalf("dry run removed the video: %v", err)
+	}
+
+	if _, err := repo.DeleteVideo(ctx, "vid1", false); err != nil {
+		t.Fatalf("DeleteVideo failed: %v", err)
+	}
+	if _, err := repo.GetVideo(ctx, "vid1"); !errors.Is(err, ErrVideoNotFound) {
+		t.Fatalf("expected ErrVideoNotFound, got %v", err)
+	}
+	if _, err := repo.DeleteVideo(ctx, "vid1", false); !errors.Is(err, ErrVideoNotFound) {
+		t.Fatalf("expected ErrVideoNotFound deleting again, got %v", err)
+	}
+}
@@ -0,0 +1,174 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	parser "banditsecret/internal/parser"
+)
+
+// ErrVideoNotFound is returned when a video isn't in the database
+var ErrVideoNotFound = errors.New("video not found")
+
+// metadataColumns are the columns of Videos read by scanMetadata
+const metadataColumns = `Id, Title, VideoUrl, ChannelId, UploadDate`
+
+// scanMetadata reads a video's metadata from a row of metadataColumns
+func scanMetadata(row interface{ Scan(dest ...any) error }, meta *CaptionMetadata) error {
+
+	var channelId sql.NullString
+	var uploaded sql.NullTime
+	if err := row.Scan(&meta.VideoId, &meta.VideoTitle, &meta.Url, &channelId, &uploaded); err != nil {
+		return err
+	}
+	meta.ChannelId = channelId.String
+	if uploaded.Valid {
+		meta.UploadDate = uploaded.Time.Format(time.DateOnly)
+	}
+	return nil
+}
+
+// ListVideos returns up to limit videos ordered by id, starting after afterId. Pass the last id of
+// one page as afterId to get the next, an empty page means there are no more.
+func (s *SQLCaptionRepository) ListVideos(ctx context.Context, afterId string, limit int) ([]CaptionMetadata, error) {
+
+	listVideosSql := `SELECT ` + metadataColumns + ` FROM Videos WHERE Id > ? ORDER BY Id LIMIT ?;`
+
+	rows, err := s.db.QueryContext(ctx, listVideosSql, afterId, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list videos after %q: %w", afterId, err)
+	}
+	defer rows.Close()
+
+	var videos []CaptionMetadata
+	for rows.Next() {
+		var meta CaptionMetadata
+		if err := scanMetadata(rows, &meta); err != nil {
+			return nil, fmt.Errorf("failed to scan video: %w", err)
+		}
+		videos = append(videos, meta)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list videos after %q: %w", afterId, err)
+	}
+	return videos, nil
+}
+
+// GetCaptions returns every caption of a video with its word timings, ordered by language and start time
+func (s *SQLCaptionRepository) GetCaptions(ctx context.Context, videoId string) ([]CaptionEntry, error) {
+
+	getCaptionsSql := `SELECT Language, StartTime, EndTime, CaptionText FROM Captions
+						WHERE VideoId = ? ORDER BY Language, StartTime;`
+
+	rows, err := s.db.QueryContext(ctx, getCaptionsSql, videoId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get captions for video %s: %w", videoId, err)
+	}
+	defer rows.Close()
+
+	var captions []CaptionEntry
+	for rows.Next() {
+		caption := CaptionEntry{VideoId: videoId}
+		if err := rows.Scan(&caption.Language, &caption.Start, &caption.End, &caption.Text); err != nil {
+			return nil, fmt.Errorf("failed to scan caption for video %s: %w", videoId, err)
+		}
+		captions = append(captions, caption)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get captions for video %s: %w", videoId, err)
+	}
+
+	if len(captions) == 0 {
+		return captions, nil
+	}
+
+	err = s.attachWords(ctx, videoId, captions)
+	return captions, err
+}
+
+// attachWords loads the word timings of a video's captions onto them, reading only the words of
+// captions starting within the range the captions cover
+func (s *SQLCaptionRepository) attachWords(ctx context.Context, videoId string, captions []CaptionEntry) error {
+
+	getWordsSql := `SELECT Language, CaptionStart, StartTime, Word FROM CaptionWords
+						WHERE VideoId = ? AND CaptionStart BETWEEN ? AND ?
+						ORDER BY Language, CaptionStart, WordIndex;`
+
+	first, last := captions[0].Start, captions[0].Start
+	for _, caption := range captions {
+		first = min(first, caption.Start)
+		last = max(last, caption.Start)
+	}
+
+	rows, err := s.db.QueryContext(ctx, getWordsSql, videoId, first, last)
+	if err != nil {
+		return fmt.Errorf("failed to get caption words for video %s: %w", videoId, err)
+	}
+	defer rows.Close()
+
+	type captionKey struct {
+		language string
+		start    TimeMs
+	}
+	index := make(map[captionKey]int, len(captions))
+	for i, caption := range captions {
+		index[captionKey{caption.Language, caption.Start}] = i
+	}
+
+	for rows.Next() {
+		var key captionKey
+		var word parser.Word
+		if err := rows.Scan(&key.language, &key.start, &word.Start, &word.Text); err != nil {
+			return fmt.Errorf("failed to scan caption word for video %s: %w", videoId, err)
+		}
+		if i, ok := index[key]; ok {
+			captions[i].Words = append(captions[i].Words, word)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to get caption words for video %s: %w", videoId, err)
+	}
+	return nil
+}
+
+// LoadCheckpoint returns the video id saved under name, empty if there is none
+func (s *SQLCaptionRepository) LoadCheckpoint(ctx context.Context, name string) (string, error) {
+
+	var videoId string
+	err := s.db.QueryRowContext(ctx, `SELECT VideoId FROM Checkpoints WHERE Name = ?;`, name).Scan(&videoId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to load checkpoint %s: %w", name, err)
+	}
+	return videoId, nil
+}
+
+// SaveCheckpoint records the last video processed under name, an empty id clears it
+func (s *SQLCaptionRepository) SaveCheckpoint(ctx context.Context, name string, videoId string) error {
+
+	_, err := s.db.ExecContext(ctx, s.dialect.saveCheckpoint, name, videoId)
+	if err != nil {
+		return fmt.Errorf("failed to save checkpoint %s: %w", name, err)
+	}
+	return nil
+}
+
+// GetVideo returns a video's metadata, or ErrVideoNotFound
+func (s *SQLCaptionRepository) GetVideo(ctx context.Context, videoId string) (*CaptionMetadata, error) {
+
+	meta := &CaptionMetadata{}
+	err := scanMetadata(s.db.QueryRowContext(ctx, `SELECT `+metadataColumns+` FROM Videos WHERE Id = ?;`, videoId), meta)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", ErrVideoNotFound, videoId)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get video %s: %w", videoId, err)
+	}
+	return meta, nil
+}
@@ -0,0 +1,54 @@
+package transcript
+
+import (
+	"encoding/json"
+	"io"
+)
+
+func init() {
+	RegisterWriter(jsonWriter{})
+}
+
+// jsonWriter writes the same layout as the JSON caption cache, so exports can be parsed back in
+type jsonWriter struct{}
+
+type jsonCaption struct {
+	VideoId  string     `json:"video_id"`
+	Language string     `json:"language,omitempty"`
+	Start    string     `json:"start"`
+	End      string     `json:"end"`
+	Text     string     `json:"text"`
+	Words    []jsonWord `json:"words,omitempty"`
+}
+
+type jsonWord struct {
+	Start string `json:"start"`
+	Text  string `json:"text"`
+}
+
+func (jsonWriter) Name() string        { return "json" }
+func (jsonWriter) ContentType() string { return "application/json; charset=utf-8" }
+func (jsonWriter) Extension() string   { return ".json" }
+
+func (jsonWriter) Write(w io.Writer, t *Transcript, opts Options) error {
+
+	captions := prepare(t, opts)
+	out := make([]jsonCaption, 0, len(captions))
+	for _, caption := range captions {
+		c := jsonCaption{
+			VideoId:  caption.VideoId,
+			Language: caption.Language,
+			Start:    caption.Start.String(),
+			End:      caption.End.String(),
+			Text:     caption.Text,
+		}
+		for _, word := range caption.Words {
+			c.Words = append(c.Words, jsonWord{Start: word.Start.String(), Text: word.Text})
+		}
+		out = append(out, c)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
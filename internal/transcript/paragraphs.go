@@ -0,0 +1,39 @@
+package transcript
+
+import "strings"
+
+const (
+	// paragraphGap is the pause between cues that starts a new paragraph
+	paragraphGap TimeMs = 2000
+	// maxParagraphLength ends a paragraph at the next cue once it spans this long
+	maxParagraphLength TimeMs = 60000
+)
+
+// Paragraphs merges runs of consecutive cues into paragraphs. A paragraph ends at a pause of at
+// least paragraphGap, when the language changes, or once it has run for maxParagraphLength.
+func Paragraphs(captions []CaptionEntry) []CaptionEntry {
+
+	var paragraphs []CaptionEntry
+	var text []string
+
+	for i, caption := range captions {
+		last := len(paragraphs) - 1
+		if i > 0 && caption.Language == paragraphs[last].Language &&
+			caption.Start < paragraphs[last].End+paragraphGap &&
+			paragraphs[last].End-paragraphs[last].Start < maxParagraphLength {
+
+			text = append(text, singleLine(caption.Text))
+			paragraphs[last].Text = strings.Join(text, " ")
+			paragraphs[last].End = max(paragraphs[last].End, caption.End)
+			paragraphs[last].Words = append(paragraphs[last].Words, caption.Words...)
+			continue
+		}
+
+		paragraph := caption
+		paragraph.Text = singleLine(caption.Text)
+		paragraph.Words = append([]Word(nil), caption.Words...)
+		paragraphs = append(paragraphs, paragraph)
+		text = []string{paragraph.Text}
+	}
+	return paragraphs
+}
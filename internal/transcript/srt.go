@@ -0,0 +1,36 @@
+package transcript
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+func init() {
+	RegisterWriter(srtWriter{})
+}
+
+// srtWriter writes SubRip, which most video editors import
+type srtWriter struct{}
+
+func (srtWriter) Name() string        { return "srt" }
+func (srtWriter) ContentType() string { return "application/x-subrip; charset=utf-8" }
+func (srtWriter) Extension() string   { return ".srt" }
+
+func (srtWriter) Write(w io.Writer, t *Transcript, opts Options) error {
+	bw := bufio.NewWriter(w)
+
+	for i, caption := range prepare(t, opts) {
+		if i > 0 {
+			bw.WriteString("\n")
+		}
+		fmt.Fprintf(bw, "%d\n%s --> %s\n%s\n", i+1, srtTimestamp(caption.Start), srtTimestamp(caption.End), caption.Text)
+	}
+	return bw.Flush()
+}
+
+// srtTimestamp formats a time as HH:MM:SS,mmm
+func srtTimestamp(t TimeMs) string {
+	return strings.Replace(t.String(), ".", ",", 1)
+}
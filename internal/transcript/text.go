@@ -0,0 +1,71 @@
+package transcript
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+func init() {
+	RegisterWriter(textWriter{})
+	RegisterWriter(markdownWriter{})
+}
+
+// textWriter writes plain text, one cue or paragraph per line
+type textWriter struct{}
+
+func (textWriter) Name() string        { return "txt" }
+func (textWriter) ContentType() string { return "text/plain; charset=utf-8" }
+func (textWriter) Extension() string   { return ".txt" }
+
+func (textWriter) Write(w io.Writer, t *Transcript, opts Options) error {
+	bw := bufio.NewWriter(w)
+
+	for i, caption := range prepare(t, opts) {
+		// Paragraphs are separated by a blank line
+		if i > 0 && opts.Paragraphs {
+			bw.WriteString("\n")
+		}
+		if opts.Timestamps {
+			fmt.Fprintf(bw, "[%s] ", clock(caption.Start))
+		}
+		fmt.Fprintf(bw, "%s\n", singleLine(caption.Text))
+	}
+	return bw.Flush()
+}
+
+// markdownWriter writes Markdown with the video title as a heading. Timestamps link to that
+// moment of the video.
+type markdownWriter struct{}
+
+func (markdownWriter) Name() string        { return "md" }
+func (markdownWriter) ContentType() string { return "text/markdown; charset=utf-8" }
+func (markdownWriter) Extension() string   { return ".md" }
+
+func (markdownWriter) Write(w io.Writer, t *Transcript, opts Options) error {
+	bw := bufio.NewWriter(w)
+
+	title := t.Title
+	if title == "" {
+		title = t.VideoId
+	}
+	fmt.Fprintf(bw, "# %s\n\n", title)
+	if t.Url != "" {
+		fmt.Fprintf(bw, "<%s>\n\n", t.Url)
+	}
+
+	for _, caption := range prepare(t, opts) {
+		if opts.Timestamps {
+			fmt.Fprintf(bw, "[%s](https://youtu.be/%s?t=%d) ", clock(caption.Start), t.VideoId, caption.Start/1000)
+		}
+		// Each cue or paragraph is its own Markdown paragraph
+		fmt.Fprintf(bw, "%s\n\n", singleLine(caption.Text))
+	}
+	return bw.Flush()
+}
+
+// clock formats a time as HH:MM:SS, with more digits of hours past 99
+func clock(t TimeMs) string {
+	seconds := uint32(t) / 1000
+	return fmt.Sprintf("%02d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+}
@@ -0,0 +1,35 @@
+package transcript
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+func init() {
+	RegisterWriter(vttWriter{})
+}
+
+// cueTextEscaper escapes the characters that would otherwise start a tag or entity in cue text
+var cueTextEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// vttWriter writes WebVTT, the format most captions are downloaded in
+type vttWriter struct{}
+
+func (vttWriter) Name() string        { return "vtt" }
+func (vttWriter) ContentType() string { return "text/vtt; charset=utf-8" }
+func (vttWriter) Extension() string   { return ".vtt" }
+
+func (vttWriter) Write(w io.Writer, t *Transcript, opts Options) error {
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprint(bw, "WEBVTT\n")
+	if t.Language != "" {
+		fmt.Fprintf(bw, "Language: %s\n", t.Language)
+	}
+	for _, caption := range prepare(t, opts) {
+		fmt.Fprintf(bw, "\n%s --> %s\n%s\n", caption.Start, caption.End, cueTextEscaper.Replace(caption.Text))
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,117 @@
+// Package transcript renders stored captions back out as transcript files
+package transcript
+
+import (
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	parser "banditsecret/internal/parser"
+)
+
+type CaptionEntry = parser.CaptionEntry
+type TimeMs = parser.TimeMs
+type Word = parser.Word
+
+// Transcript is the captions of one video in one language
+type Transcript struct {
+	VideoId  string
+	Title    string
+	Url      string
+	Language string
+	Captions []CaptionEntry
+}
+
+// Options change how a transcript is written
+type Options struct {
+	// Timestamps prefixes each line with its start time, for formats that aren't already timed
+	Timestamps bool
+	// Paragraphs merges consecutive cues into paragraphs before writing
+	Paragraphs bool
+}
+
+// Writer encodes a transcript in a single file format
+type Writer interface {
+	// Name is a short identifier such as "vtt" or "srt"
+	Name() string
+	ContentType() string
+	// Extension is the file extension, including the leading dot
+	Extension() string
+	Write(w io.Writer, t *Transcript, opts Options) error
+}
+
+// Registry holds the formats transcripts can be written in
+type Registry struct {
+	mu      sync.RWMutex
+	writers []Writer
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+var defaultRegistry = NewRegistry()
+
+// DefaultRegistry returns the registry that the built-in writers register themselves with
+func DefaultRegistry() *Registry {
+	return defaultRegistry
+}
+
+// RegisterWriter adds a writer to the default registry
+func RegisterWriter(w Writer) {
+	defaultRegistry.Register(w)
+}
+
+// Register adds a writer, replacing any existing writer with the same name
+func (r *Registry) Register(w Writer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, existing := range r.writers {
+		if existing.Name() == w.Name() {
+			r.writers[i] = w
+			return
+		}
+	}
+	r.writers = append(r.writers, w)
+}
+
+// ByName looks up a writer by its name
+func (r *Registry) ByName(name string) (Writer, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, w := range r.writers {
+		if w.Name() == name {
+			return w, true
+		}
+	}
+	return nil, false
+}
+
+// Names returns the names of every registered writer in alphabetical order
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.writers))
+	for _, w := range r.writers {
+		names = append(names, w.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+// prepare returns the captions to write, merged into paragraphs if the options ask for it
+func prepare(t *Transcript, opts Options) []CaptionEntry {
+	if opts.Paragraphs {
+		return Paragraphs(t.Captions)
+	}
+	return t.Captions
+}
+
+// singleLine joins the lines of a cue with spaces
+func singleLine(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
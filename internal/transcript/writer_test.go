@@ -0,0 +1,171 @@
+package transcript
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	parser "banditsecret/internal/parser"
+)
+
+func sampleTranscript() *Transcript {
+	return &Transcript{
+		VideoId:  "SampleVideoId",
+		Title:    "Sample video",
+		Url:      "https://youtu.be/SampleVideoId",
+		Language: "en",
+		Captions: []CaptionEntry{
+			{VideoId: "SampleVideoId", Language: "en", Start: 0, End: 1500, Text: "Hello there", Words: []Word{{Start: 0, Text: "Hello"}, {Start: 700, Text: "there"}}},
+			{VideoId: "SampleVideoId", Language: "en", Start: 1500, End: 3000, Text: "general\nKenobi"},
+			{VideoId: "SampleVideoId", Language: "en", Start: 65000, End: 66000, Text: "Later"},
+		},
+	}
+}
+
+func TestWriters(t *testing.T) {
+
+	tests := []struct {
+		format string
+		opts   Options
+		want   string
+	}{
+		{
+			format: "vtt",
+			want: "WEBVTT\nLanguage: en\n\n" +
+				"00:00:00.000 --> 00:00:01.500\nHello there\n\n" +
+				"00:00:01.500 --> 00:00:03.000\ngeneral\nKenobi\n\n" +
+				"00:01:05.000 --> 00:01:06.000\nLater\n",
+		},
+		{
+			format: "srt",
+			opts:   Options{Paragraphs: true},
+			want: "1\n00:00:00,000 --> 00:00:03,000\nHello there general Kenobi\n\n" +
+				"2\n00:01:05,000 --> 00:01:06,000\nLater\n",
+		},
+		{
+			format: "txt",
+			want:   "Hello there\ngeneral Kenobi\nLater\n",
+		},
+		{
+			format: "txt",
+			opts:   Options{Timestamps: true, Paragraphs: true},
+			want:   "[00:00:00] Hello there general Kenobi\n\n[00:01:05] Later\n",
+		},
+		{
+			format: "md",
+			opts:   Options{Timestamps: true, Paragraphs: true},
+			want: "# Sample video\n\n<https://youtu.be/SampleVideoId>\n\n" +
+				"[00:00:00](https://youtu.be/SampleVideoId?t=0) Hello there general Kenobi\n\n" +
+				"[00:01:05](https://youtu.be/SampleVideoId?t=65) Later\n\n",
+		},
+	}
+
+	for _, tt := range tests {
+		writer, ok := DefaultRegistry().ByName(tt.format)
+		if !ok {
+			t.Fatalf("no %s writer registered", tt.format)
+		}
+
+		var buf bytes.Buffer
+		if err := writer.Write(&buf, sampleTranscript(), tt.opts); err != nil {
+			t.Fatalf("%s: Write failed: %v", tt.format, err)
+		}
+		if buf.String() != tt.want {
+			t.Fatalf("%s %+v: got\n%q\nwant\n%q", tt.format, tt.opts, buf.String(), tt.want)
+		}
+	}
+}
+
+// TestJSONRoundTrip checks JSON exports can be read back by the parser
+func TestJSONRoundTrip(t *testing.T) {
+
+	writer, _ := DefaultRegistry().ByName("json")
+	transcript := sampleTranscript()
+
+	var buf bytes.Buffer
+	if err := writer.Write(&buf, transcript, Options{}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "export.json")
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatalf("failed to write export: %v", err)
+	}
+
+	got, err := parser.NewParserService().ParseJSON(path)
+	if err != nil {
+		t.Fatalf("ParseJSON failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, transcript.Captions) {
+		t.Fatalf("got %+v, want %+v", got, transcript.Captions)
+	}
+}
+
+func TestClock(t *testing.T) {
+
+	tests := []struct {
+		time TimeMs
+		want string
+	}{
+		{time: 0, want: "00:00:00"},
+		{time: 65999, want: "00:01:05"},
+		{time: 3723004, want: "01:02:03"},
+		{time: 360000000, want: "100:00:00"},
+	}
+
+	for _, tt := range tests {
+		if got := clock(tt.time); got != tt.want {
+			t.Fatalf("clock(%d): expected %q, got %q", tt.time, tt.want, got)
+		}
+	}
+}
+
+// TestVTTRoundTrip checks cue text with markup characters survives a VTT export and parse
+func TestVTTRoundTrip(t *testing.T) {
+
+	writer, _ := DefaultRegistry().ByName("vtt")
+	transcript := &Transcript{
+		VideoId:  "SampleVideoId",
+		Language: "en",
+		Captions: []CaptionEntry{
+			{Start: 0, End: 1500, Text: "if a < b && b > c"},
+			{Start: 1500, End: 3000, Text: "<3 <b>bold</b> &amp; -->"},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := writer.Write(&buf, transcript, Options{}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if strings.Contains(buf.String(), "<") {
+		t.Fatalf("expected markup characters to be escaped, got\n%s", buf.String())
+	}
+
+	got, err := parser.ParseVTT(&buf, transcript.VideoId)
+	if err != nil {
+		t.Fatalf("ParseVTT failed: %v", err)
+	}
+	if len(got) != len(transcript.Captions) {
+		t.Fatalf("expected %d captions, got %+v", len(transcript.Captions), got)
+	}
+	for i, caption := range got {
+		want := transcript.Captions[i]
+		if caption.Start != want.Start || caption.End != want.End || caption.Text != want.Text {
+			t.Fatalf("caption %d: got %+v, want %+v", i, caption, want)
+		}
+	}
+}
+
+func TestParagraphsSplitOnLanguage(t *testing.T) {
+
+	captions := []CaptionEntry{
+		{Language: "en", Start: 0, End: 1000, Text: "one"},
+		{Language: "fr", Start: 1000, End: 2000, Text: "un"},
+	}
+	if got := Paragraphs(captions); len(got) != 2 {
+		t.Fatalf("expected a paragraph per language, got %+v", got)
+	}
+}
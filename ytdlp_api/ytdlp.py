@@ -1,3 +1,4 @@
+import glob
 import logging
 import os
 import subprocess
@@ -35,48 +36,53 @@ class YtdlpFetchError(Exception):
 
 # ========================= Helper Functions =========================
 
-def fetch_metadata(url: str) -> tuple[str, str]:
-    """Fetch video_id and video_title from a youtube url
+def fetch_metadata(url: str) -> dict[str, str]:
+    """Fetch the id, title, channel id and upload date of a youtube video
 
     Args:
         url (str): valid youtube url
 
     Raises:
         YtdlpFetchError: error in calling yt-dlp
-        YtdlpFetchError: error in output from yt-dlp is not in the form [video_id, video_title]
+        YtdlpFetchError: error in output from yt-dlp is not one line per field
 
     Returns:
-        tuple[str, str]: video_id, and video_title
+        dict[str, str]: id, title, channel_id and upload_date (YYYYMMDD), with
+        channel_id and upload_date empty when yt-dlp doesn't know them
     """
 
+    fields = ['id', 'title', 'channel_id', 'upload_date']
+
     cmd = ['yt-dlp',
-           '--get-id',
-           '--get-title',
            '--no-warnings',
-           '--skip-download',
-           url]
+           '--skip-download']
+    for field in fields:
+        cmd += ['--print', field]
+    cmd.append(url)
 
     try:
         res = subprocess.check_output(cmd, stderr=subprocess.STDOUT, text=True) \
             .strip().split('\n')
 
-        if len(res) != 2:
+        if len(res) != len(fields):
             raise YtdlpFetchError('Unexpected yt-dlp output format')
-        video_title = res[0]
-        video_id = res[1]
 
-        return video_id, video_title
+        # yt-dlp prints NA for fields a video doesn't have
+        return {field: '' if value == 'NA' else value for field, value in zip(fields, res)}
 
     except subprocess.CalledProcessError as e:
         raise YtdlpFetchError(f'yt-dlp failed: {e.output.strip()}')
 
 
-def download_captions(url: str, output_dir: str) -> str:
+def download_captions(url: str, output_dir: str, sub_format: str = 'vtt',
+                      languages: list[str] | None = None) -> str:
     """Download video captions to a given folder
 
     Args:
         url (str): valid youtube url
         output_dir (str): directory to download to
+        sub_format (str): yt-dlp subtitle format preference, e.g. "json3/srv3/vtt"
+        languages (list[str]): caption languages to download, ["all"] for every language. Defaults to ["en"]
 
     Raises:
         YtdlpFetchError: error in calling yt-dlp
@@ -87,11 +93,16 @@ def download_captions(url: str, output_dir: str) -> str:
     video_id = extract_video_id(url)
     os.makedirs(output_dir, exist_ok=True)
 
+    sub_langs = ','.join(languages or ['en'])
+    if 'all' in (languages or []):
+        sub_langs = 'all,-live_chat'
+
     cmd = ['yt-dlp',
            '--write-subs',
            '--write-auto-subs',
            '--no-warnings',
-           '--sub-langs', 'en',
+           '--sub-langs', sub_langs,
+           '--sub-format', sub_format,
            '--skip-download',
            '-o', f'{output_dir}/%(id)s.%(ext)s',
            url]
@@ -100,12 +111,14 @@ def download_captions(url: str, output_dir: str) -> str:
         res = subprocess.check_output(cmd, text=True).strip().split('\n')
         logger.info(res)
 
-        caption_path = os.path.join(output_dir, f"{video_id}.en.vtt")
+        # The extension depends on which of the requested formats was available
+        matches = sorted(glob.glob(os.path.join(output_dir, f"{video_id}.*")))
 
-        if not os.path.exists(caption_path):
-            raise YtdlpFetchError(f"Caption file not found at {caption_path}")
+        if not matches:
+            raise YtdlpFetchError(
+                f"Caption file not found for {video_id} in {output_dir}")
 
-        return caption_path
+        return matches[0]
 
     except subprocess.CalledProcessError as e:
         raise YtdlpFetchError(f'yt-dlp failed: {e.output.strip()}')
@@ -144,8 +157,7 @@ def get_metadata():
         return jsonify({'error': 'Valid Youtube video url is required'}), 400
 
     try:
-        video_id, video_title = fetch_metadata(url)
-        return jsonify({'id': video_id, 'title': video_title})
+        return jsonify(fetch_metadata(url))
 
     except YtdlpFetchError as e:
         return jsonify({'error': str(e)}), 500
@@ -160,9 +172,11 @@ def get_captions():
 
     url = data['url']
     output_dir = data['output_dir']
+    sub_format = data.get('sub_format') or 'vtt'
+    languages = data.get('languages') or ['en']
 
     try:
-        caption_path = download_captions(url, output_dir)
+        caption_path = download_captions(url, output_dir, sub_format, languages)
 
     except YtdlpFetchError as e:
         return jsonify({'error': str(e)}), 500